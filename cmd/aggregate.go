@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+)
+
+// runAggregate prints the CIDR blocks covering the unique addresses of a file.
+func runAggregate(args []string) {
+	fs := flag.NewFlagSet("aggregate", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	maxPrefixes := fs.Int("max", 0, "maximum number of blocks, a smaller cover includes addresses that aren't in the file; 0 for the exact cover")
+	ranges := fs.Bool("ranges", false, "print first-last address ranges instead of CIDR blocks")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s aggregate [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', IPCounter.WithLogger(logger))
+	cover, err := ip.AggregateCIDR(ctx, fs.Arg(0), *maxPrefixes)
+	if err != nil {
+		fatal(logger, "failed to aggregate unique IPs", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if *ranges {
+		for _, r := range cover.Ranges {
+			fmt.Fprintf(out, "%s-%s\n", r.First, r.Last)
+		}
+	} else {
+		for _, prefix := range cover.Prefixes {
+			fmt.Fprintln(out, prefix)
+		}
+	}
+	if err = out.Flush(); err != nil {
+		fatal(logger, "failed to write the cover", slog.Any("error", err))
+	}
+	logger.Info("aggregated unique IPs", slog.Int64("unique", cover.Unique), slog.Int("prefixes", len(cover.Prefixes)),
+		slog.Int("ranges", len(cover.Ranges)), slog.Int64("extra", cover.Extra))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+)
+
+// runClassify prints the unique addresses of a file by category.
+func runClassify(args []string) {
+	fs := flag.NewFlagSet("classify", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s classify [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := append(filters.options(logger), IPCounter.WithLogger(logger))
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', opts...)
+	result, err := ip.Classify(ctx, fs.Arg(0))
+	if err != nil {
+		fatal(logger, "failed to classify unique IPs", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	names := make([]string, 0, len(result.ByCategory))
+	for name := range result.ByCategory {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return result.ByCategory[names[i]] > result.ByCategory[names[j]] ||
+			result.ByCategory[names[i]] == result.ByCategory[names[j]] && names[i] < names[j]
+	})
+	out := bufio.NewWriter(os.Stdout)
+	for _, name := range names {
+		fmt.Fprintf(out, "%-14s %d\n", name, result.ByCategory[name])
+	}
+	fmt.Fprintf(out, "%-14s %d\n%-14s %d\n", "excluded", result.Excluded, "counted", result.Unique)
+	if err = out.Flush(); err != nil {
+		fatal(logger, "failed to write the classification", slog.Any("error", err))
+	}
+}
+
+// filterFlags select the registry, the excluded categories and the CIDR lists filtering the addresses.
+type filterFlags struct {
+	exclude      *string
+	registry     *string
+	includeFiles []string
+	excludeFiles []string
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	f := &filterFlags{
+		exclude:  fs.String("exclude", "", "comma separated address categories left out of the count, e.g. private,loopback,reserved"),
+		registry: fs.String("registry", "", "file of \"prefix category\" lines replacing the built-in special-purpose registry"),
+	}
+	fs.Func("include-cidrs", "file of CIDRs, only their addresses are counted (repeatable)", func(path string) error {
+		f.includeFiles = append(f.includeFiles, path)
+		return nil
+	})
+	fs.Func("exclude-cidrs", "file of CIDRs whose addresses are left out of the count (repeatable)", func(path string) error {
+		f.excludeFiles = append(f.excludeFiles, path)
+		return nil
+	})
+	return f
+}
+
+// options returns the counter options of the flags, it exits on an unreadable file.
+func (c *filterFlags) options(logger *slog.Logger) []IPCounter.Option {
+	var opts []IPCounter.Option
+	if *c.registry != "" {
+		file, err := os.Open(*c.registry)
+		if err != nil {
+			fatal(logger, "failed to open registry", slog.String("path", *c.registry), slog.Any("error", err))
+		}
+		registry, err := IPCounter.ParseRegistry(file)
+		file.Close()
+		if err != nil {
+			fatal(logger, "failed to read registry", slog.String("path", *c.registry), slog.Any("error", err))
+		}
+		opts = append(opts, IPCounter.WithRegistry(registry))
+	}
+	if *c.exclude != "" {
+		opts = append(opts, IPCounter.WithExcludeCategories(strings.Split(*c.exclude, ",")...))
+	}
+	for _, path := range c.includeFiles {
+		prefixes, err := IPCounter.LoadCIDRFile(path)
+		if err != nil {
+			fatal(logger, "failed to read include list", slog.String("path", path), slog.Any("error", err))
+		}
+		opts = append(opts, IPCounter.WithIncludeCIDRs(path, prefixes...))
+	}
+	for _, path := range c.excludeFiles {
+		prefixes, err := IPCounter.LoadCIDRFile(path)
+		if err != nil {
+			fatal(logger, "failed to read exclude list", slog.String("path", path), slog.Any("error", err))
+		}
+		opts = append(opts, IPCounter.WithExcludeCIDRs(path, prefixes...))
+	}
+	return opts
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+)
+
+// runExport writes the unique addresses of a file in ascending order.
+func runExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	formatName := fs.String("format", "text", "output format: text, jsonl, csv or binary")
+	output := fs.String("o", "-", "output file, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+	format, err := IPCounter.ParseExportFormat(*formatName)
+	if err != nil {
+		fatal(logger, "invalid export format", slog.Any("error", err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := createOutput(logger, *output)
+	defer out.Close()
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', IPCounter.WithLogger(logger))
+	count, err := ip.ExportUniqueIP4(ctx, fs.Arg(0), out, format)
+	if err != nil {
+		fatal(logger, "failed to export unique IPs", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	closeOutput(logger, out, *output)
+	logger.Info("exported unique IPs", slog.Int64("count", count), slog.String("format", format.String()), slog.String("output", *output))
+}
+
+// createOutput returns stdout for "-" and the created file otherwise, it exits when the file can't be created.
+func createOutput(logger *slog.Logger, path string) *os.File {
+	if path == "-" {
+		return os.Stdout
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		fatal(logger, "failed to create output file", slog.String("path", path), slog.Any("error", err))
+	}
+	return file
+}
+
+// closeOutput closes an output file of createOutput, it exits when the data didn't make it to the file.
+func closeOutput(logger *slog.Logger, out *os.File, path string) {
+	if out == os.Stdout {
+		return
+	}
+	if err := out.Close(); err != nil {
+		fatal(logger, "failed to write output file", slog.String("path", path), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"ip-counter/pkg/IPCounter/rpc"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+)
+
+// runGRPC serves the IPCounter gRPC service until interrupted.
+func runGRPC(args []string) {
+	fs := flag.NewFlagSet("grpc", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:9090", "address to listen on, the service has no authentication")
+	root := fs.String("root", "", "directory of the files clients may count, relative paths are inside it (required)")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s grpc [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 || *root == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	srv, err := rpc.NewServer(*root, *common.goroutines, append(filters.options(logger), IPCounter.WithLogger(logger))...)
+	if err != nil {
+		fatal(logger, "invalid root", slog.String("root", *root), slog.Any("error", err))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal(logger, "failed to listen", slog.String("addr", *addr), slog.Any("error", err))
+	}
+	server := rpc.NewGRPCServer(srv)
+	go func() {
+		<-ctx.Done()
+		server.GracefulStop()
+	}()
+	logger.Info("serving gRPC", slog.String("addr", listener.Addr().String()), slog.String("root", *root))
+	if err = server.Serve(listener); err != nil {
+		fatal(logger, "gRPC server stopped", slog.String("addr", *addr), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+// runIndex builds a lookup index of the unique addresses of files, and optionally a Bloom filter of them.
+func runIndex(args []string) {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	output := fs.String("o", "ips.idx", "index file")
+	bloomPath := fs.String("bloom", "", "also write a Bloom filter of the addresses to this file")
+	falsePositiveRate := fs.Float64("fp-rate", 0.01, "false positive rate the Bloom filter is sized for")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s index [flags] <file>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', append(filters.options(logger), IPCounter.WithLogger(logger))...)
+	count, err := ip.BuildIndex(ctx, *output, fs.Args()...)
+	if err != nil {
+		fatal(logger, "failed to build index", slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	logger.Info("index built", slog.String("path", *output), slog.Int64("count", count))
+	if *bloomPath == "" {
+		return
+	}
+	index, err := IPCounter.OpenIndex(*output)
+	if err != nil {
+		fatal(logger, "failed to open index", slog.String("path", *output), slog.Any("error", err))
+	}
+	defer index.Close()
+	bloom, err := index.Bloom(*falsePositiveRate)
+	if err != nil {
+		fatal(logger, "failed to build Bloom filter", slog.Any("error", err))
+	}
+	out := createOutput(logger, *bloomPath)
+	defer out.Close()
+	if _, err = bloom.WriteTo(out); err != nil {
+		fatal(logger, "failed to write Bloom filter", slog.String("path", *bloomPath), slog.Any("error", err))
+	}
+	closeOutput(logger, out, *bloomPath)
+	logger.Info("Bloom filter written", slog.String("path", *bloomPath), slog.Float64("fp_rate", *falsePositiveRate))
+}
+
+// runContains prints whether addresses, given as arguments or one per line on stdin, are in an index.
+// It exits with 1 when a single address given as an argument isn't found, like grep.
+func runContains(args []string) {
+	fs := flag.NewFlagSet("contains", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s contains [flags] <index> [address...]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+	index, err := IPCounter.OpenIndex(fs.Arg(0))
+	if err != nil {
+		fatal(logger, "failed to open index", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	defer index.Close()
+
+	out := bufio.NewWriter(os.Stdout)
+	found := false
+	query := func(text string) {
+		addr, err := netip.ParseAddr(strings.TrimSpace(text))
+		if err != nil {
+			fmt.Fprintf(out, "%s invalid\n", text)
+			return
+		}
+		found = index.Contains(addr)
+		fmt.Fprintf(out, "%s %v\n", addr, found)
+	}
+	if fs.NArg() > 1 {
+		for _, text := range fs.Args()[1:] {
+			query(text)
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if text := scanner.Text(); strings.TrimSpace(text) != "" {
+				query(text)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fatal(logger, "failed to read addresses", slog.Any("error", err))
+		}
+	}
+	if err := out.Flush(); err != nil {
+		fatal(logger, "failed to write query results", slog.Any("error", err))
+	}
+	if fs.NArg() == 2 && !found {
+		index.Close()
+		os.Exit(1)
+	}
+}
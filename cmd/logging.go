@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// newLogger returns the logger of the CLI writing to out as text or JSON records from level on.
+func newLogger(out io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch strings.ToLower(format) {
+	case "text":
+		return slog.New(slog.NewTextHandler(out, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(out, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+}
+
+// fatal logs msg at error level and exits with status 1.
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
+}
+
+// commonFlags are the flags every command takes.
+type commonFlags struct {
+	goroutines *int64
+	logFormat  *string
+	logLevel   *string
+}
+
+func addCommonFlags(fs *flag.FlagSet) *commonFlags {
+	return &commonFlags{
+		goroutines: fs.Int64("goroutines", 1, "maximum number of reader goroutines, 0 detects it from the file size"),
+		logFormat:  fs.String("log-format", "text", "format of the log on stderr: text or json"),
+		logLevel:   fs.String("log-level", "info", "minimum log level: debug, info, warn or error"),
+	}
+}
+
+// newLogger returns the logger selected by the flags, it exits on invalid flags.
+func (c *commonFlags) newLogger() *slog.Logger {
+	logger, err := newLogger(os.Stderr, *c.logFormat, *c.logLevel)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return logger
+}
@@ -2,20 +2,108 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"ip-counter/pkg/IPCounter"
-	"log"
+	"log/slog"
+	"os"
+	"os/signal"
 	"time"
 )
 
+// commands are the subcommands, the first argument selects one, without one the file is counted.
+var commands = map[string]func(args []string){
+	"export":    runExport,
+	"aggregate": runAggregate,
+	"prefixes":  runPrefixes,
+	"classify":  runClassify,
+	"compare":   runCompare,
+	"union":     setOpCommand("union", IPCounter.SetUnion),
+	"intersect": setOpCommand("intersect", IPCounter.SetIntersection),
+	"diff":      setOpCommand("diff", IPCounter.SetDifference),
+	"symdiff":   setOpCommand("symdiff", IPCounter.SetSymmetricDifference),
+	"overlap":   runOverlap,
+	"snapshot":  runSnapshot,
+	"merge":     runMerge,
+	"index":     runIndex,
+	"contains":  runContains,
+	"serve":     runServe,
+	"grpc":      runGRPC,
+	"resp":      runRESP,
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
+	common := addCommonFlags(flag.CommandLine)
+	filters := addFilterFlags(flag.CommandLine)
+	progressInterval := flag.Duration("progress", time.Second, "progress report interval, 0 disables progress")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics at /metrics on this address, e.g. :9100")
+	tracePath := flag.String("trace", "", "write trace spans of the scan phases as JSON lines to this file, - for stdout")
+	metricsTextfile := flag.String("metrics-textfile", "", "write Prometheus metrics to this .prom file for the node_exporter textfile collector")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <file>\n       %s <export|aggregate|prefixes|classify> [flags] <file>\n       %s <compare|union|intersect|diff|symdiff|overlap> [flags] <file> <file>...\n       %s snapshot <save|info|query|export|diff|merge> [flags] <args>\n       %s merge [flags] <snapshot>...\n       %s index [flags] <file>...\n       %s contains [flags] <index> [address...]\n       %s <serve|grpc|resp> [flags]\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
 	filePath := "U:/ip_addresses"
+	if flag.NArg() > 0 {
+		filePath = flag.Arg(0)
+	}
+
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := append(filters.options(logger), IPCounter.WithPartialResult(), IPCounter.WithLogger(logger))
+	if *progressInterval > 0 {
+		opts = append(opts, IPCounter.WithProgress(newProgressRenderer(os.Stderr, logger), *progressInterval))
+	}
+	var metrics *IPCounter.Metrics
+	if *metricsAddr != "" || *metricsTextfile != "" {
+		metrics = IPCounter.NewMetrics()
+		opts = append(opts, IPCounter.WithMetrics(metrics))
+	}
+	if *metricsAddr != "" {
+		go func() {
+			if err := metrics.ListenAndServe(ctx, *metricsAddr); err != nil {
+				logger.Error("metrics server stopped", slog.String("addr", *metricsAddr), slog.Any("error", err))
+			}
+		}()
+	}
+	if *tracePath != "" {
+		traceOut := os.Stdout
+		if *tracePath != "-" {
+			traceFile, err := os.Create(*tracePath)
+			if err != nil {
+				fatal(logger, "failed to create trace file", slog.String("path", *tracePath), slog.Any("error", err))
+			}
+			defer traceFile.Close()
+			traceOut = traceFile
+		}
+		opts = append(opts, IPCounter.WithTracer(IPCounter.NewJSONTracer(traceOut)))
+	}
 	start := time.Now()
-	ip := IPCounter.NewIPCounter(1, '\n')
-	v, err := ip.UniqueIP4(context.Background(), filePath) //"U:/ip_addresses"
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', opts...)
+	v, err := ip.UniqueIP4(ctx, filePath)
+	if *metricsTextfile != "" {
+		if textfileErr := metrics.WriteTextfile(*metricsTextfile); textfileErr != nil {
+			logger.Error("failed to write metrics", slog.String("path", *metricsTextfile), slog.Any("error", textfileErr))
+		}
+	}
 	fmt.Printf("Time taken: %s\n", time.Since(start))
+	if errors.Is(err, context.Canceled) {
+		stats := ip.GetStats()
+		fmt.Printf("Interrupted after %d of %d bytes, at least %d unique IPv4 addresses were found", stats.BytesCovered, ip.GetFileSize(), v)
+		os.Exit(1)
+	}
 	if err != nil {
-		log.Fatalf("Failed to count unique IPs in file %s: %v", filePath, err)
+		fatal(logger, "failed to count unique IPs", slog.String("path", filePath), slog.Any("error", err))
 	}
 	fmt.Printf("The number of unique IPv4 addresses found is: %d", v)
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sort"
+)
+
+// runMerge merges the snapshots of several hosts into one and prints the global count.
+func runMerge(args []string) {
+	fs := flag.NewFlagSet("merge", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	modeName := fs.String("mode", "auto", "auto merges exactly unless a snapshot is a sketch, exact fails on sketches, approx merges into a sketch")
+	output := fs.String("o", "merged.snap", "merged snapshot file, empty to only print the count")
+	allowMixed := fs.Bool("allow-mixed-versions", false, "merge snapshots counted by different tool versions, the count may be off")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s merge [flags] <snapshot>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+	mode, err := IPCounter.ParseMergeMode(*modeName)
+	if err != nil {
+		fatal(logger, "invalid merge mode", slog.Any("error", err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	merged, err := IPCounter.MergeSnapshotFiles(ctx, mode, fs.Args()...)
+	if err != nil {
+		fatal(logger, "failed to merge snapshots", slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	if versions := merged.Meta.ToolVersions(); len(versions) > 1 {
+		if !*allowMixed {
+			fatal(logger, "the snapshots were counted by different tool versions, -allow-mixed-versions merges them anyway",
+				slog.Any("versions", versions))
+		}
+		logger.Warn("the snapshots were counted by different tool versions, the count may be off", slog.Any("versions", versions))
+	}
+	if *output != "" {
+		if err = merged.Save(*output); err != nil {
+			fatal(logger, "failed to save snapshot", slog.String("path", *output), slog.Any("error", err))
+		}
+		logger.Info("snapshots merged", slog.String("path", *output), slog.String("kind", merged.Kind().String()))
+	}
+	hosts := map[string]int{}
+	for _, source := range merged.Meta.Sources {
+		hosts[source.Host]++
+	}
+	names := make([]string, 0, len(hosts))
+	for host := range hosts {
+		names = append(names, host)
+	}
+	sort.Strings(names)
+	for _, host := range names {
+		if host == "" {
+			fmt.Printf("%-20s %d sources\n", "(unknown host)", hosts[host])
+		} else {
+			fmt.Printf("%-20s %d sources\n", host, hosts[host])
+		}
+	}
+	count := "unique"
+	if !merged.Exact() {
+		count = "estimated"
+	}
+	fmt.Printf("%s IPv4 addresses: %d\n", count, merged.Count())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+)
+
+// runOverlap prints the intersection sizes and Jaccard similarities of every pair of files.
+func runOverlap(args []string) {
+	fs := flag.NewFlagSet("overlap", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	formatName := fs.String("format", "csv", "output format: csv or json")
+	metric := fs.String("metric", "jaccard", "matrix of the csv output: jaccard or intersection")
+	maxMemory := fs.Int64("max-memory", 1<<30, "bytes the exact sets may take before the matrix is estimated with MinHash, 0 always estimates")
+	output := fs.String("o", "-", "output file, - for stdout")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s overlap [flags] <file> <file>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+	if *formatName != "csv" && *formatName != "json" {
+		fatal(logger, "invalid overlap format", slog.String("format", *formatName))
+	}
+	if *metric != "jaccard" && *metric != "intersection" {
+		fatal(logger, "invalid overlap metric", slog.String("metric", *metric))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', append(filters.options(logger), IPCounter.WithLogger(logger))...)
+	result, err := ip.OverlapMatrix(ctx, fs.Args(), *maxMemory)
+	if err != nil {
+		fatal(logger, "failed to compute the overlap matrix", slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	if !result.Exact {
+		logger.Warn("overlap estimated with MinHash", slog.Int("sketch_size", IPCounter.OverlapSketchSize))
+	}
+	out := createOutput(logger, *output)
+	defer out.Close()
+	if *formatName == "json" {
+		err = json.NewEncoder(out).Encode(result)
+	} else {
+		err = writeOverlapCSV(out, result, *metric)
+	}
+	if err != nil {
+		fatal(logger, "failed to write the overlap matrix", slog.String("output", *output), slog.Any("error", err))
+	}
+	closeOutput(logger, out, *output)
+}
+
+// writeOverlapCSV writes one matrix of result with the labels as the header row and the first column.
+func writeOverlapCSV(out io.Writer, result *IPCounter.Overlap, metric string) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(append([]string{""}, result.Labels...)); err != nil {
+		return err
+	}
+	for i, label := range result.Labels {
+		row := []string{label}
+		for j := range result.Labels {
+			if metric == "intersection" {
+				row = append(row, strconv.FormatInt(result.Intersection[i][j], 10))
+			} else {
+				row = append(row, strconv.FormatFloat(result.Jaccard[i][j], 'f', 4, 64))
+			}
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
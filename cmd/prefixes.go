@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+)
+
+// runPrefixes prints the distinct prefixes of a file and the densest ones for every prefix length.
+func runPrefixes(args []string) {
+	fs := flag.NewFlagSet("prefixes", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	lengthList := fs.String("lengths", "8,16,24", "comma separated prefix lengths")
+	topK := fs.Int("top", 10, "densest prefixes to print for every length")
+	histogram := fs.Bool("histogram", false, "print every non-empty prefix with its number of addresses")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s prefixes [flags] <file>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+	var lengths []int
+	for _, field := range strings.Split(*lengthList, ",") {
+		length, err := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(field), "/"))
+		if err != nil {
+			fatal(logger, "invalid prefix length", slog.String("length", field))
+		}
+		lengths = append(lengths, length)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := bufio.NewWriter(os.Stdout)
+	var onPrefix func(IPCounter.PrefixCount)
+	if *histogram {
+		onPrefix = func(pc IPCounter.PrefixCount) {
+			fmt.Fprintf(out, "%s %d\n", pc.Prefix, pc.Count)
+		}
+	}
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', IPCounter.WithLogger(logger))
+	stats, err := ip.PrefixCounts(ctx, fs.Arg(0), lengths, *topK, onPrefix)
+	if err != nil {
+		fatal(logger, "failed to count prefixes", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	for _, s := range stats {
+		fmt.Fprintf(out, "/%d distinct %d\n", s.Bits, s.Distinct)
+		for _, pc := range s.Top {
+			fmt.Fprintf(out, "  %s %d\n", pc.Prefix, pc.Count)
+		}
+	}
+	if err = out.Flush(); err != nil {
+		fatal(logger, "failed to write prefixes", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// newProgressRenderer returns a progress observer drawing a progress bar when out is a terminal
+// and logging a record per report to logger otherwise, e.g. when stderr goes to a log file.
+func newProgressRenderer(out *os.File, logger *slog.Logger) func(IPCounter.Progress) {
+	if info, err := out.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		return func(p IPCounter.Progress) {
+			drawProgressBar(out, p)
+		}
+	}
+	return func(p IPCounter.Progress) {
+		logger.Info("progress",
+			slog.Float64("percent", float64(int(percent(p)*10))/10),
+			slog.Int64("bytes", p.BytesProcessed),
+			slog.Int64("total_bytes", p.TotalBytes),
+			slog.Int64("lines", p.Lines),
+			slog.Int64("valid_lines", p.ValidLines),
+			slog.Int64("invalid_lines", p.InvalidLines),
+			slog.Int64("unique", p.UniqueCount),
+			slog.Duration("elapsed", p.Elapsed.Round(time.Second)),
+			slog.Duration("eta", p.ETA),
+			slog.Bool("done", p.Done))
+	}
+}
+
+// drawProgressBar redraws the bar in place, the final report ends the line.
+func drawProgressBar(out io.Writer, p IPCounter.Progress) {
+	filled := int(percent(p) / 100 * progressBarWidth)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressBarWidth-filled)
+	eta := "--"
+	if p.ETA > 0 {
+		eta = p.ETA.String()
+	}
+	fmt.Fprintf(out, "\r[%s] %5.1f%% %s/%s %d unique ETA %-10s", bar, percent(p), formatBytes(p.BytesProcessed), formatBytes(p.TotalBytes), p.UniqueCount, eta)
+	if p.Done {
+		fmt.Fprintln(out)
+	}
+}
+
+func percent(p IPCounter.Progress) float64 {
+	if p.TotalBytes == 0 {
+		return 100
+	}
+	return float64(p.BytesProcessed) * 100 / float64(p.TotalBytes)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
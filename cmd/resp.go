@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"ip-counter/pkg/IPCounter/resp"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+)
+
+// runRESP serves sets and HyperLogLog sketches over the Redis protocol until interrupted.
+func runRESP(args []string) {
+	fs := flag.NewFlagSet("resp", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:6379", "address to listen on, there's no AUTH and no limit on keys or memory")
+	precision := fs.Int("precision", IPCounter.DefaultHLLPrecision, "HyperLogLog precision of PFADD and PFMERGE keys, 4 to 18")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s resp [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	server, err := resp.NewServer(*precision, logger)
+	if err != nil {
+		fatal(logger, "invalid HyperLogLog precision", slog.Int("precision", *precision), slog.Any("error", err))
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fatal(logger, "failed to listen", slog.String("addr", *addr), slog.Any("error", err))
+	}
+	if !isLoopback(*addr) {
+		logger.Warn("serving the Redis protocol without authentication or memory limits beyond localhost", slog.String("addr", *addr))
+	}
+	logger.Info("serving the Redis protocol", slog.String("addr", listener.Addr().String()))
+	if err = server.Serve(ctx, listener); err != nil {
+		fatal(logger, "Redis protocol server stopped", slog.String("addr", *addr), slog.Any("error", err))
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"net"
+	"net/netip"
+	"os"
+	"os/signal"
+)
+
+// runServe serves the REST API of count, export and diff jobs over files local to the server.
+func runServe(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to listen on, the API has no authentication: bind other interfaces only with -root")
+	concurrency := fs.Int("concurrency", 1, "jobs running at once")
+	memoryBudget := fs.Int64("memory-budget", 2<<30, "estimated bytes all running jobs may hold, an exact IPv4 scan takes up to 512MB, 0 disables the budget")
+	root := fs.String("root", "", "only serve files inside this directory, relative job paths are inside it")
+	resultDir := fs.String("result-dir", "", "directory of the files export jobs write, a temporary one by default")
+	retention := fs.Duration("retention", 0, "forget finished jobs and their files after this long, 1h by default")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s serve [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	config := IPCounter.JobConfig{
+		Concurrency:  *concurrency,
+		MemoryBudget: *memoryBudget,
+		Goroutines:   *common.goroutines,
+		Root:         *root,
+		ResultDir:    *resultDir,
+		Retention:    *retention,
+	}
+	server, err := IPCounter.NewJobServer(config, append(filters.options(logger), IPCounter.WithLogger(logger))...)
+	if err != nil {
+		fatal(logger, "failed to create job server", slog.Any("error", err))
+	}
+	if *root == "" && !isLoopback(*addr) {
+		logger.Warn("serving every file the process can read without authentication, set -root", slog.String("addr", *addr))
+	}
+	logger.Info("serving jobs", slog.String("addr", *addr), slog.Int("concurrency", *concurrency), slog.Int64("memory_budget", *memoryBudget))
+	if err = server.ListenAndServe(ctx, *addr); err != nil {
+		fatal(logger, "job server stopped", slog.String("addr", *addr), slog.Any("error", err))
+	}
+}
+
+// isLoopback reports whether addr only listens on localhost, an empty host listens on every interface.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
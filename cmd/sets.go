@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"os"
+	"os/signal"
+)
+
+// runCompare prints the unique addresses of every file and the sizes of their union, intersection, difference and symmetric difference.
+func runCompare(args []string) {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	filters := addFilterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s compare [flags] <file> <file>...\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	logger := common.newLogger()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', append(filters.options(logger), IPCounter.WithLogger(logger))...)
+	result, err := ip.CompareSets(ctx, fs.Args()...)
+	if err != nil {
+		fatal(logger, "failed to compare files", slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	printComparison(fs.Args(), result)
+}
+
+// printComparison prints the unique addresses of every input and the sizes of the set operations over them.
+func printComparison(paths []string, result *IPCounter.SetComparison) {
+	for i, path := range paths {
+		fmt.Printf("%-20s %d  %s\n", "unique", result.Unique[i], path)
+	}
+	fmt.Printf("%-20s %d\n%-20s %d\n%-20s %d\n%-20s %d\n",
+		IPCounter.SetUnion, result.Union,
+		IPCounter.SetIntersection, result.Intersection,
+		IPCounter.SetDifference, result.Difference,
+		IPCounter.SetSymmetricDifference, result.SymmetricDifference)
+}
+
+// setOpCommand returns the subcommand writing the addresses of op over the unique addresses of the files.
+func setOpCommand(name string, op IPCounter.SetOp) func(args []string) {
+	return func(args []string) {
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		common := addCommonFlags(fs)
+		filters := addFilterFlags(fs)
+		formatName := fs.String("format", "text", "output format: text, jsonl, csv or binary")
+		output := fs.String("o", "-", "output file, - for stdout")
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s %s [flags] <file> <file>...\n", os.Args[0], name)
+			fs.PrintDefaults()
+		}
+		_ = fs.Parse(args)
+		if fs.NArg() < 2 {
+			fs.Usage()
+			os.Exit(2)
+		}
+		logger := common.newLogger()
+		format, err := IPCounter.ParseExportFormat(*formatName)
+		if err != nil {
+			fatal(logger, "invalid export format", slog.Any("error", err))
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		out := createOutput(logger, *output)
+		defer out.Close()
+		ip := IPCounter.NewIPCounter(*common.goroutines, '\n', append(filters.options(logger), IPCounter.WithLogger(logger))...)
+		count, err := ip.ExportSetOp(ctx, op, fs.Args(), out, format)
+		if err != nil {
+			fatal(logger, "failed to export set", slog.String("operation", op.String()), slog.Any("paths", fs.Args()), slog.Any("error", err))
+		}
+		closeOutput(logger, out, *output)
+		logger.Info("exported set", slog.String("operation", op.String()), slog.Int64("count", count), slog.String("format", format.String()), slog.String("output", *output))
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"net/netip"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+// snapshotCommands are the subcommands of the snapshot command.
+var snapshotCommands = map[string]func(args []string){
+	"save":   runSnapshotSave,
+	"info":   runSnapshotInfo,
+	"query":  runSnapshotQuery,
+	"export": runSnapshotExport,
+	"diff":   runSnapshotDiff,
+	"merge":  runMerge,
+}
+
+// runSnapshot dispatches to the snapshot subcommands.
+func runSnapshot(args []string) {
+	if len(args) > 0 {
+		if command, ok := snapshotCommands[args[0]]; ok {
+			command(args[1:])
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Usage: %s snapshot <save|info|query|export|diff|merge> [flags] <args>\n", os.Args[0])
+	os.Exit(2)
+}
+
+// snapshotFlags parses the flags of a snapshot subcommand and exits when fewer than minArgs arguments are left.
+func snapshotFlags(fs *flag.FlagSet, args []string, usage string, minArgs int) (*commonFlags, *slog.Logger) {
+	common := addCommonFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s snapshot %s %s\n", os.Args[0], fs.Name(), usage)
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+	if fs.NArg() < minArgs {
+		fs.Usage()
+		os.Exit(2)
+	}
+	return common, common.newLogger()
+}
+
+// loadSnapshots loads every path, it exits on the first one that can't be loaded.
+func loadSnapshots(logger *slog.Logger, paths []string) []*IPCounter.Snapshot {
+	snapshots := make([]*IPCounter.Snapshot, len(paths))
+	for i, path := range paths {
+		var err error
+		if snapshots[i], err = IPCounter.LoadSnapshot(path); err != nil {
+			fatal(logger, "failed to load snapshot", slog.String("path", path), slog.Any("error", err))
+		}
+	}
+	return snapshots
+}
+
+// runSnapshotSave counts files into a snapshot.
+func runSnapshotSave(args []string) {
+	fs := flag.NewFlagSet("save", flag.ExitOnError)
+	filters := addFilterFlags(fs)
+	kindName := fs.String("kind", "roaring", "set backend: roaring, bitmap, sorted or hll")
+	precision := fs.Int("precision", IPCounter.DefaultHLLPrecision, "HyperLogLog precision of an hll snapshot, 4 to 18")
+	output := fs.String("o", "ips.snap", "snapshot file")
+	common, logger := snapshotFlags(fs, args, "[flags] <file>...", 1)
+	kind, err := IPCounter.ParseSnapshotKind(*kindName)
+	if err != nil {
+		fatal(logger, "invalid snapshot kind", slog.Any("error", err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts := append(filters.options(logger), IPCounter.WithLogger(logger), IPCounter.WithHLLPrecision(*precision))
+	ip := IPCounter.NewIPCounter(*common.goroutines, '\n', opts...)
+	snapshot, err := ip.TakeSnapshot(ctx, kind, fs.Args()...)
+	if err != nil {
+		fatal(logger, "failed to take snapshot", slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	if err = snapshot.Save(*output); err != nil {
+		fatal(logger, "failed to save snapshot", slog.String("path", *output), slog.Any("error", err))
+	}
+	logger.Info("snapshot saved", slog.String("path", *output), slog.String("kind", kind.String()), slog.Int64("count", snapshot.Count()))
+}
+
+// runSnapshotInfo prints the kind, the count and the metadata of snapshots.
+func runSnapshotInfo(args []string) {
+	fs := flag.NewFlagSet("info", flag.ExitOnError)
+	_, logger := snapshotFlags(fs, args, "<snapshot>...", 1)
+	out := bufio.NewWriter(os.Stdout)
+	for i, snapshot := range loadSnapshots(logger, fs.Args()) {
+		count := "unique"
+		if !snapshot.Exact() {
+			count = "estimated"
+		}
+		meta := snapshot.Meta
+		fmt.Fprintf(out, "%s\n  kind %s\n  %s %d\n  created %s by %s\n  data from %s to %s\n",
+			fs.Arg(i), snapshot.Kind(), count, snapshot.Count(), meta.Created.Format(time.RFC3339), meta.ToolVersion,
+			meta.First.Format(time.RFC3339), meta.Last.Format(time.RFC3339))
+		for _, source := range meta.Sources {
+			host := source.Host
+			if host == "" {
+				host = "unknown host"
+			}
+			fmt.Fprintf(out, "  source %s on %s %d bytes modified %s", source.Path, host, source.Size, source.ModTime.Format(time.RFC3339))
+			if source.ToolVersion != "" {
+				fmt.Fprintf(out, " counted by %s", source.ToolVersion)
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		fatal(logger, "failed to write snapshot info", slog.Any("error", err))
+	}
+}
+
+// runSnapshotQuery prints whether addresses, given as arguments or one per line on stdin, are in a snapshot.
+func runSnapshotQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	_, logger := snapshotFlags(fs, args, "<snapshot> [address...]", 1)
+	snapshot := loadSnapshots(logger, fs.Args()[:1])[0]
+	out := bufio.NewWriter(os.Stdout)
+	query := func(text string) {
+		addr, err := netip.ParseAddr(strings.TrimSpace(text))
+		if err != nil {
+			fmt.Fprintf(out, "%s invalid\n", text)
+			return
+		}
+		found, err := snapshot.Contains(addr)
+		if err != nil {
+			fatal(logger, "failed to query snapshot", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+		}
+		fmt.Fprintf(out, "%s %v\n", addr, found)
+	}
+	if fs.NArg() > 1 {
+		for _, text := range fs.Args()[1:] {
+			query(text)
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if text := scanner.Text(); strings.TrimSpace(text) != "" {
+				query(text)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fatal(logger, "failed to read addresses", slog.Any("error", err))
+		}
+	}
+	if err := out.Flush(); err != nil {
+		fatal(logger, "failed to write query results", slog.Any("error", err))
+	}
+}
+
+// runSnapshotExport writes the addresses of a snapshot.
+func runSnapshotExport(args []string) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	formatName := fs.String("format", "text", "output format: text, jsonl, csv or binary")
+	output := fs.String("o", "-", "output file, - for stdout")
+	_, logger := snapshotFlags(fs, args, "[flags] <snapshot>", 1)
+	format, err := IPCounter.ParseExportFormat(*formatName)
+	if err != nil {
+		fatal(logger, "invalid export format", slog.Any("error", err))
+	}
+	snapshot := loadSnapshots(logger, fs.Args()[:1])[0]
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	out := createOutput(logger, *output)
+	defer out.Close()
+	count, err := snapshot.Export(ctx, out, format)
+	if err != nil {
+		fatal(logger, "failed to export snapshot", slog.String("path", fs.Arg(0)), slog.Any("error", err))
+	}
+	closeOutput(logger, out, *output)
+	logger.Info("exported snapshot", slog.Int64("count", count), slog.String("format", format.String()), slog.String("output", *output))
+}
+
+// runSnapshotDiff prints the set operations over snapshots, or exports the addresses of one of them with -op.
+func runSnapshotDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	opName := fs.String("op", "", "export the addresses of union, intersection, difference or symmetric-difference instead of printing the counts")
+	formatName := fs.String("format", "text", "output format of -op: text, jsonl, csv or binary")
+	output := fs.String("o", "-", "output file of -op, - for stdout")
+	_, logger := snapshotFlags(fs, args, "[flags] <snapshot> <snapshot>...", 2)
+	snapshots := loadSnapshots(logger, fs.Args())
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if *opName == "" {
+		result, err := IPCounter.CompareSnapshots(ctx, snapshots...)
+		if err != nil {
+			fatal(logger, "failed to compare snapshots", slog.Any("paths", fs.Args()), slog.Any("error", err))
+		}
+		printComparison(fs.Args(), result)
+		return
+	}
+	op, err := IPCounter.ParseSetOp(*opName)
+	if err != nil {
+		fatal(logger, "invalid set operation", slog.Any("error", err))
+	}
+	format, err := IPCounter.ParseExportFormat(*formatName)
+	if err != nil {
+		fatal(logger, "invalid export format", slog.Any("error", err))
+	}
+	out := createOutput(logger, *output)
+	defer out.Close()
+	count, err := IPCounter.ExportSnapshotOp(ctx, op, snapshots, out, format)
+	if err != nil {
+		fatal(logger, "failed to export set", slog.String("operation", op.String()), slog.Any("paths", fs.Args()), slog.Any("error", err))
+	}
+	closeOutput(logger, out, *output)
+	logger.Info("exported set", slog.String("operation", op.String()), slog.Int64("count", count), slog.String("format", format.String()), slog.String("output", *output))
+}
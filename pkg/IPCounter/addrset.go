@@ -0,0 +1,68 @@
+package IPCounter
+
+import (
+	"encoding/binary"
+	"net/netip"
+	"sync"
+)
+
+// AddrSet is an in-memory set of addresses that is safe for concurrent use, for servers collecting addresses
+// pushed by clients instead of scanning files. IPv4 addresses (and IPv4-mapped IPv6) go to a roaringSet of about
+// 2 bytes per address, IPv6 addresses to a map.
+type AddrSet struct {
+	mu sync.RWMutex
+	v4 *roaringSet
+	v6 map[netip.Addr]struct{}
+}
+
+// NewAddrSet returns an empty set.
+func NewAddrSet() *AddrSet {
+	return &AddrSet{v4: newRoaringSet(), v6: make(map[netip.Addr]struct{})}
+}
+
+// Add inserts addr and reports whether it wasn't in the set before, the zero Addr is never added.
+func (s *AddrSet) Add(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	switch {
+	case addr.Is4():
+		a := addr.As4()
+		return s.AddUint32(binary.BigEndian.Uint32(a[:]))
+	case !addr.IsValid():
+		return false
+	}
+	addr = addr.WithZone("")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.v6[addr]; ok {
+		return false
+	}
+	s.v6[addr] = struct{}{}
+	return true
+}
+
+// AddUint32 inserts the IPv4 address ip32 and reports whether it wasn't in the set before.
+func (s *AddrSet) AddUint32(ip32 uint32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.v4.add(ip32)
+}
+
+// Contains reports whether addr is in the set.
+func (s *AddrSet) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if addr.Is4() {
+		a := addr.As4()
+		return s.v4.contains(binary.BigEndian.Uint32(a[:]))
+	}
+	_, ok := s.v6[addr.WithZone("")]
+	return ok
+}
+
+// Count returns the number of addresses in the set.
+func (s *AddrSet) Count() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.v4.count() + int64(len(s.v6))
+}
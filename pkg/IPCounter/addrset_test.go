@@ -0,0 +1,48 @@
+package IPCounter
+
+import (
+	"net/netip"
+	"sync"
+	"testing"
+)
+
+func TestAddrSet(t *testing.T) {
+	s := NewAddrSet()
+	tests := []struct {
+		addr  string
+		added bool
+	}{
+		{addr: "1.1.1.1", added: true},
+		{addr: "1.1.1.1", added: false},
+		{addr: "::ffff:1.1.1.1", added: false},
+		{addr: "2001:db8::1", added: true},
+		{addr: "2001:db8::1%eth0", added: false},
+		{addr: "10.0.0.1", added: true},
+	}
+	for _, tt := range tests {
+		if got := s.Add(netip.MustParseAddr(tt.addr)); got != tt.added {
+			t.Errorf("Add(%s) = %v; want %v", tt.addr, got, tt.added)
+		}
+	}
+	if s.Add(netip.Addr{}) {
+		t.Errorf("Add() of the zero Addr = true")
+	}
+	if !s.Contains(netip.MustParseAddr("::ffff:10.0.0.1")) || !s.Contains(netip.MustParseAddr("2001:db8::1")) || s.Contains(netip.MustParseAddr("2001:db8::2")) {
+		t.Errorf("Contains() doesn't match the added addresses")
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := uint32(0); i < 1000; i++ {
+				s.AddUint32(i<<8 | uint32(g))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got := s.Count(); got != 3+4000 {
+		t.Errorf("Count() = %d; want %d", got, 3+4000)
+	}
+}
@@ -0,0 +1,183 @@
+package IPCounter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"net/netip"
+)
+
+const (
+	bloomMagic     = "IPCBLM"
+	bloomVersion   = 1
+	maxBloomHashes = 30
+	maxBloomBits   = 1 << 36 //8gb, far above the 2^32 addresses at any useful rate
+)
+
+var (
+	// ErrInvalidFalsePositiveRate is returned for a Bloom filter false positive rate outside (0, 1).
+	ErrInvalidFalsePositiveRate = errors.New("false positive rate must be between 0 and 1")
+	// ErrBloomCorrupted is returned when a Bloom filter fails its checksum or its header doesn't fit its size.
+	ErrBloomCorrupted = errors.New("bloom filter is corrupted")
+)
+
+// BloomFilter answers probabilistic membership: an address that was added is always found, one that wasn't is
+// found with about the false positive rate the filter was sized for.
+//
+// Systems without this package can read it: WriteTo writes, little endian, the magic "IPCBLM", the version, the
+// number of hashes k as u8, the number of bits m and the number of addresses as u64, the m/64 u64 words and a
+// CRC32 of everything before it. The hash of an address as big endian u32 is the splitmix64 finalizer of
+// ip + 0x9e3779b97f4a7c15, its low 32 bits are h1 and its high 32 bits with the lowest bit set are h2, and
+// bit (h1 + i*h2) mod m (bit b is bit b%64 of word b/64) is set for i = 0..k-1.
+type BloomFilter struct {
+	hashes uint8
+	bits   []uint64
+	n      int64
+}
+
+// NewBloomFilter returns an empty filter sized for n addresses at the false positive rate.
+func NewBloomFilter(n int64, falsePositiveRate float64) (*BloomFilter, error) {
+	if !(falsePositiveRate > 0 && falsePositiveRate < 1) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFalsePositiveRate, falsePositiveRate)
+	}
+	n = max(n, 1)
+	m := math.Ceil(-float64(n) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	words := int64(math.Min(math.Ceil(m/64), maxBloomBits/64))
+	k := math.Round(float64(words*64) / float64(n) * math.Ln2)
+	return &BloomFilter{hashes: uint8(math.Max(1, math.Min(k, maxBloomHashes))), bits: make([]uint64, words)}, nil
+}
+
+// Add adds addr, IPv4-mapped IPv6 addresses as IPv4 and other IPv6 addresses not at all.
+func (f *BloomFilter) Add(addr netip.Addr) {
+	if addr = addr.Unmap(); addr.Is4() {
+		a := addr.As4()
+		f.add(binary.BigEndian.Uint32(a[:]))
+	}
+}
+
+func (f *BloomFilter) add(ip32 uint32) {
+	h1, h2, m := f.hash(ip32)
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		bit := (h1 + i*h2) % m
+		f.bits[bit>>6] |= 1 << (bit & 63)
+	}
+	f.n++
+}
+
+// Contains reports whether addr may have been added, false means it surely wasn't.
+func (f *BloomFilter) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return false
+	}
+	a := addr.As4()
+	h1, h2, m := f.hash(binary.BigEndian.Uint32(a[:]))
+	for i := uint64(0); i < uint64(f.hashes); i++ {
+		if bit := (h1 + i*h2) % m; f.bits[bit>>6]&(1<<(bit&63)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// hash returns the two hashes of the double hashing of ip32 and the number of bits.
+func (f *BloomFilter) hash(ip32 uint32) (h1, h2, m uint64) {
+	h := hash32(ip32)
+	return h & math.MaxUint32, h>>32 | 1, uint64(len(f.bits)) * 64
+}
+
+// Count returns the number of addresses added to the filter.
+func (f *BloomFilter) Count() int64 {
+	return f.n
+}
+
+// WriteTo writes the filter in the format described on BloomFilter.
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	hash := crc32.NewIEEE()
+	bw := bufio.NewWriterSize(io.MultiWriter(counter, hash), 1<<20)
+	header := make([]byte, 24)
+	copy(header, bloomMagic)
+	header[6], header[7] = bloomVersion, f.hashes
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(f.bits))*64)
+	binary.LittleEndian.PutUint64(header[16:], uint64(f.n))
+	if _, err := bw.Write(header); err != nil {
+		return counter.n, err
+	}
+	if err := writeUint64s(bw, f.bits); err != nil {
+		return counter.n, err
+	}
+	if err := bw.Flush(); err != nil {
+		return counter.n, err
+	}
+	err := binary.Write(counter, binary.LittleEndian, hash.Sum32())
+	return counter.n, err
+}
+
+// writeUint64s writes words in little endian a buffer at a time.
+func writeUint64s(w io.Writer, words []uint64) error {
+	buf := make([]byte, 0, 8*exportBatch)
+	for len(words) > 0 {
+		chunk := words[:min(len(words), exportBatch)]
+		words = words[len(chunk):]
+		buf = buf[:0]
+		for _, word := range chunk {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadBloomFilter decodes a filter written by WriteTo.
+func ReadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	hash := crc32.NewIEEE()
+	br := io.TeeReader(bufio.NewReaderSize(r, 1<<20), hash)
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBloomCorrupted, err)
+	}
+	if string(header[:6]) != bloomMagic || header[6] != bloomVersion {
+		return nil, fmt.Errorf("%w: bad magic or version", ErrBloomCorrupted)
+	}
+	m, n := binary.LittleEndian.Uint64(header[8:]), binary.LittleEndian.Uint64(header[16:])
+	if m == 0 || m%64 != 0 || m > maxBloomBits || header[7] == 0 || header[7] > maxBloomHashes {
+		return nil, fmt.Errorf("%w: %d bits and %d hashes", ErrBloomCorrupted, m, header[7])
+	}
+	f := &BloomFilter{hashes: header[7], bits: make([]uint64, m/64), n: int64(n)}
+	buf := make([]byte, 8*exportBatch)
+	for i := 0; i < len(f.bits); {
+		chunk := buf[:8*min(len(f.bits)-i, exportBatch)]
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrBloomCorrupted, err)
+		}
+		for ; len(chunk) > 0; chunk, i = chunk[8:], i+1 {
+			f.bits[i] = binary.LittleEndian.Uint64(chunk)
+		}
+	}
+	sum := hash.Sum32()
+	var stored uint32
+	if err := binary.Read(br, binary.LittleEndian, &stored); err != nil || stored != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrBloomCorrupted)
+	}
+	return f, nil
+}
+
+// Bloom returns a Bloom filter of the addresses of the index sized for the false positive rate.
+func (x *Index) Bloom(falsePositiveRate float64) (*BloomFilter, error) {
+	f, err := NewBloomFilter(x.count, falsePositiveRate)
+	if err != nil {
+		return nil, err
+	}
+	x.each(func(ip32 uint32) bool {
+		f.add(ip32)
+		return true
+	})
+	return f, nil
+}
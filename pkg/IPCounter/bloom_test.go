@@ -0,0 +1,74 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBloomFilter(t *testing.T) {
+	var data strings.Builder
+	for i := uint32(0); i < 10000; i++ {
+		data.WriteString(addrFrom32(i*2654435761).String() + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "ips.idx")
+	if _, err := NewIPCounter(1, '\n').BuildIndex(context.Background(), path, writeTempFile(t, data.String())); err != nil {
+		t.Fatalf("BuildIndex() returned an error: %v", err)
+	}
+	x, err := OpenIndex(path)
+	if err != nil {
+		t.Fatalf("OpenIndex() returned an error: %v", err)
+	}
+	defer x.Close()
+	f, err := x.Bloom(0.01)
+	if err != nil {
+		t.Fatalf("Bloom() returned an error: %v", err)
+	}
+	var encoded bytes.Buffer
+	n, err := f.WriteTo(&encoded)
+	if err != nil || n != int64(encoded.Len()) {
+		t.Fatalf("WriteTo() = %d, %v; want %d bytes", n, err, encoded.Len())
+	}
+	loaded, err := ReadBloomFilter(&encoded)
+	if err != nil {
+		t.Fatalf("ReadBloomFilter() returned an error: %v", err)
+	}
+	if loaded.Count() != 10000 {
+		t.Errorf("Count() = %d; want 10000", loaded.Count())
+	}
+	falsePositives := 0
+	for i := uint32(0); i < 20000; i++ {
+		found := loaded.Contains(addrFrom32(i * 2654435761))
+		if i < 10000 && !found {
+			t.Fatalf("Contains(%s) = false for an added address", addrFrom32(i*2654435761))
+		}
+		if i >= 10000 && found {
+			falsePositives++
+		}
+	}
+	if falsePositives > 200 { //twice the 1% asked for
+		t.Errorf("%d false positives in 10000 lookups; want about 100", falsePositives)
+	}
+	if loaded.Contains(netip.MustParseAddr("2001:db8::1")) {
+		t.Errorf("Contains() of an IPv6 address = true")
+	}
+
+	if _, err = NewBloomFilter(10, 1); !errors.Is(err, ErrInvalidFalsePositiveRate) {
+		t.Errorf("NewBloomFilter() of rate 1 error = %v; want %v", err, ErrInvalidFalsePositiveRate)
+	}
+	f, _ = NewBloomFilter(10, 0.1)
+	f.Add(netip.MustParseAddr("1.1.1.1"))
+	encoded.Reset()
+	if _, err = f.WriteTo(&encoded); err != nil {
+		t.Fatalf("WriteTo() returned an error: %v", err)
+	}
+	damaged := encoded.Bytes()
+	damaged[len(damaged)-5] ^= 1
+	if _, err = ReadBloomFilter(bytes.NewReader(damaged)); !errors.Is(err, ErrBloomCorrupted) {
+		t.Errorf("ReadBloomFilter() of a damaged filter error = %v; want %v", err, ErrBloomCorrupted)
+	}
+}
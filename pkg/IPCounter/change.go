@@ -0,0 +1,65 @@
+package IPCounter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ChangeCheck selects what UniqueIP4 does when the input file changed while it was scanned.
+type ChangeCheck int
+
+const (
+	// ChangeCheckOff doesn't compare the file before and after the scan (default).
+	ChangeCheckOff ChangeCheck = iota
+	// ChangeCheckWarn returns the count and reports the change in Stats.InputChanged.
+	ChangeCheckWarn
+	// ChangeCheckFail returns an *InputChangedError instead of the count.
+	ChangeCheckFail
+)
+
+// ErrInputChanged matches every *InputChangedError with errors.Is.
+var ErrInputChanged = errors.New("input changed during scan")
+
+// InputChangedError describes how the input file differs after the scan from what it was before.
+type InputChangedError struct {
+	Path          string
+	SizeBefore    int64
+	SizeAfter     int64
+	ModTimeBefore time.Time
+	ModTimeAfter  time.Time
+	Replaced      bool // path now points to another file or to nothing, e.g. after a log rotation
+}
+
+func (e *InputChangedError) Error() string {
+	if e.Replaced {
+		return fmt.Sprintf("input changed during scan: %s was replaced", e.Path)
+	}
+	return fmt.Sprintf("input changed during scan: %s size %d -> %d, modified %s -> %s",
+		e.Path, e.SizeBefore, e.SizeAfter, e.ModTimeBefore.Format(time.RFC3339Nano), e.ModTimeAfter.Format(time.RFC3339Nano))
+}
+
+func (e *InputChangedError) Is(target error) bool {
+	return target == ErrInputChanged
+}
+
+// checkUnchanged compares the identity taken before the scan with the open file and with what path points to now.
+func checkUnchanged(path string, file *os.File, before fileIdentity) *InputChangedError {
+	changed := &InputChangedError{Path: path, SizeBefore: before.size, ModTimeBefore: before.modTime}
+	info, err := file.Stat()
+	if err != nil {
+		changed.Replaced = true
+		return changed
+	}
+	after := getFileIdentity(info)
+	changed.SizeAfter, changed.ModTimeAfter = after.size, after.modTime
+	if current, err := os.Stat(path); err != nil || !os.SameFile(info, current) {
+		changed.Replaced = true
+		return changed
+	}
+	if !after.equal(before) {
+		return changed
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckUnchanged(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n")
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open temp file: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("Failed to stat temp file: %v", err)
+	}
+	before := getFileIdentity(info)
+	if changed := checkUnchanged(path, file, before); changed != nil {
+		t.Fatalf("checkUnchanged() of untouched file = %v; want nil", changed)
+	}
+
+	if err := os.WriteFile(path, []byte("10.0.0.1\n10.0.0.2\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite temp file: %v", err)
+	}
+	changed := checkUnchanged(path, file, before)
+	if changed == nil || changed.Replaced || changed.SizeBefore != 9 || changed.SizeAfter != 18 {
+		t.Errorf("checkUnchanged() of appended file = %+v; want size 9 -> 18", changed)
+	}
+
+	replacement := writeTempFile(t, "10.0.0.1\n")
+	if err := os.Rename(replacement, path); err != nil {
+		t.Fatalf("Failed to replace temp file: %v", err)
+	}
+	if changed := checkUnchanged(path, file, before); changed == nil || !changed.Replaced {
+		t.Errorf("checkUnchanged() of replaced file = %+v; want Replaced", changed)
+	}
+	if !errors.Is(changed, ErrInputChanged) {
+		t.Errorf("errors.Is(%v, ErrInputChanged) = false", changed)
+	}
+}
+
+func TestUniqueIP4ChangeCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		check   ChangeCheck
+		wantErr bool
+	}{
+		{name: "Off", check: ChangeCheckOff, wantErr: false},
+		{name: "Warn", check: ChangeCheckWarn, wantErr: false},
+		{name: "Fail", check: ChangeCheckFail, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeTempFile(t, generateLargeFileData(20000, '\n'))
+			ipCounter := NewIPCounter(1, '\n', WithChangeCheck(tt.check), WithReadLimit(200000))
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				time.Sleep(100 * time.Millisecond)
+				file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Errorf("Failed to open temp file for append: %v", err)
+					return
+				}
+				defer file.Close()
+				if _, err := file.WriteString("10.0.0.1\n"); err != nil {
+					t.Errorf("Failed to append to temp file: %v", err)
+				}
+			}()
+			count, err := ipCounter.UniqueIP4(context.Background(), path)
+			<-done
+			if tt.wantErr {
+				if !errors.Is(err, ErrInputChanged) || count != 0 {
+					t.Errorf("UniqueIP4() = %d, %v; want 0, %v", count, err, ErrInputChanged)
+				}
+				return
+			}
+			if err != nil || count == 0 {
+				t.Fatalf("UniqueIP4() = %d, %v; want a count", count, err)
+			}
+			changed := ipCounter.GetStats().InputChanged
+			if (changed != nil) != (tt.check == ChangeCheckWarn) {
+				t.Errorf("GetStats().InputChanged = %v with check %d", changed, tt.check)
+			}
+		})
+	}
+}
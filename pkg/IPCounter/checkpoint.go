@@ -0,0 +1,292 @@
+package IPCounter
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	checkpointMagic   = "IPCCKPT"
+	checkpointVersion = 1
+)
+
+const (
+	checkpointSetNone byte = iota
+	checkpointSetBitmap
+	checkpointSetSorted
+)
+
+var (
+	// ErrCheckpointMismatch is returned on resume when the input file or the counter settings differ from the checkpoint.
+	ErrCheckpointMismatch = errors.New("checkpoint doesn't match the input file")
+	// ErrCheckpointCorrupted is returned on resume when the checkpoint file can't be decoded.
+	ErrCheckpointCorrupted = errors.New("checkpoint file is corrupted")
+)
+
+// checkpoint is the state of an interrupted scan.
+// A sequential scan is stored as a single chunk ending at the file size.
+type checkpoint struct {
+	identity    fileIdentity
+	lineBreak   byte
+	filters     uint64 //hash of the filter options, 0 without filters
+	sequential  bool
+	uniqueCount int64     //unique addresses in bitmap
+	positions   []int64   //end offset of every chunk, as returned by getPositions
+	progress    []int64   //offset every chunk is processed up to, positions[i] when it is complete
+	bitmap      ip4Bitmap //set of the parallel and the sequential readers of big files
+	ips         []uint32  //unsorted addresses of the sequential reader of small files
+}
+
+// chunkStart returns the offset chunk i starts at.
+func (cp *checkpoint) chunkStart(i int) int64 {
+	if i == 0 {
+		return 0
+	}
+	return cp.positions[i-1]
+}
+
+// saveCheckpoint writes the checkpoint atomically, so a crash never leaves half a checkpoint.
+func (ip *IPCounter) saveCheckpoint(cp *checkpoint) error {
+	err := writeFileAtomic(ip.checkpointPath, func(w io.Writer) error {
+		return encodeCheckpoint(w, cp)
+	})
+	if err != nil {
+		return err
+	}
+	ip.checkpoints++
+	return nil
+}
+
+// loadCheckpoint reads the checkpoint to resume from, it returns nil when there is no checkpoint yet.
+func (ip *IPCounter) loadCheckpoint(identity fileIdentity) (*checkpoint, error) {
+	file, err := os.Open(ip.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	cp, err := decodeCheckpoint(file)
+	if err != nil {
+		return nil, err
+	}
+	if !cp.identity.equal(identity) {
+		return nil, fmt.Errorf("%w: file changed since the checkpoint was written", ErrCheckpointMismatch)
+	}
+	if cp.lineBreak != ip.lineBreak {
+		return nil, fmt.Errorf("%w: line break %q, counter uses %q", ErrCheckpointMismatch, cp.lineBreak, ip.lineBreak)
+	}
+	if cp.filters != ip.filtersHash {
+		return nil, fmt.Errorf("%w: filters changed since the checkpoint was written", ErrCheckpointMismatch)
+	}
+	return cp, nil
+}
+
+// hashFilters returns a hash of the excluded categories with the registry they come from and of the include and
+// exclude lists, a checkpoint counted with other filters can't be resumed. It's 0 without filters.
+func (ip *IPCounter) hashFilters() uint64 {
+	if len(ip.excludeCategories) == 0 && len(ip.includeLists) == 0 && len(ip.excludeLists) == 0 {
+		return 0
+	}
+	h := fnv.New64a()
+	if len(ip.excludeCategories) > 0 {
+		categories := slices.Clone(ip.excludeCategories)
+		slices.Sort(categories)
+		fmt.Fprintf(h, "exclude categories %q\n", categories)
+		registry := ip.registry
+		if registry == nil {
+			registry = DefaultRegistry
+		}
+		for _, e := range registry {
+			fmt.Fprintf(h, "registry %s %s\n", e.Prefix, e.Category)
+		}
+	}
+	for _, list := range ip.includeLists {
+		fmt.Fprintf(h, "include %v\n", list.prefixes)
+	}
+	for _, list := range ip.excludeLists {
+		fmt.Fprintf(h, "exclude %v\n", list.prefixes)
+	}
+	return h.Sum64()
+}
+
+// removeCheckpoint deletes the checkpoint of a finished scan.
+func (ip *IPCounter) removeCheckpoint() error {
+	err := os.Remove(ip.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// periodicCheckpoint saves a checkpoint during the scan, a failure doesn't stop the scan and is reported in Stats.
+func (ip *IPCounter) periodicCheckpoint(cp *checkpoint) {
+	if err := ip.saveCheckpoint(cp); err != nil {
+		ip.checkpointErr = err
+		ip.log().Warn("checkpoint failed", slog.String("path", ip.checkpointPath), slog.Any("error", err))
+	}
+}
+
+// finalCheckpoint saves the state of a scan stopped by err so it can be resumed, and returns err.
+func (ip *IPCounter) finalCheckpoint(err error, cp *checkpoint) error {
+	if ip.checkpointPath == "" {
+		return err
+	}
+	if cpErr := ip.saveCheckpoint(cp); cpErr != nil {
+		ip.checkpointErr = cpErr
+		return errors.Join(err, cpErr)
+	}
+	ip.log().Info("checkpoint saved", slog.String("path", ip.checkpointPath), slog.Any("reason", err))
+	return err
+}
+
+// checkpointDue reports whether the periodic checkpoint interval has passed since the last one.
+func (ip *IPCounter) checkpointDue(last time.Time) bool {
+	return ip.checkpointPath != "" && ip.checkpointInterval > 0 && time.Since(last) >= ip.checkpointInterval
+}
+
+func encodeCheckpoint(w io.Writer, cp *checkpoint) error {
+	hash := crc32.NewIEEE()
+	bw := bufio.NewWriterSize(io.MultiWriter(w, hash), 1<<20)
+	header := []any{
+		[]byte(checkpointMagic), uint8(checkpointVersion),
+		cp.identity.size, cp.identity.modTime.UnixNano(), cp.identity.inode,
+		cp.lineBreak, cp.filters, cp.sequential, cp.uniqueCount, uint32(len(cp.positions)), cp.positions, cp.progress,
+	}
+	for _, v := range header {
+		if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	var err error
+	switch {
+	case cp.bitmap != nil:
+		if err = bw.WriteByte(checkpointSetBitmap); err == nil {
+			_, err = bw.Write(cp.bitmap)
+		}
+	case cp.ips != nil:
+		if err = bw.WriteByte(checkpointSetSorted); err == nil {
+			err = writeUint32s(bw, cp.ips)
+		}
+	default:
+		err = bw.WriteByte(checkpointSetNone)
+	}
+	if err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, hash.Sum32())
+}
+
+func decodeCheckpoint(r io.Reader) (*checkpoint, error) {
+	hash := crc32.NewIEEE()
+	br := io.TeeReader(bufio.NewReaderSize(r, 1<<20), hash)
+	var (
+		magic    [len(checkpointMagic)]byte
+		version  uint8
+		modTime  int64
+		chunks   uint32
+		setKind  byte
+		checksum uint32
+		cp       checkpoint
+	)
+	read := func(values ...any) error {
+		for _, v := range values {
+			if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := read(&magic, &version); err != nil || string(magic[:]) != checkpointMagic || version != checkpointVersion {
+		return nil, fmt.Errorf("%w: unknown format", ErrCheckpointCorrupted)
+	}
+	if err := read(&cp.identity.size, &modTime, &cp.identity.inode, &cp.lineBreak, &cp.filters, &cp.sequential, &cp.uniqueCount, &chunks); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCheckpointCorrupted, err)
+	}
+	if chunks == 0 || int64(chunks) > cp.identity.size+1 {
+		return nil, fmt.Errorf("%w: %d chunks", ErrCheckpointCorrupted, chunks)
+	}
+	cp.identity.modTime = time.Unix(0, modTime)
+	cp.positions = make([]int64, chunks)
+	cp.progress = make([]int64, chunks)
+	if err := read(cp.positions, cp.progress, &setKind); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCheckpointCorrupted, err)
+	}
+	var err error
+	switch setKind {
+	case checkpointSetBitmap:
+		cp.bitmap = newIP4Bitmap()
+		_, err = io.ReadFull(br, cp.bitmap)
+	case checkpointSetSorted:
+		cp.ips, err = readUint32s(br)
+	case checkpointSetNone:
+	default:
+		err = fmt.Errorf("unknown set kind %d", setKind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCheckpointCorrupted, err)
+	}
+	sum := hash.Sum32()
+	if err = read(&checksum); err != nil || checksum != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCheckpointCorrupted)
+	}
+	return &cp, nil
+}
+
+// writeUint32s writes the length and the values of ips in little endian.
+func writeUint32s(w io.Writer, ips []uint32) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(ips))); err != nil {
+		return err
+	}
+	buf := make([]byte, 0, 65536)
+	for i, v := range ips {
+		buf = binary.LittleEndian.AppendUint32(buf, v)
+		if len(buf) == cap(buf) || i == len(ips)-1 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	return nil
+}
+
+// readUint32s reads the values written by writeUint32s.
+func readUint32s(r io.Reader) ([]uint32, error) {
+	var length uint64
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	if length > 1<<32 {
+		return nil, fmt.Errorf("too many addresses: %d", length)
+	}
+	ips := make([]uint32, 0, min(length, 1<<20)) //length isn't trusted until the checksum is verified
+	buf := make([]byte, 65536)
+	for remaining := length * 4; remaining > 0; {
+		n := uint64(len(buf))
+		if remaining < n {
+			n = remaining
+		}
+		if _, err := io.ReadFull(r, buf[:n]); err != nil {
+			return nil, err
+		}
+		for i := uint64(0); i < n; i += 4 {
+			ips = append(ips, binary.LittleEndian.Uint32(buf[i:]))
+		}
+		remaining -= n
+	}
+	return ips, nil
+}
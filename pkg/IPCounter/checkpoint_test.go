@@ -0,0 +1,252 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTempFile creates a temporary file with data and returns its path.
+func writeTempFile(t *testing.T, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ips")
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("Failed to write data to temp file: %v", err)
+	}
+	return path
+}
+
+func TestCheckpointEncoding(t *testing.T) {
+	cp := &checkpoint{
+		identity:   fileIdentity{size: 1000, modTime: time.Unix(1700000000, 123), inode: 42},
+		lineBreak:  '\n',
+		filters:    0x5eed,
+		sequential: true,
+		positions:  []int64{1000},
+		progress:   []int64{480},
+		ips:        []uint32{3232235777, 167772161, 3232235777},
+	}
+	var buf bytes.Buffer
+	if err := encodeCheckpoint(&buf, cp); err != nil {
+		t.Fatalf("encodeCheckpoint() returned an error: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	got, err := decodeCheckpoint(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("decodeCheckpoint() returned an error: %v", err)
+	}
+	if !got.identity.equal(cp.identity) || got.lineBreak != cp.lineBreak || got.filters != cp.filters ||
+		got.sequential != cp.sequential {
+		t.Errorf("decodeCheckpoint() header = %+v; want %+v", got, cp)
+	}
+	if got.progress[0] != 480 || got.positions[0] != 1000 || len(got.ips) != 3 || got.ips[1] != 167772161 {
+		t.Errorf("decodeCheckpoint() state = %v %v %v", got.positions, got.progress, got.ips)
+	}
+
+	corrupted := append([]byte(nil), encoded...)
+	corrupted[len(corrupted)-6] ^= 0xff
+	if _, err := decodeCheckpoint(bytes.NewReader(corrupted)); !errors.Is(err, ErrCheckpointCorrupted) {
+		t.Errorf("decodeCheckpoint() of corrupted data error = %v; want %v", err, ErrCheckpointCorrupted)
+	}
+	if _, err := decodeCheckpoint(bytes.NewReader(encoded[:20])); !errors.Is(err, ErrCheckpointCorrupted) {
+		t.Errorf("decodeCheckpoint() of truncated data error = %v; want %v", err, ErrCheckpointCorrupted)
+	}
+}
+
+func TestCheckpointCancelAndResume(t *testing.T) {
+	path := writeTempFile(t, generateLargeFileData(30000, '\n')) //about 400kb
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+
+	// 100kb per second reads about a quarter of the file before the deadline
+	ipCounter := NewIPCounter(1, '\n', WithReadLimit(100000), WithCheckpoint(checkpointPath, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	if _, err := ipCounter.UniqueIP4(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UniqueIP4() error = %v; want %v", err, context.DeadlineExceeded)
+	}
+	if ipCounter.GetStats().Checkpoints != 1 {
+		t.Errorf("GetStats().Checkpoints = %d; want 1", ipCounter.GetStats().Checkpoints)
+	}
+	if _, err := os.Stat(checkpointPath); err != nil {
+		t.Fatalf("checkpoint wasn't written: %v", err)
+	}
+
+	resumed := NewIPCounter(1, '\n', WithCheckpoint(checkpointPath, 0), WithResume())
+	count, err := resumed.UniqueIP4(context.Background(), path)
+	if err != nil {
+		t.Fatalf("UniqueIP4() after resume returned an error: %v", err)
+	}
+	if count != 255 {
+		t.Errorf("UniqueIP4() after resume = %d; want 255", count)
+	}
+	if !resumed.GetStats().Resumed {
+		t.Errorf("GetStats().Resumed = false; want true")
+	}
+	if _, err := os.Stat(checkpointPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("checkpoint wasn't removed after the scan completed: %v", err)
+	}
+}
+
+func TestCheckpointResumeSkipsProcessedPart(t *testing.T) {
+	data := "10.0.0.1\n10.0.0.2\n10.0.0.3\n10.0.0.4\n"
+	path := writeTempFile(t, data)
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat temp file: %v", err)
+	}
+	// pretend the first two lines were read and held 1.1.1.1 twice
+	ipCounter := NewIPCounter(1, '\n', WithCheckpoint(checkpointPath, 0), WithResume())
+	cp := &checkpoint{
+		identity:   getFileIdentity(info),
+		lineBreak:  '\n',
+		sequential: true,
+		positions:  []int64{info.Size()},
+		progress:   []int64{18},
+		ips:        []uint32{16843009, 16843009},
+	}
+	if err := ipCounter.saveCheckpoint(cp); err != nil {
+		t.Fatalf("saveCheckpoint() returned an error: %v", err)
+	}
+	count, err := ipCounter.UniqueIP4(context.Background(), path)
+	if err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+	if count != 3 { //1.1.1.1, 10.0.0.3 and 10.0.0.4
+		t.Errorf("UniqueIP4() = %d; want 3", count)
+	}
+}
+
+func TestCheckpointResumeChangedFile(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n10.0.0.2\n")
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat temp file: %v", err)
+	}
+	ipCounter := NewIPCounter(1, '\n', WithCheckpoint(checkpointPath, 0), WithResume())
+	cp := &checkpoint{
+		identity:   getFileIdentity(info),
+		lineBreak:  '\n',
+		sequential: true,
+		positions:  []int64{info.Size()},
+		progress:   []int64{9},
+		ips:        []uint32{167772161},
+	}
+	if err := ipCounter.saveCheckpoint(cp); err != nil {
+		t.Fatalf("saveCheckpoint() returned an error: %v", err)
+	}
+	if err := os.WriteFile(path, []byte("10.0.0.1\n10.0.0.2\n10.0.0.3\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite temp file: %v", err)
+	}
+	if _, err := ipCounter.UniqueIP4(context.Background(), path); !errors.Is(err, ErrCheckpointMismatch) {
+		t.Errorf("UniqueIP4() error = %v; want %v", err, ErrCheckpointMismatch)
+	}
+}
+
+func TestCheckpointResumeChangedFilters(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n192.168.0.1\n8.8.8.8\n")
+	checkpointPath := filepath.Join(t.TempDir(), "scan.checkpoint")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat temp file: %v", err)
+	}
+	private := netip.MustParsePrefix("192.168.0.0/16")
+	tests := []struct {
+		name      string
+		saved     []Option
+		resumed   []Option
+		wantMatch bool
+	}{
+		{name: "No filters", wantMatch: true},
+		{name: "Same filters", saved: []Option{WithExcludeCategories(CategoryPrivate, CategoryLoopback)},
+			resumed: []Option{WithExcludeCategories(CategoryLoopback, CategoryPrivate)}, wantMatch: true},
+		{name: "Filter added", resumed: []Option{WithExcludeCIDRs("lan", private)}},
+		{name: "Filter removed", saved: []Option{WithIncludeCIDRs("lan", private)}},
+		{name: "Other categories", saved: []Option{WithExcludeCategories(CategoryPrivate)},
+			resumed: []Option{WithExcludeCategories(CategoryLoopback)}},
+		{name: "Other registry", saved: []Option{WithExcludeCategories(CategoryPrivate)},
+			resumed: []Option{WithExcludeCategories(CategoryPrivate),
+				WithRegistry([]RegistryEntry{{Prefix: private, Category: CategoryPrivate}})}},
+		{name: "Include became exclude", saved: []Option{WithIncludeCIDRs("lan", private)},
+			resumed: []Option{WithExcludeCIDRs("lan", private)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := NewIPCounter(1, '\n', append(tt.saved, WithCheckpoint(checkpointPath, 0))...)
+			if err := saved.prepareFilters(); err != nil {
+				t.Fatalf("prepareFilters() returned an error: %v", err)
+			}
+			cp := &checkpoint{
+				identity:   getFileIdentity(info),
+				lineBreak:  '\n',
+				filters:    saved.filtersHash,
+				sequential: true,
+				positions:  []int64{info.Size()},
+				progress:   []int64{9},
+				ips:        []uint32{167772161},
+			}
+			if err := saved.saveCheckpoint(cp); err != nil {
+				t.Fatalf("saveCheckpoint() returned an error: %v", err)
+			}
+			resumed := NewIPCounter(1, '\n', append(tt.resumed, WithCheckpoint(checkpointPath, 0), WithResume())...)
+			_, err := resumed.UniqueIP4(context.Background(), path)
+			if tt.wantMatch && err != nil {
+				t.Errorf("UniqueIP4() resumed with the same filters returned an error: %v", err)
+			}
+			if !tt.wantMatch && !errors.Is(err, ErrCheckpointMismatch) {
+				t.Errorf("UniqueIP4() resumed with other filters error = %v; want %v", err, ErrCheckpointMismatch)
+			}
+		})
+	}
+}
+
+func TestGoroutineReaderProgress(t *testing.T) {
+	data := generateLargeFileData(20000, '\n')
+	path := writeTempFile(t, data)
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open temp file: %v", err)
+	}
+	defer file.Close()
+
+	ipCounter := NewIPCounter(2, '\n')
+	ipCounter.file = file
+	ch := make(chan chunkMessage, 100000)
+	limit := int64(len(data))
+	if err := ipCounter.goroutineReader(context.Background(), 3, 0, limit, ch, maxLengthIp4); err != nil {
+		t.Fatalf("goroutineReader() returned an error: %v", err)
+	}
+	close(ch)
+	var (
+		lines    int
+		marks    int
+		previous int64
+	)
+	for msg := range ch {
+		if msg.chunk != 3 {
+			t.Fatalf("message of chunk %d; want 3", msg.chunk)
+		}
+		if msg.line != nil {
+			lines++
+			continue
+		}
+		marks++
+		if msg.offset <= previous || data[msg.offset-1] != '\n' {
+			t.Fatalf("progress mark %d isn't after a line break following %d", msg.offset, previous)
+		}
+		if consumed := int64(bytes.Count([]byte(data[:msg.offset]), []byte{'\n'})); consumed != int64(lines) {
+			t.Fatalf("progress mark %d covers %d lines; %d were sent", msg.offset, consumed, lines)
+		}
+		previous = msg.offset
+	}
+	if previous != limit || lines != 20000 || marks < 2 {
+		t.Errorf("last mark = %d, lines = %d, marks = %d; want %d, 20000, more than 1", previous, lines, marks, limit)
+	}
+}
@@ -0,0 +1,210 @@
+package IPCounter
+
+import (
+	"context"
+	"math/bits"
+	"net/netip"
+	"sort"
+)
+
+// CIDRCover is a list of CIDR blocks covering the unique addresses of a file.
+type CIDRCover struct {
+	Prefixes []netip.Prefix // ascending and disjoint
+	Ranges   []AddrRange    // the same addresses as Prefixes, adjacent blocks joined
+	Unique   int64          // unique addresses of the file, all of them are covered
+	Extra    int64          // covered addresses that aren't in the file, 0 for an exact cover
+}
+
+// AddrRange is the range of addresses from First to Last, both included.
+type AddrRange struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// cidrBlock is a CIDR block of the aggregation, addr has no bits set after the prefix.
+type cidrBlock struct {
+	addr uint32
+	bits int
+}
+
+func (b cidrBlock) size() int64 {
+	return 1 << (32 - b.bits)
+}
+
+func (b cidrBlock) last() uint32 {
+	return b.addr + uint32(b.size()-1)
+}
+
+// AggregateCIDR counts the unique IPv4 addresses of path like UniqueIP4 and collapses them into the smallest list of CIDR blocks
+// that covers exactly them. With maxPrefixes > 0 and a bigger exact cover, it returns a lossy cover of at most maxPrefixes blocks
+// that includes the fewest addresses outside the file, CIDRCover.Extra reports how many.
+func (ip *IPCounter) AggregateCIDR(ctx context.Context, path string, maxPrefixes int) (*CIDRCover, error) {
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	if _, err := ip.UniqueIP4(ctx, path); err != nil {
+		return nil, err
+	}
+	return aggregateSet(ctx, ip.set, maxPrefixes)
+}
+
+// aggregateSet returns the minimal exact cover of set, or the best lossy cover of at most maxPrefixes blocks.
+func aggregateSet(ctx context.Context, set ip4Set, maxPrefixes int) (*CIDRCover, error) {
+	blocks, err := exactCIDRBlocks(ctx, set)
+	if err != nil {
+		return nil, err
+	}
+	cover := &CIDRCover{Unique: set.count()}
+	if maxPrefixes > 0 && len(blocks) > maxPrefixes {
+		root, err := buildCIDRTrie(ctx, blocks, maxPrefixes)
+		if err != nil {
+			return nil, err
+		}
+		k := 1
+		for i := 2; i <= len(root.cost); i++ {
+			if root.cost[i-1] < root.cost[k-1] {
+				k = i
+			}
+		}
+		cover.Extra = root.cost[k-1]
+		blocks = root.choose(k, blocks[:0])
+	}
+	cover.Prefixes = make([]netip.Prefix, len(blocks))
+	for i, b := range blocks {
+		cover.Prefixes[i] = netip.PrefixFrom(addrFrom32(b.addr), b.bits)
+		first, last := b.addr, b.last()
+		if n := len(cover.Ranges); n > 0 && cover.Ranges[n-1].Last.Next() == addrFrom32(first) {
+			cover.Ranges[n-1].Last = addrFrom32(last)
+			continue
+		}
+		cover.Ranges = append(cover.Ranges, AddrRange{First: addrFrom32(first), Last: addrFrom32(last)})
+	}
+	return cover, nil
+}
+
+// exactCIDRBlocks splits every run of consecutive addresses of set into the fewest aligned blocks.
+func exactCIDRBlocks(ctx context.Context, set ip4Set) ([]cidrBlock, error) {
+	var (
+		blocks      []cidrBlock
+		first, last uint32
+		started     bool
+		seen        int64
+		err         error
+	)
+	set.each(func(ip32 uint32) bool {
+		if seen++; seen%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		if started && ip32 == last+1 {
+			last = ip32
+			return true
+		}
+		if started {
+			blocks = appendRangeBlocks(blocks, first, last)
+		}
+		first, last, started = ip32, ip32, true
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if started {
+		blocks = appendRangeBlocks(blocks, first, last)
+	}
+	return blocks, nil
+}
+
+// appendRangeBlocks appends the fewest CIDR blocks covering exactly first..last.
+func appendRangeBlocks(blocks []cidrBlock, first uint32, last uint32) []cidrBlock {
+	for {
+		prefix := 32 - bits.TrailingZeros32(first) //the biggest block aligned at first
+		for uint64(first)+uint64(1)<<(32-prefix)-1 > uint64(last) {
+			prefix++
+		}
+		block := cidrBlock{addr: first, bits: prefix}
+		blocks = append(blocks, block)
+		if block.last() == last {
+			return blocks
+		}
+		first = block.last() + 1
+	}
+}
+
+// cidrNode is a node of the binary trie of the exact blocks, only branching nodes are kept.
+// cost[k-1] is the fewest extra addresses covering the blocks under the node with exactly k blocks,
+// split[k-1] is how many of those k blocks go to the left child.
+type cidrNode struct {
+	block       cidrBlock
+	left, right *cidrNode
+	cost        []int64
+	split       []int32
+}
+
+// buildCIDRTrie builds the trie of blocks (ascending, disjoint) and solves the lossy cover of up to maxPrefixes blocks for every node.
+// The trie is at most 32 branching nodes deep, which bounds the size of the tables.
+func buildCIDRTrie(ctx context.Context, blocks []cidrBlock, maxPrefixes int) (*cidrNode, error) {
+	if len(blocks) == 1 {
+		return &cidrNode{block: blocks[0], cost: []int64{0}}, nil
+	}
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	first, last := blocks[0].addr, blocks[len(blocks)-1].addr
+	common := bits.LeadingZeros32(first ^ last)
+	node := &cidrNode{block: cidrBlock{addr: first &^ (1<<(32-common) - 1), bits: common}}
+	branch := uint32(1) << (31 - common)
+	mid := sort.Search(len(blocks), func(i int) bool {
+		return blocks[i].addr&branch != 0
+	})
+	var err error
+	if node.left, err = buildCIDRTrie(ctx, blocks[:mid], maxPrefixes); err != nil {
+		return nil, err
+	}
+	if node.right, err = buildCIDRTrie(ctx, blocks[mid:], maxPrefixes); err != nil {
+		return nil, err
+	}
+	left, right := node.left.cost, node.right.cost
+	size := min(len(left)+len(right), maxPrefixes)
+	node.cost = make([]int64, size)
+	node.split = make([]int32, size)
+	var covered int64
+	for _, b := range blocks {
+		covered += b.size()
+	}
+	node.cost[0] = node.block.size() - covered //one block, the node itself
+	for k := 2; k <= size; k++ {
+		best, bestSplit := int64(-1), 0
+		for i := max(1, k-len(right)); i <= min(k-1, len(left)); i++ {
+			if cost := left[i-1] + right[k-i-1]; best < 0 || cost < best {
+				best, bestSplit = cost, i
+			}
+		}
+		node.cost[k-1], node.split[k-1] = best, int32(bestSplit)
+	}
+	if node.left.left != nil {
+		node.left.cost = nil //only the splits are needed to pick the blocks
+	}
+	if node.right.left != nil {
+		node.right.cost = nil
+	}
+	return node, nil
+}
+
+// choose appends the k blocks of the best cover under the node.
+func (n *cidrNode) choose(k int, blocks []cidrBlock) []cidrBlock {
+	if k == 1 {
+		return append(blocks, n.block)
+	}
+	i := int(n.split[k-1])
+	blocks = n.left.choose(i, blocks)
+	return n.right.choose(k-i, blocks)
+}
+
+// addrFrom32 returns ip32 as an address.
+func addrFrom32(ip32 uint32) netip.Addr {
+	return netip.AddrFrom4([4]byte{byte(ip32 >> 24), byte(ip32 >> 16), byte(ip32 >> 8), byte(ip32)})
+}
@@ -0,0 +1,153 @@
+package IPCounter
+
+import (
+	"context"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"testing"
+)
+
+// setOf returns the sorted set of the dotted addresses.
+func setOf(t *testing.T, addrs ...string) ip4Set {
+	t.Helper()
+	ips := make([]uint32, 0, len(addrs))
+	for _, addr := range addrs {
+		ip32, err := ip4BytesToUint32([]byte(addr))
+		if err != nil {
+			t.Fatalf("ip4BytesToUint32(%s) returned an error: %v", addr, err)
+		}
+		ips = append(ips, ip32)
+	}
+	return newSortedSet(ips)
+}
+
+func TestAggregateSet(t *testing.T) {
+	tests := []struct {
+		name        string
+		addrs       []string
+		maxPrefixes int
+		want        []string
+		wantRanges  int
+		wantExtra   int64
+	}{
+		{name: "Single address", addrs: []string{"10.0.0.1"}, want: []string{"10.0.0.1/32"}, wantRanges: 1},
+		{
+			name:       "Aligned block",
+			addrs:      []string{"10.0.0.0", "10.0.0.1", "10.0.0.2", "10.0.0.3"},
+			want:       []string{"10.0.0.0/30"},
+			wantRanges: 1,
+		},
+		{
+			name:       "Unaligned run",
+			addrs:      []string{"10.0.0.1", "10.0.0.2", "10.0.0.3", "10.0.0.4"},
+			want:       []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/32"},
+			wantRanges: 1,
+		},
+		{
+			name:       "Edges of the address space",
+			addrs:      []string{"0.0.0.0", "255.255.255.254", "255.255.255.255"},
+			want:       []string{"0.0.0.0/32", "255.255.255.254/31"},
+			wantRanges: 2,
+		},
+		{
+			name:        "Lossy cover",
+			addrs:       []string{"10.0.0.1", "10.0.0.3", "10.0.0.200"},
+			maxPrefixes: 2,
+			want:        []string{"10.0.0.0/30", "10.0.0.200/32"},
+			wantRanges:  2,
+			wantExtra:   2,
+		},
+		{
+			name:        "Lossy cover of one prefix",
+			addrs:       []string{"10.0.0.1", "10.0.0.3", "10.0.0.200"},
+			maxPrefixes: 1,
+			want:        []string{"10.0.0.0/24"},
+			wantRanges:  1,
+			wantExtra:   253,
+		},
+		{
+			name:        "Exact cover within the limit",
+			addrs:       []string{"10.0.0.1", "192.168.0.1"},
+			maxPrefixes: 5,
+			want:        []string{"10.0.0.1/32", "192.168.0.1/32"},
+			wantRanges:  2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cover, err := aggregateSet(context.Background(), setOf(t, tt.addrs...), tt.maxPrefixes)
+			if err != nil {
+				t.Fatalf("aggregateSet() returned an error: %v", err)
+			}
+			got := make([]string, len(cover.Prefixes))
+			for i, prefix := range cover.Prefixes {
+				got[i] = prefix.String()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("aggregateSet() prefixes = %v; want %v", got, tt.want)
+			}
+			if len(cover.Ranges) != tt.wantRanges || cover.Extra != tt.wantExtra || cover.Unique != int64(len(tt.addrs)) {
+				t.Errorf("aggregateSet() = %d ranges, extra %d, unique %d; want %d, %d, %d",
+					len(cover.Ranges), cover.Extra, cover.Unique, tt.wantRanges, tt.wantExtra, len(tt.addrs))
+			}
+		})
+	}
+}
+
+func TestAggregateSetLossyCoversAll(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	set := newRoaringSet()
+	for i := 0; i < 5000; i++ {
+		set.add(random.Uint32() >> 12 << 4) //clustered in a small part of the space
+	}
+	exact, err := aggregateSet(context.Background(), set, 0)
+	if err != nil {
+		t.Fatalf("aggregateSet() returned an error: %v", err)
+	}
+	var previousExtra int64 = -1
+	for _, maxPrefixes := range []int{1000, 100, 10, 1} {
+		cover, err := aggregateSet(context.Background(), set, maxPrefixes)
+		if err != nil {
+			t.Fatalf("aggregateSet(%d) returned an error: %v", maxPrefixes, err)
+		}
+		if len(cover.Prefixes) > maxPrefixes || len(cover.Prefixes) >= len(exact.Prefixes) {
+			t.Errorf("aggregateSet(%d) returned %d prefixes", maxPrefixes, len(cover.Prefixes))
+		}
+		var size int64
+		for i, prefix := range cover.Prefixes {
+			size += int64(1) << (32 - prefix.Bits())
+			if i > 0 && cover.Prefixes[i-1].Overlaps(prefix) {
+				t.Fatalf("prefixes %s and %s overlap", cover.Prefixes[i-1], prefix)
+			}
+		}
+		if size-cover.Unique != cover.Extra || cover.Extra < previousExtra {
+			t.Errorf("aggregateSet(%d) extra = %d, covers %d; fewer prefixes must not cover less", maxPrefixes, cover.Extra, size)
+		}
+		previousExtra = cover.Extra
+		set.each(func(ip32 uint32) bool {
+			addr := addrFrom32(ip32)
+			for _, prefix := range cover.Prefixes {
+				if prefix.Contains(addr) {
+					return true
+				}
+			}
+			t.Fatalf("aggregateSet(%d) doesn't cover %s", maxPrefixes, addr)
+			return false
+		})
+	}
+	if want := netip.MustParsePrefix("0.0.0.0/0"); len(exact.Prefixes) == 0 || exact.Extra != 0 || exact.Prefixes[0] == want {
+		t.Errorf("exact cover = %d prefixes, extra %d", len(exact.Prefixes), exact.Extra)
+	}
+}
+
+func TestAggregateCIDR(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.3\n10.0.0.2\n10.0.0.1\n10.0.0.0\ninvalid\n10.0.0.2\n")
+	cover, err := NewIPCounter(1, '\n').AggregateCIDR(context.Background(), path, 0)
+	if err != nil {
+		t.Fatalf("AggregateCIDR() returned an error: %v", err)
+	}
+	if len(cover.Prefixes) != 1 || cover.Prefixes[0].String() != "10.0.0.0/30" || cover.Unique != 4 {
+		t.Errorf("AggregateCIDR() = %+v; want 10.0.0.0/30", cover)
+	}
+}
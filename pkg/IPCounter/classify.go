@@ -0,0 +1,247 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+)
+
+// Categories of the default registry, CategoryPublic is every address that no registry prefix contains.
+const (
+	CategoryPrivate       = "private"
+	CategoryLoopback      = "loopback"
+	CategoryLinkLocal     = "link-local"
+	CategoryCGNAT         = "cgnat"
+	CategoryMulticast     = "multicast"
+	CategoryDocumentation = "documentation"
+	CategoryReserved      = "reserved"
+	CategoryBroadcast     = "broadcast"
+	CategoryPublic        = "public"
+)
+
+var (
+	// ErrUnknownCategory is returned when a category to exclude isn't in the registry.
+	ErrUnknownCategory = errors.New("unknown address category")
+	// ErrInvalidRegistry is returned by ParseRegistry for a line it can't parse.
+	ErrInvalidRegistry = errors.New("invalid registry")
+)
+
+// RegistryEntry assigns a category to the addresses of a prefix, the most specific prefix of the registry wins.
+type RegistryEntry struct {
+	Prefix   netip.Prefix
+	Category string
+}
+
+// DefaultRegistry is the IANA IPv4 Special-Purpose Address Registry, with multicast and broadcast, grouped into categories.
+// The smaller blocks of 192.0.0.0/24 (e.g. 192.0.0.9/32 of PCP anycast) are part of its entry.
+var DefaultRegistry = []RegistryEntry{
+	{Prefix: netip.MustParsePrefix("0.0.0.0/8"), Category: CategoryReserved},            //this network, RFC 791
+	{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Category: CategoryPrivate},            //RFC 1918
+	{Prefix: netip.MustParsePrefix("100.64.0.0/10"), Category: CategoryCGNAT},           //shared address space, RFC 6598
+	{Prefix: netip.MustParsePrefix("127.0.0.0/8"), Category: CategoryLoopback},          //RFC 1122
+	{Prefix: netip.MustParsePrefix("169.254.0.0/16"), Category: CategoryLinkLocal},      //RFC 3927
+	{Prefix: netip.MustParsePrefix("172.16.0.0/12"), Category: CategoryPrivate},         //RFC 1918
+	{Prefix: netip.MustParsePrefix("192.0.0.0/24"), Category: CategoryReserved},         //IETF protocol assignments, RFC 6890
+	{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Category: CategoryDocumentation},    //TEST-NET-1, RFC 5737
+	{Prefix: netip.MustParsePrefix("192.31.196.0/24"), Category: CategoryReserved},      //AS112-v4, RFC 7535
+	{Prefix: netip.MustParsePrefix("192.52.193.0/24"), Category: CategoryReserved},      //AMT, RFC 7450
+	{Prefix: netip.MustParsePrefix("192.88.99.0/24"), Category: CategoryReserved},       //deprecated 6to4 relay anycast, RFC 7526
+	{Prefix: netip.MustParsePrefix("192.168.0.0/16"), Category: CategoryPrivate},        //RFC 1918
+	{Prefix: netip.MustParsePrefix("192.175.48.0/24"), Category: CategoryReserved},      //direct delegation AS112 service, RFC 7534
+	{Prefix: netip.MustParsePrefix("198.18.0.0/15"), Category: CategoryReserved},        //benchmarking, RFC 2544
+	{Prefix: netip.MustParsePrefix("198.51.100.0/24"), Category: CategoryDocumentation}, //TEST-NET-2, RFC 5737
+	{Prefix: netip.MustParsePrefix("203.0.113.0/24"), Category: CategoryDocumentation},  //TEST-NET-3, RFC 5737
+	{Prefix: netip.MustParsePrefix("224.0.0.0/4"), Category: CategoryMulticast},         //RFC 5771
+	{Prefix: netip.MustParsePrefix("240.0.0.0/4"), Category: CategoryReserved},          //future use, RFC 1112
+	{Prefix: netip.MustParsePrefix("255.255.255.255/32"), Category: CategoryBroadcast},  //limited broadcast, RFC 919
+}
+
+// ParseRegistry reads a registry of "prefix category" lines, blank lines and # comments are skipped.
+func ParseRegistry(r io.Reader) ([]RegistryEntry, error) {
+	var entries []RegistryEntry
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: line %d: want a prefix and a category", ErrInvalidRegistry, line)
+		}
+		prefix, err := parseIP4Prefix(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidRegistry, line, err)
+		}
+		entries = append(entries, RegistryEntry{Prefix: prefix, Category: fields[1]})
+	}
+	return entries, scanner.Err()
+}
+
+// parseIP4Prefix parses an IPv4 prefix or a single address, host bits are cleared.
+func parseIP4Prefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		s += "/32"
+	}
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	if !prefix.Addr().Is4() {
+		return netip.Prefix{}, fmt.Errorf("%s isn't an IPv4 prefix", s)
+	}
+	return prefix.Masked(), nil
+}
+
+// blockOf returns prefix as a block of the prefix table.
+func blockOf(prefix netip.Prefix) cidrBlock {
+	a := prefix.Addr().As4()
+	return cidrBlock{addr: uint32(a[0])<<24 | uint32(a[1])<<16 | uint32(a[2])<<8 | uint32(a[3]), bits: prefix.Bits()}
+}
+
+// classifier assigns the categories of a registry to addresses.
+type classifier struct {
+	table      *prefixTable
+	categories []string //by the values of the table
+	public     int      //value of CategoryPublic, the addresses of no prefix
+}
+
+func newClassifier(registry []RegistryEntry) *classifier {
+	c := &classifier{}
+	values := map[string]int{}
+	entries := make([]prefixEntry, 0, len(registry))
+	for _, e := range registry {
+		value, ok := values[e.Category]
+		if !ok {
+			value = len(c.categories)
+			values[e.Category] = value
+			c.categories = append(c.categories, e.Category)
+		}
+		entries = append(entries, prefixEntry{block: blockOf(e.Prefix), value: value})
+	}
+	var ok bool
+	if c.public, ok = values[CategoryPublic]; !ok {
+		c.public = len(c.categories)
+		c.categories = append(c.categories, CategoryPublic)
+	}
+	c.table = newPrefixTable(entries)
+	return c
+}
+
+// category returns the value of the category of ip32.
+func (c *classifier) category(ip32 uint32) int {
+	if value, ok := c.table.lookup(ip32); ok {
+		return value
+	}
+	return c.public
+}
+
+// excludeFilter returns the filter rejecting the addresses of categories.
+func (c *classifier) excludeFilter(categories []string) (*addrFilter, error) {
+	f := &addrFilter{table: c.table, rules: make([]filterRule, len(c.categories)), fallback: c.public}
+	for i, name := range c.categories {
+		f.rules[i].name = name
+	}
+	for _, name := range categories {
+		found := false
+		for i := range f.rules {
+			if f.rules[i].name == name {
+				f.rules[i].reject, found = true, true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCategory, name)
+		}
+	}
+	return f, nil
+}
+
+// Classification splits the unique addresses of a file by category.
+type Classification struct {
+	Unique     int64            // unique addresses of the main count, without the excluded categories
+	Excluded   int64            // unique addresses of the excluded categories
+	ByCategory map[string]int64 // unique addresses of every category, excluded ones included
+}
+
+// Classify counts the unique IPv4 addresses of path like UniqueIP4 and splits them into the categories of the registry
+// (DefaultRegistry unless WithRegistry is used). Categories excluded with WithExcludeCategories are left out of Unique,
+// and still reported in ByCategory.
+func (ip *IPCounter) Classify(ctx context.Context, path string) (*Classification, error) {
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	unique, err := ip.UniqueIP4(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	c := ip.getClassifier()
+	counts := make([]int64, len(c.categories))
+	var seen int64
+	ip.set.each(func(ip32 uint32) bool {
+		if seen++; seen%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		counts[c.category(ip32)]++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := &Classification{Unique: unique, ByCategory: make(map[string]int64, len(counts))}
+	for i, name := range c.categories {
+		result.ByCategory[name] += counts[i]
+	}
+	if ip.categoryFilter != nil {
+		for _, rule := range ip.categoryFilter.rules {
+			if rule.reject {
+				result.ByCategory[rule.name] += rule.rejected.count()
+				result.Excluded += rule.rejected.count()
+			}
+		}
+	}
+	return result, nil
+}
+
+// getClassifier returns the classifier of the registry of the counter.
+func (ip *IPCounter) getClassifier() *classifier {
+	if ip.classifier == nil {
+		registry := ip.registry
+		if registry == nil {
+			registry = DefaultRegistry
+		}
+		ip.classifier = newClassifier(registry)
+	}
+	return ip.classifier
+}
+
+// prepareFilters builds the filters of the options before the first scan.
+func (ip *IPCounter) prepareFilters() error {
+	if ip.filtersReady {
+		return nil
+	}
+	if len(ip.excludeCategories) > 0 {
+		f, err := ip.getClassifier().excludeFilter(ip.excludeCategories)
+		if err != nil {
+			return err
+		}
+		ip.categoryFilter = f
+		ip.filters = append(ip.filters, f)
+	}
+	if len(ip.includeLists) > 0 {
+		ip.filters = append(ip.filters, includeFilter(ip.includeLists))
+	}
+	if len(ip.excludeLists) > 0 {
+		ip.filters = append(ip.filters, excludeFilter(ip.excludeLists))
+	}
+	ip.filtersHash = ip.hashFilters()
+	ip.filtersReady = true
+	return nil
+}
@@ -0,0 +1,99 @@
+package IPCounter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	path := writeTempFile(t, strings.Join([]string{
+		"10.0.0.1", "10.0.0.1", "172.16.5.4", "192.168.1.1", "127.0.0.1", "169.254.1.1", "100.64.0.1",
+		"224.0.0.1", "192.0.2.1", "198.51.100.7", "240.0.0.1", "0.0.0.0", "255.255.255.255",
+		"8.8.8.8", "1.1.1.1", "100.128.0.1", "172.32.0.1",
+	}, "\n")+"\n")
+	tests := []struct {
+		name         string
+		exclude      []string
+		wantUnique   int64
+		wantExcluded int64
+	}{
+		{name: "Nothing excluded", wantUnique: 16},
+		{name: "Private and reserved excluded", exclude: []string{CategoryPrivate, CategoryReserved}, wantUnique: 11, wantExcluded: 5},
+		{name: "Public excluded", exclude: []string{CategoryPublic}, wantUnique: 12, wantExcluded: 4},
+	}
+	wantByCategory := map[string]int64{
+		CategoryPrivate: 3, CategoryLoopback: 1, CategoryLinkLocal: 1, CategoryCGNAT: 1, CategoryMulticast: 1,
+		CategoryDocumentation: 2, CategoryReserved: 2, CategoryBroadcast: 1, CategoryPublic: 4,
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipCounter := NewIPCounter(1, '\n', WithExcludeCategories(tt.exclude...))
+			got, err := ipCounter.Classify(context.Background(), path)
+			if err != nil {
+				t.Fatalf("Classify() returned an error: %v", err)
+			}
+			if got.Unique != tt.wantUnique || got.Excluded != tt.wantExcluded || !reflect.DeepEqual(got.ByCategory, wantByCategory) {
+				t.Errorf("Classify() = %+v; want unique %d, excluded %d, %v", got, tt.wantUnique, tt.wantExcluded, wantByCategory)
+			}
+			if len(tt.exclude) > 0 && ipCounter.GetStats().Rejected[tt.exclude[0]] != wantByCategory[tt.exclude[0]] {
+				t.Errorf("GetStats().Rejected = %v", ipCounter.GetStats().Rejected)
+			}
+			count, err := ipCounter.UniqueIP4(context.Background(), path)
+			if err != nil || count != tt.wantUnique {
+				t.Errorf("UniqueIP4() = %d, %v; want %d", count, err, tt.wantUnique)
+			}
+		})
+	}
+}
+
+func TestClassifyCustomRegistry(t *testing.T) {
+	registry, err := ParseRegistry(strings.NewReader("# office ranges\n10.20.0.0/16 office\n10.20.30.0/24 lab # more specific\n8.8.8.8 public\n"))
+	if err != nil {
+		t.Fatalf("ParseRegistry() returned an error: %v", err)
+	}
+	path := writeTempFile(t, "10.20.1.1\n10.20.30.1\n8.8.8.8\n9.9.9.9\n")
+	got, err := NewIPCounter(1, '\n', WithRegistry(registry)).Classify(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Classify() returned an error: %v", err)
+	}
+	want := map[string]int64{"office": 1, "lab": 1, CategoryPublic: 2}
+	if !reflect.DeepEqual(got.ByCategory, want) {
+		t.Errorf("Classify().ByCategory = %v; want %v", got.ByCategory, want)
+	}
+
+	if _, err = ParseRegistry(strings.NewReader("10.0.0.0/33 private\n")); !errors.Is(err, ErrInvalidRegistry) {
+		t.Errorf("ParseRegistry() error = %v; want %v", err, ErrInvalidRegistry)
+	}
+	if _, err = NewIPCounter(1, '\n', WithExcludeCategories("bogus")).UniqueIP4(context.Background(), path); !errors.Is(err, ErrUnknownCategory) {
+		t.Errorf("UniqueIP4() error = %v; want %v", err, ErrUnknownCategory)
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	c := newClassifier(DefaultRegistry)
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "192.0.0.9", want: CategoryReserved},
+		{addr: "192.31.196.1", want: CategoryReserved},
+		{addr: "192.52.193.1", want: CategoryReserved},
+		{addr: "192.88.99.1", want: CategoryReserved},
+		{addr: "192.175.48.6", want: CategoryReserved},
+		{addr: "198.51.100.7", want: CategoryDocumentation},
+		{addr: "203.0.113.255", want: CategoryDocumentation},
+		{addr: "192.31.197.1", want: CategoryPublic},
+		{addr: "192.175.49.1", want: CategoryPublic},
+	}
+	for _, tt := range tests {
+		a := netip.MustParseAddr(tt.addr).As4()
+		if got := c.categories[c.category(binary.BigEndian.Uint32(a[:]))]; got != tt.want {
+			t.Errorf("category of %s = %s; want %s", tt.addr, got, tt.want)
+		}
+	}
+}
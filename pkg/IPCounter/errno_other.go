@@ -0,0 +1,12 @@
+//go:build !linux && !plan9
+
+package IPCounter
+
+import (
+	"errors"
+	"syscall"
+)
+
+func isTransientErrno(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN)
+}
@@ -0,0 +1,11 @@
+package IPCounter
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isTransientErrno only matches EINTR, plan9 has no EAGAIN.
+func isTransientErrno(err error) bool {
+	return errors.Is(err, syscall.EINTR)
+}
@@ -0,0 +1,14 @@
+//go:build !plan9
+
+package IPCounter
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestClassifyReadErrorEAGAIN(t *testing.T) {
+	if err := classifyReadError(syscall.EAGAIN, false); !IsTransient(err) {
+		t.Errorf("classifyReadError(%v) isn't transient", syscall.EAGAIN)
+	}
+}
@@ -0,0 +1,130 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is the format ExportUniqueIP4 writes the addresses in.
+type ExportFormat int
+
+const (
+	// ExportText writes one dotted address per line.
+	ExportText ExportFormat = iota
+	// ExportJSONLines writes one {"ip":"a.b.c.d"} object per line.
+	ExportJSONLines
+	// ExportCSV writes an ip header and one address per row.
+	ExportCSV
+	// ExportBinary writes every address as 4 bytes in network byte order, without separators.
+	ExportBinary
+)
+
+// exportBatch is the number of addresses written between context checks.
+const exportBatch = 65536
+
+// ErrUnknownExportFormat is returned by ParseExportFormat for a name it doesn't know.
+var ErrUnknownExportFormat = errors.New("unknown export format")
+
+var exportFormatNames = [...]string{ExportText: "text", ExportJSONLines: "jsonl", ExportCSV: "csv", ExportBinary: "binary"}
+
+func (f ExportFormat) String() string {
+	if f >= 0 && int(f) < len(exportFormatNames) {
+		return exportFormatNames[f]
+	}
+	return fmt.Sprintf("ExportFormat(%d)", int(f))
+}
+
+// ParseExportFormat returns the format named text, jsonl (or json), csv or binary.
+func ParseExportFormat(name string) (ExportFormat, error) {
+	name = strings.ToLower(name)
+	if name == "json" {
+		return ExportJSONLines, nil
+	}
+	for f, formatName := range exportFormatNames {
+		if name == formatName {
+			return ExportFormat(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownExportFormat, name)
+}
+
+// ExportUniqueIP4 counts the unique IPv4 addresses of path like UniqueIP4 and writes every one of them
+// to w in ascending order. The addresses are streamed from the set the scan built, the dense bitmap
+// or the sorted slice of the sequential reader, without a second copy. It returns the unique count.
+func (ip *IPCounter) ExportUniqueIP4(ctx context.Context, path string, w io.Writer, format ExportFormat) (int64, error) {
+	if format < 0 || int(format) >= len(exportFormatNames) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownExportFormat, format)
+	}
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	count, err := ip.UniqueIP4(ctx, path)
+	if err != nil {
+		return count, err
+	}
+	if _, err = writeSet(ctx, w, ip.set, format); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// writeSet writes the addresses of set in ascending order and returns how many were written.
+func writeSet(ctx context.Context, w io.Writer, set ip4Seq, format ExportFormat) (int64, error) {
+	bw := bufio.NewWriterSize(w, 1<<20)
+	var (
+		written int64
+		err     error
+		buf     = make([]byte, 0, 32)
+	)
+	if format == ExportCSV {
+		if _, err = bw.WriteString("ip\n"); err != nil {
+			return 0, err
+		}
+	}
+	set.each(func(ip32 uint32) bool {
+		if written%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		buf = buf[:0]
+		switch format {
+		case ExportBinary:
+			buf = append(buf, byte(ip32>>24), byte(ip32>>16), byte(ip32>>8), byte(ip32))
+		case ExportJSONLines:
+			buf = append(buf, `{"ip":"`...)
+			buf = appendIP4(buf, ip32)
+			buf = append(buf, "\"}\n"...)
+		default:
+			buf = appendIP4(buf, ip32)
+			buf = append(buf, '\n')
+		}
+		if _, err = bw.Write(buf); err != nil {
+			return false
+		}
+		written++
+		return true
+	})
+	if err != nil {
+		return written, err
+	}
+	return written, bw.Flush()
+}
+
+// appendIP4 appends the dotted form of ip32 to buf.
+func appendIP4(buf []byte, ip32 uint32) []byte {
+	buf = strconv.AppendUint(buf, uint64(ip32>>24), 10)
+	buf = append(buf, '.')
+	buf = strconv.AppendUint(buf, uint64(ip32>>16&0xff), 10)
+	buf = append(buf, '.')
+	buf = strconv.AppendUint(buf, uint64(ip32>>8&0xff), 10)
+	buf = append(buf, '.')
+	return strconv.AppendUint(buf, uint64(ip32&0xff), 10)
+}
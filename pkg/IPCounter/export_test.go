@@ -0,0 +1,67 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestExportUniqueIP4(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.2\n1.1.1.1\n10.0.0.2\ninvalid\n255.255.255.255\n")
+	tests := []struct {
+		format ExportFormat
+		want   string
+	}{
+		{format: ExportText, want: "1.1.1.1\n10.0.0.2\n255.255.255.255\n"},
+		{format: ExportJSONLines, want: "{\"ip\":\"1.1.1.1\"}\n{\"ip\":\"10.0.0.2\"}\n{\"ip\":\"255.255.255.255\"}\n"},
+		{format: ExportCSV, want: "ip\n1.1.1.1\n10.0.0.2\n255.255.255.255\n"},
+		{format: ExportBinary, want: "\x01\x01\x01\x01\x0a\x00\x00\x02\xff\xff\xff\xff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			count, err := NewIPCounter(1, '\n').ExportUniqueIP4(context.Background(), path, &buf, tt.format)
+			if err != nil {
+				t.Fatalf("ExportUniqueIP4() returned an error: %v", err)
+			}
+			if count != 3 {
+				t.Errorf("ExportUniqueIP4() = %d; want 3", count)
+			}
+			if buf.String() != tt.want {
+				t.Errorf("ExportUniqueIP4() wrote %q; want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExportFormat(t *testing.T) {
+	for _, name := range []string{"text", "jsonl", "csv", "binary"} {
+		format, err := ParseExportFormat(name)
+		if err != nil || format.String() != name {
+			t.Errorf("ParseExportFormat(%q) = %s, %v", name, format, err)
+		}
+	}
+	if format, err := ParseExportFormat("JSON"); err != nil || format != ExportJSONLines {
+		t.Errorf("ParseExportFormat(JSON) = %s, %v; want jsonl", format, err)
+	}
+	if _, err := ParseExportFormat("xml"); !errors.Is(err, ErrUnknownExportFormat) {
+		t.Errorf("ParseExportFormat(xml) error = %v; want %v", err, ErrUnknownExportFormat)
+	}
+}
+
+func TestWriteSetCancel(t *testing.T) {
+	set := newRoaringSet()
+	for i := uint32(0); i < 3*exportBatch; i++ {
+		set.add(i * 7)
+	}
+	var buf bytes.Buffer
+	if n, err := writeSet(context.Background(), &buf, set, ExportBinary); err != nil || n != 3*exportBatch || buf.Len() != 12*exportBatch {
+		t.Fatalf("writeSet() = %d, %v with %d bytes", n, err, buf.Len())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := writeSet(ctx, &buf, set, ExportText); !errors.Is(err, context.Canceled) {
+		t.Errorf("writeSet() with cancelled context error = %v; want %v", err, context.Canceled)
+	}
+}
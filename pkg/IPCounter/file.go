@@ -1,6 +1,45 @@
 package IPCounter
 
-import "os"
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+)
+
+// ReadMode controls how the input file interacts with the OS page cache.
+type ReadMode int
+
+const (
+	// ReadModeBuffered reads the file through the page cache (default).
+	ReadModeBuffered ReadMode = iota
+	// ReadModeFadvise reads through the page cache, but hints the kernel with posix_fadvise
+	// (SEQUENTIAL on open, DONTNEED behind every read) so scanned pages don't stay cached.
+	ReadModeFadvise
+	// ReadModeDirect bypasses the page cache with O_DIRECT and aligned buffers.
+	// If the filesystem doesn't support O_DIRECT, ReadModeFadvise is used instead.
+	ReadModeDirect
+)
+
+func (m ReadMode) String() string {
+	switch m {
+	case ReadModeBuffered:
+		return "buffered"
+	case ReadModeFadvise:
+		return "fadvise"
+	case ReadModeDirect:
+		return "direct"
+	}
+	return fmt.Sprintf("ReadMode(%d)", int(m))
+}
+
+const (
+	directIOAlign     = 4096                    //safe alignment for O_DIRECT on 512b and 4k sector disks
+	directIOChunkSize = 65536 + 2*directIOAlign //readers use 64kb chunks, unaligned offsets may touch one extra block on each side
+	directIOMask      = int64(directIOAlign - 1)
+)
 
 type fileReadStat interface {
 	Stat() (os.FileInfo, error)
@@ -13,3 +52,143 @@ func getFileSize(file fileReadStat) (int64, error) {
 	}
 	return info.Size(), nil
 }
+
+// writeFileAtomic writes a temporary file next to path with write and renames it to path once it is synced.
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err = write(tmp); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// openFile opens path for reading using the requested mode and returns the file (to be closed by the caller)
+// together with the reader the counters should use and the mode actually applied.
+func openFile(path string, mode ReadMode) (*os.File, fileReader, ReadMode, error) {
+	if mode == ReadModeDirect {
+		file, err := openDirect(path)
+		if err == nil {
+			return file, newDirectReader(file), ReadModeDirect, nil
+		}
+		if !isDirectUnsupported(err) {
+			return nil, nil, mode, err
+		}
+		mode = ReadModeFadvise //filesystem can't do O_DIRECT (tmpfs, some fuse), at least don't pollute the cache
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, mode, err
+	}
+	if mode == ReadModeFadvise {
+		if adviseSequential(file) == nil {
+			return file, &fadviseReader{file: file}, ReadModeFadvise, nil
+		}
+		mode = ReadModeBuffered
+	}
+	return file, file, mode, nil
+}
+
+// fadviseReader drops the pages behind every read from the page cache.
+type fadviseReader struct {
+	file *os.File
+	pos  int64
+}
+
+func (f *fadviseReader) Read(p []byte) (int, error) {
+	n, err := f.file.Read(p)
+	if n > 0 {
+		_ = adviseDontNeed(f.file, f.pos, int64(n))
+		f.pos += int64(n)
+	}
+	return n, err
+}
+
+func (f *fadviseReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	if n > 0 {
+		_ = adviseDontNeed(f.file, off, int64(n))
+	}
+	return n, err
+}
+
+// directReader adapts arbitrary offsets and lengths to O_DIRECT requirements.
+// Chunk boundaries from getPositions and correctOffset are aligned to line breaks, not to blocks,
+// so every read is widened to the enclosing aligned block range and the requested part is copied out.
+// It is safe for concurrent ReadAt calls, Read keeps a single sequential position.
+type directReader struct {
+	file io.ReaderAt
+	pos  int64
+	pool sync.Pool
+}
+
+func newDirectReader(file io.ReaderAt) *directReader {
+	return &directReader{
+		file: file,
+		pool: sync.Pool{New: func() any {
+			buf := alignedBuffer(directIOChunkSize)
+			return &buf
+		}},
+	}
+}
+
+func (d *directReader) Read(p []byte) (int, error) {
+	n, err := d.ReadAt(p, d.pos)
+	d.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil //io.Reader contract, EOF comes with the next call
+	}
+	return n, err
+}
+
+func (d *directReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	start := off &^ directIOMask
+	end := (off + int64(len(p)) + directIOMask) &^ directIOMask
+	size := int(end - start)
+	var buf []byte
+	if size <= directIOChunkSize {
+		pooled := d.pool.Get().(*[]byte)
+		defer d.pool.Put(pooled)
+		buf = (*pooled)[:size]
+	} else {
+		buf = alignedBuffer(size)
+	}
+	n, err := d.file.ReadAt(buf, start)
+	skip := int(off - start)
+	if n <= skip {
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	copied := copy(p, buf[skip:n])
+	if copied < len(p) {
+		if err == nil {
+			err = io.EOF
+		}
+		return copied, err
+	}
+	return copied, nil
+}
+
+// alignedBuffer returns a slice of the given size whose first byte is aligned to directIOAlign.
+func alignedBuffer(size int) []byte {
+	buf := make([]byte, size+directIOAlign)
+	shift := int(uintptr(unsafe.Pointer(&buf[0])) & uintptr(directIOAlign-1))
+	if shift != 0 {
+		shift = directIOAlign - shift
+	}
+	return buf[shift : shift+size : shift+size]
+}
@@ -0,0 +1,50 @@
+//go:build linux
+
+package IPCounter
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func openDirect(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDONLY|unix.O_DIRECT, 0)
+}
+
+// isDirectUnsupported reports whether opening with O_DIRECT failed because the filesystem doesn't support it.
+func isDirectUnsupported(err error) bool {
+	return errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EOPNOTSUPP)
+}
+
+func adviseSequential(file *os.File) error {
+	return unix.Fadvise(int(file.Fd()), 0, 0, unix.FADV_SEQUENTIAL)
+}
+
+func adviseDontNeed(file *os.File, offset int64, length int64) error {
+	return unix.Fadvise(int(file.Fd()), offset, length, unix.FADV_DONTNEED)
+}
+
+// isNetworkFilesystem reports whether the file lives on NFS, SMB/CIFS, Ceph or a FUSE mount,
+// where EIO is usually a transient network problem rather than a broken disk.
+func isNetworkFilesystem(file *os.File) bool {
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(int(file.Fd()), &st); err != nil {
+		return false
+	}
+	switch uint32(st.Type) {
+	case unix.NFS_SUPER_MAGIC, unix.SMB_SUPER_MAGIC, unix.SMB2_SUPER_MAGIC, unix.CIFS_SUPER_MAGIC,
+		unix.CEPH_SUPER_MAGIC, unix.FUSE_SUPER_MAGIC, unix.AFS_SUPER_MAGIC, unix.V9FS_MAGIC:
+		return true
+	}
+	return false
+}
+
+func isTransientErrno(err error) bool {
+	return errors.Is(err, unix.EINTR) || errors.Is(err, unix.EAGAIN)
+}
+
+func isIOErrno(err error) bool {
+	return errors.Is(err, unix.EIO)
+}
@@ -0,0 +1,35 @@
+//go:build !linux
+
+package IPCounter
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var errNoCacheControl = errors.New("page cache control is not supported on this platform")
+
+func openDirect(path string) (*os.File, error) {
+	return nil, errNoCacheControl
+}
+
+func isDirectUnsupported(err error) bool {
+	return errors.Is(err, errNoCacheControl)
+}
+
+func adviseSequential(file *os.File) error {
+	return errNoCacheControl
+}
+
+func adviseDontNeed(file *os.File, offset int64, length int64) error {
+	return nil
+}
+
+func isNetworkFilesystem(file *os.File) bool {
+	return false
+}
+
+func isIOErrno(err error) bool {
+	return errors.Is(err, syscall.EIO)
+}
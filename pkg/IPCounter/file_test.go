@@ -0,0 +1,111 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestDirectReaderReadAt(t *testing.T) {
+	content := []byte(generateLargeFileData(20000, '\n'))
+	tmpFile, err := os.CreateTemp("", "testfile")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	if _, err := tmpFile.Write(content); err != nil {
+		t.Fatalf("Failed to write data to temp file: %v", err)
+	}
+
+	reader := newDirectReader(tmpFile)
+	size := int64(len(content))
+	tests := []struct {
+		name   string
+		offset int64
+		length int
+	}{
+		{name: "Aligned offset", offset: 0, length: 4096},
+		{name: "Unaligned offset", offset: 13, length: 100},
+		{name: "Crosses block boundary", offset: 4090, length: 20},
+		{name: "Full chunk", offset: 52, length: 65536},
+		{name: "Bigger than pooled buffer", offset: 7, length: 3 * 65536},
+		{name: "Tail of file", offset: size - 10, length: 10},
+		{name: "Past end of file", offset: size - 10, length: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := make([]byte, tt.length)
+			n, err := reader.ReadAt(buf, tt.offset)
+			end := tt.offset + int64(tt.length)
+			if end > size {
+				end = size
+			}
+			want := content[tt.offset:end]
+			if end-tt.offset < int64(tt.length) && !errors.Is(err, io.EOF) {
+				t.Errorf("ReadAt() error = %v, want io.EOF", err)
+			} else if end-tt.offset == int64(tt.length) && err != nil {
+				t.Errorf("ReadAt() error = %v", err)
+			}
+			if !bytes.Equal(buf[:n], want) {
+				t.Errorf("ReadAt() read %d bytes not matching file content at %d", n, tt.offset)
+			}
+		})
+	}
+}
+
+func TestDirectReaderRead(t *testing.T) {
+	content := []byte(generateLargeFileData(5000, '\n'))
+	reader := newDirectReader(bytes.NewReader(content))
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("ReadAll returned an error: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Read returned %d bytes, want %d", len(got), len(content))
+	}
+}
+
+func TestAlignedBuffer(t *testing.T) {
+	for _, size := range []int{1, 4096, directIOChunkSize} {
+		buf := alignedBuffer(size)
+		if len(buf) != size {
+			t.Errorf("alignedBuffer(%d) length = %d", size, len(buf))
+		}
+		if uintptr(unsafe.Pointer(&buf[0]))%directIOAlign != 0 {
+			t.Errorf("alignedBuffer(%d) is not aligned", size)
+		}
+	}
+}
+
+func TestUniqueIP4ReadModes(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "testfile")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(generateLargeFileData(10000, '\n')); err != nil {
+		t.Fatalf("Failed to write data to temp file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatalf("Failed to close temp file: %v", err)
+	}
+
+	for _, mode := range []ReadMode{ReadModeBuffered, ReadModeFadvise, ReadModeDirect} {
+		ipCounter := NewIPCounter(1, '\n', WithReadMode(mode))
+		count, err := ipCounter.UniqueIP4(context.Background(), tmpFile.Name())
+		if err != nil {
+			t.Fatalf("UniqueIP4() with read mode %d returned an error: %v", mode, err)
+		}
+		if count != 255 {
+			t.Errorf("UniqueIP4() with read mode %d = %d; want 255", mode, count)
+		}
+		if ipCounter.GetAppliedReadMode() > mode {
+			t.Errorf("applied read mode %d is stronger than requested %d", ipCounter.GetAppliedReadMode(), mode)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package IPCounter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+)
+
+// prefixEntry assigns value to the addresses of block.
+type prefixEntry struct {
+	block cidrBlock
+	value int
+}
+
+// prefixTable maps an address to the value of the most specific prefix containing it.
+// The prefixes are flattened into disjoint intervals, and an index by the top 16 bits of the address
+// narrows the search to the one or two intervals that usually touch a /16, so a lookup costs a few comparisons.
+type prefixTable struct {
+	starts []uint32
+	ends   []uint32
+	values []int
+	index  []uint32 //index[b] is the first interval ending at or after the /16 block b, index[65536] is len(ends)
+}
+
+// newPrefixTable builds the table of entries, of equal prefixes the last one wins.
+func newPrefixTable(entries []prefixEntry) *prefixTable {
+	sorted := append([]prefixEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].block.addr != sorted[j].block.addr {
+			return sorted[i].block.addr < sorted[j].block.addr
+		}
+		return sorted[i].block.bits < sorted[j].block.bits
+	})
+	t := &prefixTable{}
+	var (
+		cursor uint64 //first address not painted yet
+		stack  []prefixEntry
+	)
+	// prefixes are nested or disjoint, every one paints the part of its parent before it and after it
+	popTo := func(addr uint64) {
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if addr <= uint64(top.block.last()) {
+				return
+			}
+			t.paint(cursor, uint64(top.block.last()), top.value)
+			cursor = max(cursor, uint64(top.block.last())+1)
+			stack = stack[:len(stack)-1]
+		}
+	}
+	for _, e := range sorted {
+		popTo(uint64(e.block.addr))
+		if len(stack) > 0 && cursor < uint64(e.block.addr) {
+			t.paint(cursor, uint64(e.block.addr)-1, stack[len(stack)-1].value)
+		}
+		cursor = uint64(e.block.addr)
+		stack = append(stack, e)
+	}
+	popTo(1 << 32)
+
+	t.index = make([]uint32, 65537)
+	i := 0
+	for b := 0; b <= 65536; b++ {
+		for i < len(t.ends) && uint64(t.ends[i]) < uint64(b)<<16 {
+			i++
+		}
+		t.index[b] = uint32(i)
+	}
+	return t
+}
+
+// paint appends the interval first..last with value, joined with the previous one when it continues it.
+func (t *prefixTable) paint(first uint64, last uint64, value int) {
+	if first > last {
+		return
+	}
+	if n := len(t.ends); n > 0 && t.values[n-1] == value && uint64(t.ends[n-1])+1 == first {
+		t.ends[n-1] = uint32(last)
+		return
+	}
+	t.starts = append(t.starts, uint32(first))
+	t.ends = append(t.ends, uint32(last))
+	t.values = append(t.values, value)
+}
+
+// lookup returns the value of the most specific prefix containing ip32, ok is false when none does.
+func (t *prefixTable) lookup(ip32 uint32) (value int, ok bool) {
+	block := ip32 >> 16
+	lo, hi := int(t.index[block]), int(t.index[block+1])+1
+	if hi > len(t.ends) {
+		hi = len(t.ends)
+	}
+	for lo < hi { //first interval ending at or after ip32
+		mid := int(uint(lo+hi) >> 1)
+		if t.ends[mid] < ip32 {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(t.ends) && t.starts[lo] <= ip32 && ip32 <= t.ends[lo] {
+		return t.values[lo], true
+	}
+	return 0, false
+}
+
+// filterRule is what a filter does with the addresses of its prefixes.
+type filterRule struct {
+	name     string
+	reject   bool
+	rejected *roaringSet //unique addresses rejected in the current scan
+}
+
+// addrFilter drops addresses before they reach the set: an address takes the rule of the most specific prefix
+// containing it, or the fallback rule when no prefix does.
+type addrFilter struct {
+	table    *prefixTable
+	rules    []filterRule
+	fallback int
+}
+
+// allow reports whether ip32 passes the filter and records it when it doesn't.
+func (f *addrFilter) allow(ip32 uint32) bool {
+	rule, ok := f.table.lookup(ip32)
+	if !ok {
+		rule = f.fallback
+	}
+	if !f.rules[rule].reject {
+		return true
+	}
+	f.rules[rule].rejected.add(ip32)
+	return false
+}
+
+// allowed runs ip32 through the filters of the counter, the readers call it for every parsed address.
+func (ip *IPCounter) allowed(ip32 uint32) bool {
+	for _, f := range ip.filters {
+		if !f.allow(ip32) {
+			return false
+		}
+	}
+	return true
+}
+
+// resetFilters starts the rejected sets of a new scan.
+func (ip *IPCounter) resetFilters() {
+	for _, f := range ip.filters {
+		for i := range f.rules {
+			if f.rules[i].reject {
+				f.rules[i].rejected = newRoaringSet()
+			}
+		}
+	}
+}
+
+// rejectedCounts returns the unique addresses rejected by every rule, nil without filters.
+func (ip *IPCounter) rejectedCounts() map[string]int64 {
+	if len(ip.filters) == 0 {
+		return nil
+	}
+	counts := map[string]int64{}
+	for _, f := range ip.filters {
+		for _, rule := range f.rules {
+			if rule.reject && rule.rejected != nil {
+				counts[rule.name] += rule.rejected.count()
+			}
+		}
+	}
+	return counts
+}
+
+const (
+	// IncludeFilterName is the name Stats.Rejected reports the addresses outside every include list under.
+	IncludeFilterName = "include"
+	// ExcludeFilterPrefix is put in front of the name of an exclude list in Stats.Rejected, so a list named like a
+	// category (e.g. private) isn't reported together with the category.
+	ExcludeFilterPrefix = "cidr:"
+)
+
+// cidrList is a named list of prefixes of WithIncludeCIDRs or WithExcludeCIDRs.
+type cidrList struct {
+	name     string
+	prefixes []netip.Prefix
+}
+
+// ParseCIDRs reads one prefix or address per line, blank lines and # comments are skipped.
+func ParseCIDRs(r io.Reader) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), "#")
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		prefix, err := parseIP4Prefix(text)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, scanner.Err()
+}
+
+// LoadCIDRFile reads the prefixes of a file with ParseCIDRs.
+func LoadCIDRFile(path string) ([]netip.Prefix, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	prefixes, err := ParseCIDRs(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return prefixes, nil
+}
+
+// includeFilter returns the filter rejecting the addresses outside every list.
+func includeFilter(lists []cidrList) *addrFilter {
+	var entries []prefixEntry
+	for _, list := range lists {
+		for _, prefix := range list.prefixes {
+			entries = append(entries, prefixEntry{block: blockOf(prefix), value: 1})
+		}
+	}
+	rules := []filterRule{{name: IncludeFilterName, reject: true}, {}}
+	return &addrFilter{table: newPrefixTable(entries), rules: rules, fallback: 0}
+}
+
+// excludeFilter returns the filter rejecting the addresses of every list, an address is reported
+// under the list with its most specific prefix.
+func excludeFilter(lists []cidrList) *addrFilter {
+	var entries []prefixEntry
+	rules := []filterRule{{}} //the fallback lets the address pass
+	for _, list := range lists {
+		for _, prefix := range list.prefixes {
+			entries = append(entries, prefixEntry{block: blockOf(prefix), value: len(rules)})
+		}
+		rules = append(rules, filterRule{name: ExcludeFilterPrefix + list.name, reject: true})
+	}
+	return &addrFilter{table: newPrefixTable(entries), rules: rules, fallback: 0}
+}
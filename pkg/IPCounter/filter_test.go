@@ -0,0 +1,131 @@
+package IPCounter
+
+import (
+	"context"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPrefixTable(t *testing.T) {
+	entries := []prefixEntry{
+		{block: blockOf(netip.MustParsePrefix("10.0.0.0/8")), value: 1},
+		{block: blockOf(netip.MustParsePrefix("10.1.0.0/16")), value: 2},
+		{block: blockOf(netip.MustParsePrefix("10.1.2.3/32")), value: 3},
+		{block: blockOf(netip.MustParsePrefix("192.168.0.0/16")), value: 4},
+		{block: blockOf(netip.MustParsePrefix("255.255.255.255/32")), value: 5},
+		{block: blockOf(netip.MustParsePrefix("0.0.0.0/8")), value: 6},
+	}
+	table := newPrefixTable(entries)
+	tests := []struct {
+		addr   string
+		want   int
+		wantOk bool
+	}{
+		{addr: "10.0.0.1", want: 1, wantOk: true},
+		{addr: "10.1.0.0", want: 2, wantOk: true},
+		{addr: "10.1.2.3", want: 3, wantOk: true},
+		{addr: "10.1.2.4", want: 2, wantOk: true},
+		{addr: "10.2.0.0", want: 1, wantOk: true},
+		{addr: "10.255.255.255", want: 1, wantOk: true},
+		{addr: "11.0.0.0"},
+		{addr: "192.168.255.255", want: 4, wantOk: true},
+		{addr: "192.169.0.0"},
+		{addr: "255.255.255.255", want: 5, wantOk: true},
+		{addr: "255.255.255.254"},
+		{addr: "0.0.0.0", want: 6, wantOk: true},
+	}
+	for _, tt := range tests {
+		ip32, _ := ip4BytesToUint32([]byte(tt.addr))
+		if got, ok := table.lookup(ip32); got != tt.want || ok != tt.wantOk {
+			t.Errorf("lookup(%s) = %d, %v; want %d, %v", tt.addr, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestPrefixTableMatchesLinearScan(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	entries := make([]prefixEntry, 2000)
+	for i := range entries {
+		bits := 8 + random.Intn(25)
+		addr := random.Uint32() >> 8 << 8 //share /24s with the probes
+		entries[i] = prefixEntry{block: cidrBlock{addr: addr &^ (1<<(32-bits) - 1), bits: bits}, value: i}
+	}
+	table := newPrefixTable(entries)
+	for probe := 0; probe < 20000; probe++ {
+		ip32 := entries[random.Intn(len(entries))].block.addr + uint32(random.Intn(512))
+		want, wantOk, wantBits := 0, false, -1
+		for _, e := range entries {
+			if ip32&^(uint32(e.block.size()-1)) == e.block.addr && e.block.bits >= wantBits {
+				want, wantOk, wantBits = e.value, true, e.block.bits
+			}
+		}
+		if got, ok := table.lookup(ip32); got != want || ok != wantOk {
+			t.Fatalf("lookup(%s) = %d, %v; want %d, %v", addrFrom32(ip32), got, ok, want, wantOk)
+		}
+	}
+}
+
+func TestCIDRFilters(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n10.0.0.1\n10.0.0.2\n10.1.0.1\n192.168.1.1\n8.8.8.8\n8.8.4.4\n1.1.1.1\n")
+	office, err := ParseCIDRs(strings.NewReader("# office\n10.0.0.0/24\n\n192.168.1.1 # printer\n"))
+	if err != nil {
+		t.Fatalf("ParseCIDRs() returned an error: %v", err)
+	}
+	health := []netip.Prefix{netip.MustParsePrefix("8.8.4.4/32")}
+	tests := []struct {
+		name         string
+		opts         []Option
+		want         int64
+		wantRejected map[string]int64
+	}{
+		{name: "No filters", want: 7},
+		{
+			name:         "Exclude lists",
+			opts:         []Option{WithExcludeCIDRs("office", office...), WithExcludeCIDRs("health", health...)},
+			want:         3,
+			wantRejected: map[string]int64{"cidr:office": 3, "cidr:health": 1},
+		},
+		{
+			name:         "Include list",
+			opts:         []Option{WithIncludeCIDRs("internal", netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.0.0/16"))},
+			want:         4,
+			wantRejected: map[string]int64{IncludeFilterName: 3},
+		},
+		{
+			name: "Include and exclude lists",
+			opts: []Option{
+				WithIncludeCIDRs("internal", netip.MustParsePrefix("10.0.0.0/8")),
+				WithExcludeCIDRs("office", office...),
+			},
+			want:         1,
+			wantRejected: map[string]int64{IncludeFilterName: 4, "cidr:office": 2},
+		},
+		{
+			name:         "Exclude list named like a category",
+			opts:         []Option{WithExcludeCIDRs(CategoryPrivate, health...), WithExcludeCategories(CategoryPrivate)},
+			want:         2,
+			wantRejected: map[string]int64{ExcludeFilterPrefix + CategoryPrivate: 1, CategoryPrivate: 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipCounter := NewIPCounter(1, '\n', tt.opts...)
+			got, err := ipCounter.UniqueIP4(context.Background(), path)
+			if err != nil {
+				t.Fatalf("UniqueIP4() returned an error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("UniqueIP4() = %d; want %d", got, tt.want)
+			}
+			if rejected := ipCounter.GetStats().Rejected; !reflect.DeepEqual(rejected, tt.wantRejected) {
+				t.Errorf("GetStats().Rejected = %v; want %v", rejected, tt.wantRejected)
+			}
+		})
+	}
+	if _, err = ParseCIDRs(strings.NewReader("2001:db8::/32\n")); err == nil {
+		t.Errorf("ParseCIDRs() of an IPv6 prefix returned no error")
+	}
+}
@@ -0,0 +1,234 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+)
+
+const (
+	defaultFollowPoll = 250 * time.Millisecond
+	maxPendingLine    = 4096 //longer unfinished lines can't be an ip, they are dropped
+)
+
+// FollowUpdate is the running state of Follow.
+type FollowUpdate struct {
+	UniqueCount int64  // unique addresses of everything read so far, rotated files included
+	Lines       int64  // lines read after the initial scan
+	Offset      int64  // bytes of the current file processed
+	Rotations   int    // times the file was rotated or truncated
+	Path        string // the followed path
+}
+
+// Follow counts the unique IPv4 addresses of path like UniqueIP4 and then keeps reading the lines appended to it, like tail -F.
+// A truncated file is read again from the start, and when path is renamed and created again (log rotation)
+// the rest of the old file is read before the new one. The set is kept across rotations, so the count covers all of them.
+// onUpdate (may be nil) receives the running count after the initial scan and after every batch of new lines,
+// it is called from the goroutine running Follow. Follow returns the final count and nil when ctx is done.
+func (ip *IPCounter) Follow(ctx context.Context, path string, onUpdate func(FollowUpdate)) (int64, error) {
+	ip.keepSet, ip.completeLines = true, true //an unterminated last line may still be written, it's read as pending
+	defer func() {
+		ip.keepSet, ip.completeLines = false, false
+		ip.set = nil
+	}()
+	if _, err := ip.UniqueIP4(ctx, path); err != nil {
+		return 0, err
+	}
+	set := ip.set
+	if sorted, ok := set.(*sortedSet); ok { //the sorted slice is too slow to grow, move to a set built for adding
+		roaring := newRoaringSet()
+		sorted.each(roaring.add)
+		set = roaring
+	}
+	poll := ip.followPoll
+	if poll <= 0 {
+		poll = defaultFollowPoll
+	}
+	f := &follower{ip: ip, path: path, set: set, poll: poll, onUpdate: onUpdate}
+	defer f.close()
+	if err := f.reopen(ip.identity, ip.fileSize); err != nil {
+		return set.count(), err
+	}
+	f.notify()
+	return f.run(ctx)
+}
+
+// follower reads the lines appended to the followed file.
+type follower struct {
+	ip       *IPCounter
+	path     string
+	set      ip4Set
+	poll     time.Duration
+	onUpdate func(FollowUpdate)
+	file     *os.File
+	reader   *bufio.Reader
+	pending  []byte //read part of a line whose line break isn't written yet
+	skipping bool   //pending line was too long and is dropped up to the next line break
+	update   FollowUpdate
+}
+
+// reopen opens path again after the initial scan, which ended at the offset scannedEnd after the last line break.
+// It continues there when path is still the scanned file, otherwise the file was rotated in between and is read
+// from the start.
+func (f *follower) reopen(scanned fileIdentity, scannedEnd int64) error {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.reader = bufio.NewReaderSize(file, 65536)
+	f.update.Path = f.path
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	current := getFileIdentity(info)
+	if current.inode != scanned.inode || current.size < scanned.size {
+		f.update.Rotations++
+		return nil
+	}
+	f.update.Offset = scannedEnd
+	_, err = file.Seek(scannedEnd, io.SeekStart)
+	return err
+}
+
+func (f *follower) run(ctx context.Context) (int64, error) {
+	for {
+		lines, err := f.readAvailable(ctx)
+		if err != nil {
+			return f.set.count(), err
+		}
+		if lines > 0 {
+			f.notify()
+		}
+		if sleepContext(ctx, f.poll) != nil {
+			return f.set.count(), nil
+		}
+		if err = f.checkRotation(ctx); err != nil {
+			return f.set.count(), err
+		}
+	}
+}
+
+// checkRotation starts over when the file was truncated and switches to the new file when path was rotated.
+func (f *follower) checkRotation(ctx context.Context) error {
+	info, err := f.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < f.update.Offset { //truncated, e.g. copytruncate rotation
+		if _, err = f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		f.reader.Reset(f.file)
+		f.resetLine()
+		f.update.Offset = 0
+		f.update.Rotations++
+		f.ip.log().InfoContext(ctx, "followed file truncated", slog.String("path", f.path), slog.Int("rotations", f.update.Rotations))
+		return nil
+	}
+	current, err := os.Stat(f.path)
+	if err != nil || os.SameFile(info, current) {
+		return nil //not rotated, or the new file isn't created yet
+	}
+	lines, err := f.readAvailable(ctx) //whatever was written to the old file before the rotation
+	if err != nil {
+		return err
+	}
+	if len(f.pending) > 0 && !f.skipping { //the old file won't get its last line break anymore
+		f.addLine(f.pending)
+		lines++
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil //removed again, try on the next poll
+	}
+	f.close()
+	f.file = file
+	f.reader.Reset(file)
+	f.resetLine()
+	f.update.Offset = 0
+	f.update.Rotations++
+	f.ip.log().InfoContext(ctx, "followed file rotated", slog.String("path", f.path), slog.Int("rotations", f.update.Rotations))
+	if lines > 0 {
+		f.notify()
+	}
+	return nil
+}
+
+// readAvailable reads the complete lines written so far and returns their number.
+func (f *follower) readAvailable(ctx context.Context) (int64, error) {
+	var lines int64
+	for {
+		if err := checkContext(ctx); err != nil {
+			return lines, nil
+		}
+		var line []byte
+		err := f.ip.retry(ctx, func() error {
+			var readErr error
+			line, readErr = f.reader.ReadBytes(f.ip.lineBreak)
+			return readErr
+		})
+		f.update.Offset += int64(len(line))
+		if errors.Is(err, io.EOF) {
+			f.keepPending(line)
+			return lines, nil
+		}
+		if err != nil {
+			return lines, err
+		}
+		line = line[:len(line)-1]
+		if f.skipping {
+			f.resetLine()
+			continue
+		}
+		if len(f.pending) > 0 {
+			line = append(f.pending, line...)
+			f.pending = f.pending[:0]
+		}
+		f.addLine(line)
+		lines++
+	}
+}
+
+func (f *follower) addLine(line []byte) {
+	f.update.Lines++
+	if ip32, err := ip4BytesToUint32(line); err == nil && (f.ip.filters == nil || f.ip.allowed(ip32)) {
+		f.set.add(ip32)
+	}
+}
+
+// keepPending stores the beginning of a line that is still being written.
+func (f *follower) keepPending(part []byte) {
+	if f.skipping {
+		return
+	}
+	f.pending = append(f.pending, part...)
+	if len(f.pending) > maxPendingLine {
+		f.pending = f.pending[:0]
+		f.skipping = true
+	}
+}
+
+func (f *follower) resetLine() {
+	f.pending = f.pending[:0]
+	f.skipping = false
+}
+
+func (f *follower) notify() {
+	f.update.UniqueCount = f.set.count()
+	if f.onUpdate != nil {
+		f.onUpdate(f.update)
+	}
+}
+
+func (f *follower) close() {
+	if f.file != nil {
+		_ = f.file.Close()
+		f.file = nil
+	}
+}
@@ -0,0 +1,133 @@
+package IPCounter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// appendFile appends data to the file at path.
+func appendFile(t *testing.T, path string, data string) {
+	t.Helper()
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open %s for append: %v", path, err)
+	}
+	defer file.Close()
+	if _, err := file.WriteString(data); err != nil {
+		t.Fatalf("Failed to append to %s: %v", path, err)
+	}
+}
+
+// waitUpdate waits for the first update matching cond.
+func waitUpdate(t *testing.T, updates <-chan FollowUpdate, cond func(FollowUpdate) bool) FollowUpdate {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case update := <-updates:
+			if cond(update) {
+				return update
+			}
+		case <-timeout:
+			t.Fatalf("no expected follow update within 5s")
+		}
+	}
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	appendFile(t, path, "10.0.0.1\n10.0.0.2\n10.0.0.1\n")
+
+	ipCounter := NewIPCounter(1, '\n', WithFollowPoll(10*time.Millisecond))
+	updates := make(chan FollowUpdate, 100)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	type result struct {
+		count int64
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		count, err := ipCounter.Follow(ctx, path, func(update FollowUpdate) {
+			updates <- update
+		})
+		done <- result{count: count, err: err}
+	}()
+
+	waitUpdate(t, updates, func(u FollowUpdate) bool { return u.UniqueCount == 2 })
+
+	appendFile(t, path, "10.0.0.3\n10.0.")
+	update := waitUpdate(t, updates, func(u FollowUpdate) bool { return u.Lines == 1 })
+	if update.UniqueCount != 3 {
+		t.Errorf("UniqueCount after append = %d; want 3", update.UniqueCount)
+	}
+
+	appendFile(t, path, "0.4\n") //completes the pending line
+	waitUpdate(t, updates, func(u FollowUpdate) bool { return u.UniqueCount == 4 })
+
+	// rename based rotation: the old file gets one more line before the new file is created
+	appendFile(t, path, "10.0.0.5\n")
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatalf("Failed to rotate log: %v", err)
+	}
+	appendFile(t, path+".1", "10.0.0.6\n")
+	appendFile(t, path, "10.0.0.7\n10.0.0.1\n")
+	update = waitUpdate(t, updates, func(u FollowUpdate) bool { return u.UniqueCount == 7 })
+	if update.Rotations != 1 {
+		t.Errorf("Rotations after rename = %d; want 1", update.Rotations)
+	}
+
+	if err := os.Truncate(path, 0); err != nil {
+		t.Fatalf("Failed to truncate log: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	appendFile(t, path, "10.0.0.8\n")
+	update = waitUpdate(t, updates, func(u FollowUpdate) bool { return u.UniqueCount == 8 })
+	if update.Rotations != 2 || update.Offset != 9 {
+		t.Errorf("after truncation Rotations = %d, Offset = %d; want 2, 9", update.Rotations, update.Offset)
+	}
+
+	cancel()
+	res := <-done
+	if res.err != nil || res.count != 8 {
+		t.Errorf("Follow() = %d, %v; want 8, nil", res.count, res.err)
+	}
+}
+
+func TestFollowUnterminatedLine(t *testing.T) {
+	for _, mode := range []ReadMode{ReadModeBuffered, ReadModeDirect} {
+		t.Run(mode.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "access.log")
+			appendFile(t, path, "10.0.0.1\n10.0.0.2") //the last line is still being written
+
+			ipCounter := NewIPCounter(2, '\n', WithFollowPoll(10*time.Millisecond), WithReadMode(mode))
+			updates := make(chan FollowUpdate, 100)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan int64, 1)
+			go func() {
+				count, _ := ipCounter.Follow(ctx, path, func(update FollowUpdate) {
+					updates <- update
+				})
+				done <- count
+			}()
+
+			first := waitUpdate(t, updates, func(FollowUpdate) bool { return true })
+			if first.UniqueCount != 1 || first.Offset != 9 {
+				t.Errorf("after the initial scan UniqueCount = %d, Offset = %d; want 1, 9", first.UniqueCount, first.Offset)
+			}
+			appendFile(t, path, "5\n")
+			update := waitUpdate(t, updates, func(u FollowUpdate) bool { return u.Lines == 1 })
+			if update.UniqueCount != 2 || update.Offset != 19 {
+				t.Errorf("after the line ends UniqueCount = %d, Offset = %d; want 2 (10.0.0.1, 10.0.0.25), 19", update.UniqueCount, update.Offset)
+			}
+			cancel()
+			if count := <-done; count != 2 {
+				t.Errorf("Follow() = %d; want 2", count)
+			}
+		})
+	}
+}
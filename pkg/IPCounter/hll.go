@@ -0,0 +1,184 @@
+package IPCounter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"net/netip"
+	"sync"
+)
+
+const (
+	// DefaultHLLPrecision is the HyperLogLog precision of sketches unless WithHLLPrecision is used,
+	// 2^14 registers of one byte with a standard error of about 0.8%.
+	DefaultHLLPrecision = 14
+	minHLLPrecision     = 4
+	maxHLLPrecision     = 18
+)
+
+// ErrInvalidPrecision is returned for a HyperLogLog precision outside 4..18.
+var ErrInvalidPrecision = errors.New("invalid HyperLogLog precision")
+
+// hyperLogLog estimates the number of distinct addresses added to it in 2^precision bytes.
+// Sketches of the same precision merge into the sketch of the union of their addresses.
+type hyperLogLog struct {
+	precision uint8
+	registers []uint8
+}
+
+func newHyperLogLog(precision int) (*hyperLogLog, error) {
+	if precision < minHLLPrecision || precision > maxHLLPrecision {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidPrecision, precision)
+	}
+	return &hyperLogLog{precision: uint8(precision), registers: make([]uint8, 1<<precision)}, nil
+}
+
+// add records ip32: the top bits of its hash select a register, which keeps the longest run of leading zeros of the rest.
+func (h *hyperLogLog) add(ip32 uint32) bool {
+	return h.addHash(hash32(ip32))
+}
+
+// addHash records a hash of an address and reports whether a register changed.
+func (h *hyperLogLog) addHash(hash uint64) bool {
+	index := hash >> (64 - h.precision)
+	rank := uint8(bits.LeadingZeros64(hash<<h.precision|1<<(h.precision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+		return true
+	}
+	return false
+}
+
+// hashAddr hashes an IPv4 (or IPv4-mapped) address like hash32 and an IPv6 address by mixing its halves.
+func hashAddr(addr netip.Addr) uint64 {
+	if addr = addr.Unmap(); addr.Is4() {
+		a := addr.As4()
+		return hash32(binary.BigEndian.Uint32(a[:]))
+	}
+	a := addr.As16()
+	return mix64(mix64(binary.BigEndian.Uint64(a[:8])+0x9e3779b97f4a7c15) ^ binary.BigEndian.Uint64(a[8:]))
+}
+
+// merge makes h the sketch of the union of both, the precisions have to be equal.
+func (h *hyperLogLog) merge(other *hyperLogLog) {
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// reduce returns the sketch of the same addresses at a lower precision: the index bits that are dropped become
+// the leading bits of the rest of the hash, so the rank either comes from them or grows by their number.
+func (h *hyperLogLog) reduce(precision uint8) *hyperLogLog {
+	d := h.precision - precision
+	reduced := &hyperLogLog{precision: precision, registers: make([]uint8, 1<<precision)}
+	for i, rank := range h.registers {
+		if rank == 0 {
+			continue
+		}
+		if low := uint64(i) & (1<<d - 1); low != 0 {
+			rank = uint8(bits.LeadingZeros64(low<<(64-d))) + 1
+		} else {
+			rank += d
+		}
+		if index := i >> d; rank > reduced.registers[index] {
+			reduced.registers[index] = rank
+		}
+	}
+	return reduced
+}
+
+// estimate returns the estimated number of distinct addresses, small counts use linear counting of the empty registers.
+func (h *hyperLogLog) estimate() int64 {
+	m := float64(len(h.registers))
+	var (
+		sum   float64
+		empty int
+	)
+	for _, rank := range h.registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			empty++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	switch len(h.registers) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	}
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && empty > 0 {
+		estimate = m * math.Log(m/float64(empty))
+	}
+	return int64(math.Round(estimate))
+}
+
+// Sketch is a HyperLogLog sketch of IPv4 and IPv6 addresses that is safe for concurrent use, it estimates the
+// number of distinct addresses in 2^precision bytes.
+type Sketch struct {
+	mu sync.RWMutex
+	h  *hyperLogLog
+}
+
+// NewSketch returns an empty sketch, precision is 4 to 18 (DefaultHLLPrecision for about 0.8% error).
+func NewSketch(precision int) (*Sketch, error) {
+	h, err := newHyperLogLog(precision)
+	if err != nil {
+		return nil, err
+	}
+	return &Sketch{h: h}, nil
+}
+
+// Add records addr and reports whether the sketch changed, the zero Addr is ignored.
+func (s *Sketch) Add(addr netip.Addr) bool {
+	if !addr.IsValid() {
+		return false
+	}
+	hash := hashAddr(addr)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.h.addHash(hash)
+}
+
+// Count returns the estimated number of distinct addresses.
+func (s *Sketch) Count() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.h.estimate()
+}
+
+// Precision returns the precision of the sketch, Merge lowers it to the lowest precision of the sketches.
+func (s *Sketch) Precision() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return int(s.h.precision)
+}
+
+// Merge makes s the sketch of the union of s and others.
+func (s *Sketch) Merge(others ...*Sketch) {
+	for _, other := range others {
+		if other == s {
+			continue
+		}
+		other.mu.RLock()
+		h := &hyperLogLog{precision: other.h.precision, registers: append([]uint8(nil), other.h.registers...)}
+		other.mu.RUnlock() //copied, so two sketches merging into each other don't wait for each other
+
+		s.mu.Lock()
+		switch {
+		case h.precision < s.h.precision:
+			s.h = s.h.reduce(h.precision)
+		case h.precision > s.h.precision:
+			h = h.reduce(s.h.precision)
+		}
+		s.h.merge(h)
+		s.mu.Unlock()
+	}
+}
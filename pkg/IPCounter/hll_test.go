@@ -0,0 +1,84 @@
+package IPCounter
+
+import (
+	"errors"
+	"math"
+	"net/netip"
+	"testing"
+)
+
+func TestHyperLogLog(t *testing.T) {
+	for _, n := range []int{0, 10, 1000, 100000, 1000000} {
+		h, err := newHyperLogLog(DefaultHLLPrecision)
+		if err != nil {
+			t.Fatalf("newHyperLogLog() returned an error: %v", err)
+		}
+		for i := 0; i < n; i++ {
+			h.add(uint32(i) * 2654435761) //distinct, spread over the whole space
+			h.add(uint32(i) * 2654435761)
+		}
+		got := h.estimate()
+		if diff := math.Abs(float64(got - int64(n))); diff > 0.03*float64(n)+1 {
+			t.Errorf("estimate() of %d addresses = %d", n, got)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	a, _ := newHyperLogLog(12)
+	b, _ := newHyperLogLog(12)
+	for i := uint32(0); i < 60000; i++ {
+		if i < 40000 {
+			a.add(i)
+		}
+		if i >= 20000 {
+			b.add(i)
+		}
+	}
+	a.merge(b)
+	if got := a.estimate(); math.Abs(float64(got-60000)) > 0.05*60000 {
+		t.Errorf("estimate() of the merged sketch = %d; want about 60000", got)
+	}
+	if _, err := newHyperLogLog(19); !errors.Is(err, ErrInvalidPrecision) {
+		t.Errorf("newHyperLogLog(19) error = %v; want %v", err, ErrInvalidPrecision)
+	}
+}
+
+func TestHyperLogLogReduce(t *testing.T) {
+	high, _ := newHyperLogLog(14)
+	low, _ := newHyperLogLog(10)
+	for i := uint32(0); i < 50000; i++ {
+		high.add(i * 2654435761)
+		low.add(i * 2654435761)
+	}
+	reduced := high.reduce(10)
+	if reduced.precision != 10 || string(reduced.registers) != string(low.registers) {
+		t.Errorf("reduce(10) isn't the sketch of the same addresses at precision 10")
+	}
+}
+
+func TestSketch(t *testing.T) {
+	a, err := NewSketch(DefaultHLLPrecision)
+	if err != nil {
+		t.Fatalf("NewSketch() returned an error: %v", err)
+	}
+	b, _ := NewSketch(12)
+	for i := uint32(0); i < 20000; i++ {
+		a.Add(addrFrom32(i))
+		addr := netip.AddrFrom16([16]byte{0x20, 0x01, 0x0d, 0xb8, 12: byte(i >> 24), 13: byte(i >> 16), 14: byte(i >> 8), 15: byte(i)})
+		b.Add(addr)
+	}
+	if a.Add(addrFrom32(5)) || a.Add(netip.MustParseAddr("::ffff:0.0.0.5")) {
+		t.Errorf("Add() of an address already added changed the sketch")
+	}
+	if got := b.Count(); math.Abs(float64(got-20000)) > 0.05*20000 {
+		t.Errorf("Count() of IPv6 addresses = %d; want about 20000", got)
+	}
+	a.Merge(b, a)
+	if a.Precision() != 12 {
+		t.Errorf("Precision() after merging a sketch of precision 12 = %d", a.Precision())
+	}
+	if got := a.Count(); math.Abs(float64(got-40000)) > 0.05*40000 {
+		t.Errorf("Count() of the merged sketch = %d; want about 40000", got)
+	}
+}
@@ -0,0 +1,21 @@
+package IPCounter
+
+import (
+	"os"
+	"time"
+)
+
+// fileIdentity is what tells whether a file is still the same file with the same content.
+type fileIdentity struct {
+	size    int64
+	modTime time.Time
+	inode   uint64 //0 when the platform has no inodes
+}
+
+func getFileIdentity(info os.FileInfo) fileIdentity {
+	return fileIdentity{size: info.Size(), modTime: info.ModTime(), inode: inodeOf(info)}
+}
+
+func (f fileIdentity) equal(other fileIdentity) bool {
+	return f.size == other.size && f.modTime.Equal(other.modTime) && f.inode == other.inode
+}
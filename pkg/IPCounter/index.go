@@ -0,0 +1,249 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"net/netip"
+	"os"
+	"sort"
+)
+
+const (
+	indexMagic   = "IPCIDX"
+	indexVersion = 1
+	indexHeader  = 16                           //magic, version, a reserved byte and the count
+	indexEntries = 1 << 16                      //one directory entry per /16
+	indexData    = indexHeader + 8*indexEntries //offset of the first container
+	indexBitmap  = 8192                         //bytes of a bitmap container
+)
+
+var (
+	// ErrIndexCorrupted is returned when an index file fails its checksum or its containers don't add up.
+	ErrIndexCorrupted = errors.New("index is corrupted")
+	// ErrIndexVersion is returned for an index written by a newer format version.
+	ErrIndexVersion = errors.New("unsupported index version")
+)
+
+// Index answers whether an address is in a set without loading it: the file is memory-mapped where the platform
+// allows it and a lookup reads one directory entry and one container, the way roaringSet splits the addresses.
+//
+// The format is little endian: the magic "IPCIDX", the version, a reserved byte and the count as u64, then a
+// directory of 65536 entries, one per /16, of the u32 offset of its container from the end of the directory and
+// the u32 number of addresses in it. A container of up to 4096 addresses is a sorted array of the u16 low halves,
+// a larger one a bitmap of 1024 u64 words. A CRC32 of everything before it ends the file.
+type Index struct {
+	data  []byte
+	count int64
+	close func() error
+}
+
+// BuildIndex counts the unique addresses of the files into an index file at indexPath and returns their number.
+func (ip *IPCounter) BuildIndex(ctx context.Context, indexPath string, paths ...string) (int64, error) {
+	s, err := ip.TakeSnapshot(ctx, SnapshotRoaring, paths...)
+	if err != nil {
+		return 0, err
+	}
+	return s.Count(), s.SaveIndex(indexPath)
+}
+
+// SaveIndex writes the addresses of an exact snapshot to an index file, a sketch returns ErrSnapshotInexact.
+func (s *Snapshot) SaveIndex(path string) error {
+	if s.set == nil {
+		return ErrSnapshotInexact
+	}
+	return writeFileAtomic(path, func(w io.Writer) error {
+		return writeIndex(w, s.set)
+	})
+}
+
+// writeIndex writes set in the format of Index.
+func writeIndex(w io.Writer, set ip4Set) error {
+	r := roaringFromSet(set)
+	hash := crc32.NewIEEE()
+	bw := bufio.NewWriterSize(io.MultiWriter(w, hash), 1<<20)
+	header := make([]byte, indexData)
+	copy(header, indexMagic)
+	header[len(indexMagic)] = indexVersion
+	binary.LittleEndian.PutUint64(header[8:], uint64(r.count()))
+	var offset uint32
+	for i, key := range r.keys {
+		n := r.containers[i].n
+		entry := header[indexHeader+8*int(key):]
+		binary.LittleEndian.PutUint32(entry, offset)
+		binary.LittleEndian.PutUint32(entry[4:], uint32(n))
+		offset += uint32(indexContainerSize(n))
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+	buf := make([]byte, indexBitmap)
+	for _, c := range r.containers {
+		if c.n > roaringArrayMax {
+			clear(buf)
+			c.each(func(low uint16) bool {
+				buf[low>>3] |= 1 << (low & 7) //the bytes of little endian u64 words
+				return true
+			})
+		} else {
+			i := 0
+			c.each(func(low uint16) bool {
+				binary.LittleEndian.PutUint16(buf[2*i:], low)
+				i++
+				return true
+			})
+		}
+		if _, err := bw.Write(buf[:indexContainerSize(c.n)]); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, hash.Sum32())
+}
+
+// indexContainerSize returns the bytes of a container of n addresses.
+func indexContainerSize(n int) int {
+	if n > roaringArrayMax {
+		return indexBitmap
+	}
+	return 2 * n
+}
+
+// OpenIndex maps an index file written by BuildIndex or SaveIndex and checks it, Close releases it.
+func OpenIndex(path string) (*Index, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < indexData+4 {
+		return nil, fmt.Errorf("%s: %w: %d bytes", path, ErrIndexCorrupted, info.Size())
+	}
+	data, unmap, err := mapFile(file, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	x := &Index{data: data, close: unmap}
+	if err = x.check(); err != nil {
+		_ = unmap()
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return x, nil
+}
+
+// check validates the header, the checksum and the directory, so lookups can trust the offsets.
+func (x *Index) check() error {
+	if string(x.data[:len(indexMagic)]) != indexMagic {
+		return fmt.Errorf("%w: bad magic", ErrIndexCorrupted)
+	}
+	if version := x.data[len(indexMagic)]; version == 0 || version > indexVersion {
+		return fmt.Errorf("%w: version %d, this build reads up to version %d", ErrIndexVersion, version, indexVersion)
+	}
+	end := len(x.data) - 4
+	if crc32.ChecksumIEEE(x.data[:end]) != binary.LittleEndian.Uint32(x.data[end:]) {
+		return fmt.Errorf("%w: checksum mismatch", ErrIndexCorrupted)
+	}
+	x.count = int64(binary.LittleEndian.Uint64(x.data[8:]))
+	var (
+		offset int
+		total  int64
+	)
+	for i := 0; i < indexEntries; i++ {
+		start, n := x.entry(uint16(i))
+		if n == 0 {
+			continue
+		}
+		if n > 1<<16 || start != offset { //containers follow each other in the order of the directory
+			return fmt.Errorf("%w: container %d at %d with %d addresses", ErrIndexCorrupted, i, start, n)
+		}
+		offset += indexContainerSize(n)
+		total += int64(n)
+	}
+	if indexData+offset != end || total != x.count {
+		return fmt.Errorf("%w: containers hold %d addresses in %d bytes", ErrIndexCorrupted, total, offset)
+	}
+	return nil
+}
+
+// entry returns the offset of the container of the /16 high from the end of the directory and its number of addresses.
+func (x *Index) entry(high uint16) (int, int) {
+	e := x.data[indexHeader+8*int(high):]
+	return int(binary.LittleEndian.Uint32(e)), int(binary.LittleEndian.Uint32(e[4:]))
+}
+
+// Count returns the number of addresses in the index.
+func (x *Index) Count() int64 {
+	return x.count
+}
+
+// Contains reports whether addr is in the index, IPv4-mapped IPv6 addresses are looked up as IPv4 and other
+// IPv6 addresses are never in it.
+func (x *Index) Contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.Is4() {
+		return false
+	}
+	a := addr.As4()
+	ip32 := binary.BigEndian.Uint32(a[:])
+	offset, n := x.entry(uint16(ip32 >> 16))
+	if n == 0 {
+		return false
+	}
+	container, low := x.data[indexData+offset:], uint16(ip32)
+	if n > roaringArrayMax {
+		return container[low>>3]&(1<<(low&7)) != 0
+	}
+	i := sort.Search(n, func(i int) bool {
+		return binary.LittleEndian.Uint16(container[2*i:]) >= low
+	})
+	return i < n && binary.LittleEndian.Uint16(container[2*i:]) == low
+}
+
+// ContainsBatch looks up every address of addrs, the result at an index answers the address at the same index.
+func (x *Index) ContainsBatch(addrs []netip.Addr) []bool {
+	found := make([]bool, len(addrs))
+	for i, addr := range addrs {
+		found[i] = x.Contains(addr)
+	}
+	return found
+}
+
+// each calls fn with the addresses of the index in ascending order until fn returns false.
+func (x *Index) each(fn func(ip32 uint32) bool) {
+	for high := 0; high < indexEntries; high++ {
+		offset, n := x.entry(uint16(high))
+		container, base := x.data[indexData+offset:], uint32(high)<<16
+		if n > roaringArrayMax {
+			for i, b := range container[:indexBitmap] {
+				for ; b != 0; b &= b - 1 {
+					if !fn(base | uint32(i)<<3 | uint32(bits.TrailingZeros8(b))) {
+						return
+					}
+				}
+			}
+			continue
+		}
+		for i := 0; i < n; i++ {
+			if !fn(base | uint32(binary.LittleEndian.Uint16(container[2*i:]))) {
+				return
+			}
+		}
+	}
+}
+
+// Close unmaps the index, it can't be used afterwards.
+func (x *Index) Close() error {
+	x.data = nil
+	return x.close()
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package IPCounter
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads the file into memory where it isn't memory-mapped.
+func mapFile(file *os.File, size int64) (data []byte, unmap func() error, err error) {
+	data = make([]byte, size)
+	if _, err = io.ReadFull(file, data); err != nil {
+		return nil, nil, err
+	}
+	return data, func() error {
+		return nil
+	}, nil
+}
@@ -0,0 +1,124 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	var data strings.Builder
+	want := map[uint32]bool{}
+	for i := 0; i < 20000; i++ {
+		ip32 := rng.Uint32()
+		if i%2 == 0 {
+			ip32 = 10<<24 | uint32(rng.Intn(1<<16)) //10.0.0.0/16 gets a bitmap container
+		}
+		want[ip32] = true
+		data.WriteString(addrFrom32(ip32).String() + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "ips.idx")
+	count, err := NewIPCounter(1, '\n').BuildIndex(context.Background(), path, writeTempFile(t, data.String()))
+	if err != nil {
+		t.Fatalf("BuildIndex() returned an error: %v", err)
+	}
+	x, err := OpenIndex(path)
+	if err != nil {
+		t.Fatalf("OpenIndex() returned an error: %v", err)
+	}
+	defer x.Close()
+	if count != int64(len(want)) || x.Count() != count {
+		t.Errorf("BuildIndex() = %d, Count() = %d; want %d", count, x.Count(), len(want))
+	}
+	for ip32 := range want {
+		if !x.Contains(addrFrom32(ip32)) {
+			t.Fatalf("Contains(%s) = false; want true", addrFrom32(ip32))
+		}
+	}
+	misses := 0
+	for i := 0; i < 20000; i++ {
+		ip32 := rng.Uint32()
+		if i%2 == 0 {
+			ip32 = 10<<24 | uint32(rng.Intn(1<<16))
+		}
+		if x.Contains(addrFrom32(ip32)) != want[ip32] {
+			t.Fatalf("Contains(%s) = %v; want %v", addrFrom32(ip32), !want[ip32], want[ip32])
+		}
+		if !want[ip32] {
+			misses++
+		}
+	}
+	if misses == 0 {
+		t.Errorf("no lookup of an address outside the index")
+	}
+	addrs := []netip.Addr{netip.MustParseAddr("::ffff:" + addrFrom32(rng.Uint32()).String()), netip.MustParseAddr("2001:db8::1")}
+	for ip32 := range want {
+		addrs[0] = netip.AddrFrom16(addrFrom32(ip32).As16()) //IPv4-mapped
+		break
+	}
+	if got := x.ContainsBatch(addrs); !got[0] || got[1] {
+		t.Errorf("ContainsBatch() = %v; want [true false]", got)
+	}
+	var seen int64
+	x.each(func(ip32 uint32) bool {
+		if !want[ip32] {
+			t.Fatalf("each() returned %s which isn't in the index", addrFrom32(ip32))
+		}
+		seen++
+		return true
+	})
+	if seen != count {
+		t.Errorf("each() returned %d addresses; want %d", seen, count)
+	}
+}
+
+func TestOpenIndexErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ips.idx")
+	if _, err := NewIPCounter(1, '\n').BuildIndex(context.Background(), path, writeTempFile(t, "1.1.1.1\n2.2.2.2\n")); err != nil {
+		t.Fatalf("BuildIndex() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	corrupt := func(i int, b byte) []byte {
+		c := append([]byte(nil), data...)
+		c[i] = b
+		return c
+	}
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "truncated", data: data[:len(data)-1], want: ErrIndexCorrupted},
+		{name: "magic", data: corrupt(0, 'X'), want: ErrIndexCorrupted},
+		{name: "version", data: corrupt(6, indexVersion+1), want: ErrIndexVersion},
+		{name: "checksum", data: corrupt(len(data)-6, 0xff), want: ErrIndexCorrupted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			damaged := filepath.Join(dir, tt.name+".idx")
+			if err := os.WriteFile(damaged, tt.data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := OpenIndex(damaged); !errors.Is(err, tt.want) {
+				t.Errorf("OpenIndex() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+	s, err := NewIPCounter(1, '\n').TakeSnapshot(context.Background(), SnapshotHLL, writeTempFile(t, "1.1.1.1\n"))
+	if err != nil {
+		t.Fatalf("TakeSnapshot() returned an error: %v", err)
+	}
+	if err = s.SaveIndex(filepath.Join(dir, "hll.idx")); !errors.Is(err, ErrSnapshotInexact) {
+		t.Errorf("SaveIndex() of a sketch error = %v; want %v", err, ErrSnapshotInexact)
+	}
+}
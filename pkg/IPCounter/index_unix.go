@@ -0,0 +1,20 @@
+//go:build unix
+
+package IPCounter
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// mapFile maps size bytes of file read-only, the mapping outlives the file and is released by unmap.
+func mapFile(file *os.File, size int64) (data []byte, unmap func() error, err error) {
+	data, err = unix.Mmap(int(file.Fd()), 0, int(size), unix.PROT_READ, unix.MAP_SHARED)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, func() error {
+		return unix.Munmap(data)
+	}, nil
+}
@@ -2,13 +2,15 @@ package IPCounter
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"golang.org/x/sync/errgroup"
 	"io"
+	"log/slog"
 	"net"
-	"os"
 	"runtime"
+	"sync/atomic"
 	"time"
 )
 
@@ -24,10 +26,60 @@ type IPCounter struct {
 	fileSize      int64
 	maxGoroutines int64
 	lineBreak     byte
+	readMode      ReadMode
+	appliedMode   ReadMode
+	limiter       *rateLimiter
+	retryPolicy   RetryPolicy
+	networkFS     bool
+	retries       atomic.Int64
+	identity      fileIdentity
+	stats         Stats
+
+	checkpointPath     string
+	checkpointInterval time.Duration
+	resume             bool
+	resumeFrom         *checkpoint
+	checkpoints        int
+	checkpointErr      error
+
+	partialResult bool
+	covered       []Range
+
+	sharedLock   bool
+	changeCheck  ChangeCheck
+	inputChanged *InputChangedError
+
+	keepSet bool   //readers leave the set of addresses in set, for the APIs that need more than the count
+	set     ip4Set //set of the last scan when keepSet is on
+
+	progress          scanProgress
+	onProgress        func(Progress)
+	metrics           *Metrics
+	tracer            Tracer
+	logger            *slog.Logger
+	registry          []RegistryEntry
+	classifier        *classifier
+	excludeCategories []string
+	categoryFilter    *addrFilter
+	includeLists      []cidrList
+	excludeLists      []cidrList
+	filters           []*addrFilter //run on every parsed address before it reaches the set
+	filtersReady      bool
+	filtersHash       uint64 //of the filter options, stored in checkpoints
+	progressInterval  time.Duration
+	hllPrecision      int
+
+	followPoll    time.Duration
+	watchPoll     time.Duration
+	completeLines bool //scans stop after the last line break, Follow reads the unterminated rest as it is written
 }
 
-func NewIPCounter(maxGoroutines int64, lineBreak byte) *IPCounter {
-	return &IPCounter{maxGoroutines: maxGoroutines, lineBreak: lineBreak, fileSize: 0, file: nil}
+func NewIPCounter(maxGoroutines int64, lineBreak byte, opts ...Option) *IPCounter {
+	ip := &IPCounter{maxGoroutines: maxGoroutines, lineBreak: lineBreak, fileSize: 0, file: nil, limiter: newRateLimiter(0), hllPrecision: DefaultHLLPrecision}
+	for _, opt := range opts {
+		opt(ip)
+	}
+	return ip
 }
 
 func (ip *IPCounter) GetMaxGoroutines() int64 {
@@ -38,6 +90,44 @@ func (ip *IPCounter) GetFileSize() int64 {
 	return ip.fileSize
 }
 
+func (ip *IPCounter) GetReadMode() ReadMode {
+	return ip.readMode
+}
+
+// GetReadLimit returns the read bandwidth limit in bytes per second, 0 means unlimited.
+func (ip *IPCounter) GetReadLimit() int64 {
+	return ip.limiter.getRate()
+}
+
+// SetReadLimit changes the read bandwidth limit in bytes per second shared by all reader goroutines.
+// It is safe to call while UniqueIP4 is running, 0 disables the limit.
+func (ip *IPCounter) SetReadLimit(bytesPerSecond int64) {
+	ip.limiter.setRate(bytesPerSecond)
+}
+
+// GetAppliedReadMode returns the read mode the last scan actually used, it differs from GetReadMode
+// when the platform or filesystem doesn't support the requested one.
+func (ip *IPCounter) GetAppliedReadMode() ReadMode {
+	return ip.appliedMode
+}
+
+// lastLineEnd returns the offset after the last line break of the first size bytes, 0 without one.
+func lastLineEnd(reader fileReader, size int64, lineBreak byte) (int64, error) {
+	buf := make([]byte, 4096)
+	for end := size; end > 0; {
+		start := max(end-int64(len(buf)), 0)
+		n, err := reader.ReadAt(buf[:end-start], start)
+		if err != nil && !(errors.Is(err, io.EOF) && int64(n) == end-start) {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf[:n], lineBreak); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+		end = start
+	}
+	return 0, nil
+}
+
 // correctOffset adjusts the offset to ensure it aligns with the line break character.
 func (ip *IPCounter) correctOffset(offset *int64, buffer []byte) {
 	if len(buffer) > 0 && buffer[len(buffer)-1] != ip.lineBreak {
@@ -54,8 +144,55 @@ func (ip *IPCounter) UniqueIP4(ctx context.Context, path string) (int64, error)
 	if err := checkContext(ctx); err != nil {
 		return 0, err
 	}
-	file, _err := os.Open(path) // Can another process write it, do we need the shared flock?
+	ctx, span := ip.startSpan(ctx, "ipcounter.UniqueIP4", Attr("path", path))
+	uniqueCount, err := ip.uniqueIP4(ctx, path)
+	span.SetAttributes(Attr("file.size", ip.fileSize), Attr("goroutines", ip.maxGoroutines), Attr("unique", uniqueCount))
+	endSpan(span, err)
+	ip.logScan(ctx, path, uniqueCount, err)
+	return uniqueCount, err
+}
+
+// uniqueIP4 is UniqueIP4 inside its trace span.
+func (ip *IPCounter) uniqueIP4(ctx context.Context, path string) (int64, error) {
+	start := time.Now()
+	ip.limiter.resetThrottled()
+	ip.retries.Store(0)
+	ip.checkpoints = 0
+	ip.checkpointErr = nil
+	ip.resumeFrom = nil
+	ip.covered = nil
+	ip.inputChanged = nil
+	ip.set = nil
+	ip.progress.reset()
+	if err := ip.prepareFilters(); err != nil {
+		return 0, err
+	}
+	ip.resetFilters()
+	defer func() {
+		invalid := ip.progress.invalidCounts()
+		ip.stats = Stats{
+			Duration:        time.Since(start),
+			ValidLines:      ip.progress.valid.Load(),
+			InvalidLines:    invalid.total(),
+			InvalidByReason: invalid.byName(),
+			Rejected:        ip.rejectedCounts(),
+			ThrottledTime:   ip.limiter.throttledTime(),
+			Retries:         ip.retries.Load(),
+			Resumed:         ip.resumeFrom != nil,
+			Checkpoints:     ip.checkpoints,
+			CheckpointError: ip.checkpointErr,
+			CoveredRanges:   ip.covered,
+			BytesCovered:    rangesLength(ip.covered),
+			InputChanged:    ip.inputChanged,
+			Partial:         ip.covered != nil && (len(ip.covered) != 1 || ip.covered[0].End-ip.covered[0].Start != ip.fileSize),
+		}
+		ip.stats.Lines = ip.stats.ValidLines + ip.stats.InvalidLines
+		ip.resumeFrom = nil
+	}()
+	_, openSpan := ip.startSpan(ctx, "ipcounter.open", Attr("path", path))
+	file, reader, mode, _err := openFile(path, ip.readMode)
 	if _err != nil {
+		endSpan(openSpan, _err)
 		return 0, _err
 	}
 	var (
@@ -67,18 +204,91 @@ func (ip *IPCounter) UniqueIP4(ctx context.Context, path string) (int64, error)
 			err = errors.Join(err, closeErr)
 		}
 	}()
-	size, sizeErr := getFileSize(file)
-	if sizeErr != nil {
-		return 0, sizeErr
+	if ip.sharedLock { //writers that take an exclusive lock have to wait until the scan ends
+		if lockErr := lockShared(ctx, file); lockErr != nil {
+			endSpan(openSpan, lockErr)
+			return 0, lockErr
+		}
+		defer unlock(file)
+	}
+	info, statErr := file.Stat()
+	if statErr != nil {
+		endSpan(openSpan, statErr)
+		return 0, statErr
+	}
+	openSpan.SetAttributes(Attr("read_mode", mode.String()), Attr("file.size", info.Size()))
+	openSpan.End()
+	if ip.metrics != nil {
+		reader = &measuredReader{reader: reader, metrics: ip.metrics}
+	}
+	ip.file = reader
+	ip.appliedMode = mode
+	ip.networkFS = isNetworkFilesystem(file)
+	ip.fileSize = info.Size()
+	ip.identity = getFileIdentity(info)
+	if ip.completeLines {
+		if ip.fileSize, err = lastLineEnd(reader, ip.fileSize, ip.lineBreak); err != nil {
+			return 0, err
+		}
+	}
+	if ip.resume && ip.checkpointPath != "" {
+		if ip.resumeFrom, err = ip.loadCheckpoint(ip.identity); err != nil {
+			return 0, err
+		}
+	}
+	if ip.resumeFrom != nil {
+		if ip.resumeFrom.sequential {
+			ip.maxGoroutines = 1
+		} else {
+			ip.maxGoroutines = int64(len(ip.resumeFrom.positions))
+		}
+	} else {
+		_, planSpan := ip.startSpan(ctx, "ipcounter.getGoroutinesCount", Attr("file.size", ip.fileSize))
+		ip.maxGoroutines = ip.getGoroutinesCount()
+		planSpan.SetAttributes(Attr("goroutines", ip.maxGoroutines), Attr("network_fs", ip.networkFS))
+		planSpan.End()
+	}
+	ip.log().InfoContext(ctx, "scan strategy",
+		slog.String("path", path),
+		slog.Int64("file_size", ip.fileSize),
+		slog.Int64("goroutines", ip.maxGoroutines),
+		slog.Bool("sequential", ip.maxGoroutines <= 1),
+		slog.String("read_mode", ip.readMode.String()),
+		slog.String("applied_read_mode", mode.String()),
+		slog.Bool("network_fs", ip.networkFS),
+		slog.Bool("resumed", ip.resumeFrom != nil))
+	var startBytes int64
+	if ip.resumeFrom != nil {
+		startBytes = rangesLength(ip.resumeFrom.coveredRanges())
+	}
+	stopProgress := ip.startProgress(start, startBytes)
+	if ip.metrics != nil {
+		ip.metrics.scans.Add(1)
+		ip.metrics.workers.Add(ip.maxGoroutines)
 	}
-	ip.file = file
-	ip.fileSize = size
-	ip.maxGoroutines = ip.getGoroutinesCount()
 	if ip.maxGoroutines > 1 { //use goroutines
 		uniqueCount, err = ip.ip4multipleReaders(ctx)
 	} else {
 		uniqueCount, err = ip.ip4SequentialReader(ctx)
 	}
+	stopProgress()
+	if ip.metrics != nil {
+		ip.metrics.workers.Add(-ip.maxGoroutines)
+	}
+	if ip.changeCheck != ChangeCheckOff {
+		if changed := checkUnchanged(path, file, ip.identity); changed != nil {
+			ip.inputChanged = changed
+			if ip.changeCheck == ChangeCheckFail {
+				return 0, errors.Join(err, changed)
+			}
+		}
+	}
+	if err == nil {
+		ip.covered = []Range{{Start: 0, End: ip.fileSize}}
+		if ip.checkpointPath != "" {
+			err = ip.removeCheckpoint()
+		}
+	}
 	return uniqueCount, err
 }
 
@@ -89,14 +299,19 @@ func (ip *IPCounter) UniqueIP6(ctx context.Context, path string) (int64, error)
 
 // ip4SequentialReader reads IPv4 addresses sequentially from the file and counts unique addresses.
 func (ip *IPCounter) ip4SequentialReader(ctx context.Context) (int64, error) {
-	const mb512 int64 = (256 * 256 * 256 * 256) / 8 //512mb
+	const mb512 int64 = bitmapSize
 	var (
 		capacity        int64
 		uniqueCount     int64
-		ipsWithIndex    []byte
+		offset          int64
+		lines           int
+		valid           int64
+		invalid         invalidCounts
+		ipsWithIndex    ip4Bitmap
 		ipsWithOutIndex []uint32
 		line            []byte
 		err             error
+		sampler         lineSampler
 	)
 	if ip.fileSize <= mb512 {
 		capacity = ip.fileSize / 8 //min length of ip is 7 bytes + new line
@@ -105,77 +320,181 @@ func (ip *IPCounter) ip4SequentialReader(ctx context.Context) (int64, error) {
 		}
 		ipsWithOutIndex = make([]uint32, 0, capacity)
 	} else {
-		ipsWithIndex = make([]byte, mb512)
+		ipsWithIndex = newIP4Bitmap()
+	}
+	if cp := ip.resumeFrom; cp != nil {
+		offset = cp.progress[0]
+		if cp.bitmap != nil {
+			capacity = 0
+			ipsWithIndex = cp.bitmap
+			ipsWithOutIndex = nil
+			uniqueCount = cp.uniqueCount
+		} else {
+			ipsWithOutIndex = append(ipsWithOutIndex, cp.ips...)
+		}
+	}
+	// snapshot returns the state to resume from offset, it shares the set with the reader.
+	snapshot := func() *checkpoint {
+		return &checkpoint{
+			identity:    ip.identity,
+			lineBreak:   ip.lineBreak,
+			filters:     ip.filtersHash,
+			sequential:  true,
+			uniqueCount: uniqueCount,
+			positions:   []int64{ip.fileSize},
+			progress:    []int64{offset},
+			bitmap:      ipsWithIndex,
+			ips:         ipsWithOutIndex,
+		}
 	}
+	lastCheckpoint := time.Now()
 	chunkSize := int(ip.fileSize)
 	if ip.fileSize > 65536 {
 		chunkSize = 65536
 	}
-	reader := bufio.NewReaderSize(ip.file, chunkSize)
+	file := ip.throttledFile(ctx)
+	var source io.Reader = file
+	if offset > 0 || ip.completeLines {
+		source = io.NewSectionReader(file, offset, ip.fileSize-offset)
+	}
+	reader := bufio.NewReaderSize(source, chunkSize)
 	for {
 		if checkContext(ctx) != nil {
-			return 0, ctx.Err()
+			ip.progress.publish(offset, valid, &invalid, uniqueCount)
+			return ip.stop(ctx.Err(), snapshot())
 		}
-		for j := 0; j < 3; j++ { //Retry reading up to 3 times
-			line, err = reader.ReadBytes(ip.lineBreak)
-			if err == nil || errors.Is(err, io.EOF) {
-				break
-			}
-			if j == 2 {
-				return 0, err
-			}
-			time.Sleep(10 * time.Millisecond) // Retry delay
+		err = ip.retry(ctx, func() error {
+			var readErr error
+			line, readErr = reader.ReadBytes(ip.lineBreak)
+			return readErr
+		})
+		if err != nil && !errors.Is(err, io.EOF) {
+			ip.progress.publish(offset, valid, &invalid, uniqueCount)
+			return ip.stop(err, snapshot())
+		}
+		lineStart := offset
+		offset += int64(len(line))
+		if len(line) > 0 && line[len(line)-1] == ip.lineBreak {
+			line = line[:len(line)-1]
 		}
 		if len(line) > 0 {
-			if line[len(line)-1] == ip.lineBreak {
-				line = line[:len(line)-1]
-			}
 			ip32, err2 := ip4BytesToUint32(line)
-			if err2 == nil { //should be logged?
-				if capacity == 0 {
-					index := ip32 >> 3    //bitwise 3 shift right is the same as divide 8 without remainder(/8)
-					byteIndex := ip32 & 7 //the same as divide 8 with remainder(%8)
-					if ipsWithIndex[index]&(1<<byteIndex) == 0 {
-						ipsWithIndex[index] |= 1 << byteIndex
+			if err2 == nil {
+				valid++
+				switch {
+				case ip.filters != nil && !ip.allowed(ip32): //dropped by a filter
+				case capacity == 0:
+					if ipsWithIndex.add(ip32) {
 						uniqueCount++
 					}
-				} else {
+				default:
 					ipsWithOutIndex = append(ipsWithOutIndex, ip32)
 				}
+			} else {
+				invalid[invalidReasonOf(err2)]++
+				ip.logInvalid(ctx, &sampler, line, err2, slog.Int64("offset", lineStart))
 			}
 		}
 		if errors.Is(err, io.EOF) {
 			break
 		}
+		lines++
+		if lines&4095 == 0 { //don't ask the clock for every line
+			ip.progress.publish(offset, valid, &invalid, uniqueCount)
+			if ip.checkpointDue(lastCheckpoint) {
+				ip.periodicCheckpoint(snapshot())
+				lastCheckpoint = time.Now()
+			}
+		}
 	}
-	if len(ipsWithOutIndex) > 0 {
+	ip.progress.publish(offset, valid, &invalid, uniqueCount)
+	switch {
+	case ip.keepSet && ipsWithIndex != nil:
+		ip.set = &bitmapSet{bits: ipsWithIndex, n: uniqueCount}
+	case ip.keepSet:
+		ip.set = newSortedSet(ipsWithOutIndex)
+		uniqueCount = ip.set.count()
+	case len(ipsWithOutIndex) > 0:
+		_, sortSpan := ip.startSpan(ctx, "ipcounter.ip4SortCount", Attr("addresses", len(ipsWithOutIndex)))
 		uniqueCount = ip4SortCount(ipsWithOutIndex)
+		sortSpan.SetAttributes(Attr("unique", uniqueCount))
+		sortSpan.End()
 	}
+	ip.progress.setUnique(uniqueCount)
 	return uniqueCount, nil
 }
 
+// chunkMessage is sent by goroutineReader to the consumer, it carries either a line
+// or, when line is nil, a progress mark: every line of the chunk before offset has already been sent.
+type chunkMessage struct {
+	line   []byte
+	chunk  int
+	offset int64
+}
+
 // ip4multipleReaders uses multiple goroutines to read IPv4 addresses in parallel and counts unique addresses.
 func (ip *IPCounter) ip4multipleReaders(ctx context.Context) (int64, error) {
-	positions, err := ip.getPositions(ctx, maxLengthIp4)
-	if err != nil {
-		return 0, err
-	}
 	var (
-		ips         [(256 * 256 * 256 * 256) / 8]byte //512mb
+		positions   []int64
+		progress    []int64
+		ips         ip4Bitmap
 		uniqueCount int64
+		err         error
 	)
-	ch := make(chan []byte, 255*255) //todo need to understand what size should have buffer
+	if cp := ip.resumeFrom; cp != nil {
+		positions, progress, ips, uniqueCount = cp.positions, cp.progress, cp.bitmap, cp.uniqueCount
+	} else {
+		_, planSpan := ip.startSpan(ctx, "ipcounter.getPositions", Attr("file.size", ip.fileSize), Attr("goroutines", ip.maxGoroutines))
+		positions, err = ip.getPositions(ctx, maxLengthIp4)
+		planSpan.SetAttributes(Attr("chunks", len(positions)))
+		endSpan(planSpan, err)
+		if err != nil {
+			return 0, err
+		}
+		if ip.log().Enabled(ctx, slog.LevelDebug) {
+			for i := range positions {
+				start := int64(0)
+				if i > 0 {
+					start = positions[i-1]
+				}
+				ip.log().DebugContext(ctx, "chunk planned", slog.Int("chunk", i), slog.Int64("start", start), slog.Int64("end", positions[i]))
+			}
+		}
+		progress = make([]int64, len(positions))
+		for i := 1; i < len(positions); i++ {
+			progress[i] = positions[i-1]
+		}
+		ips = newIP4Bitmap()
+	}
+	snapshot := func() *checkpoint {
+		return &checkpoint{
+			identity:    ip.identity,
+			lineBreak:   ip.lineBreak,
+			filters:     ip.filtersHash,
+			uniqueCount: uniqueCount,
+			positions:   positions,
+			progress:    progress,
+			bitmap:      ips,
+		}
+	}
+	ch := make(chan chunkMessage, 255*255) //todo need to understand what size should have buffer
 	errsGroup, erCtx := errgroup.WithContext(ctx)
 	errsGroup.SetLimit(len(positions))
 
 	for i := 0; i < len(positions); i++ {
 		i := i
-		var offset int64
-		if i > 0 {
-			offset = positions[i-1]
+		offset := progress[i]
+		if offset >= positions[i] { //completed before resume
+			continue
 		}
 		errsGroup.Go(func() error {
-			return ip.goroutineReader(erCtx, offset, positions[i], ch, maxLengthIp4)
+			workerCtx, span := ip.startSpan(erCtx, "ipcounter.worker", Attr("chunk", i), Attr("range.start", offset), Attr("range.end", positions[i]))
+			workerStart := time.Now()
+			workerErr := ip.goroutineReader(workerCtx, i, offset, positions[i], ch, maxLengthIp4)
+			endSpan(span, workerErr)
+			ip.log().DebugContext(ctx, "chunk done", slog.Int("chunk", i), slog.Int64("start", offset), slog.Int64("end", positions[i]),
+				slog.Duration("duration", time.Since(workerStart)), slog.Any("error", workerErr))
+			return workerErr
 		})
 	}
 
@@ -184,23 +503,62 @@ func (ip *IPCounter) ip4multipleReaders(ctx context.Context) (int64, error) {
 		close(ch)
 	}()
 
+	var (
+		bytesDone      int64
+		valid          int64
+		invalid        invalidCounts
+		sampler        lineSampler
+		lastCheckpoint = time.Now()
+	)
+	_, mergeSpan := ip.startSpan(ctx, "ipcounter.merge", Attr("chunks", len(positions)))
+	defer func() {
+		mergeSpan.SetAttributes(Attr("bytes", bytesDone), Attr("lines.valid", valid), Attr("lines.invalid", invalid.total()), Attr("unique", uniqueCount))
+		endSpan(mergeSpan, err)
+	}()
+	for i := range positions {
+		if i == 0 {
+			bytesDone += progress[i]
+		} else {
+			bytesDone += progress[i] - positions[i-1]
+		}
+	}
 	for v := range ch {
-		ip32, err2 := ip4BytesToUint32(v)
-		if err2 != nil { //should be logged?
+		if v.line == nil {
+			bytesDone += v.offset - progress[v.chunk]
+			progress[v.chunk] = v.offset
+			ip.progress.publish(bytesDone, valid, &invalid, uniqueCount)
+			if ip.checkpointDue(lastCheckpoint) {
+				ip.periodicCheckpoint(snapshot())
+				lastCheckpoint = time.Now()
+			}
 			continue
 		}
-		index := ip32 >> 3    //bitwise 3 shift right is the same as divide 8 without remainder(/8)
-		byteIndex := ip32 & 7 //the same as divide 8 with remainder(%8)
-		if ips[index]&(1<<byteIndex) == 0 {
-			ips[index] |= 1 << byteIndex
+		ip32, err2 := ip4BytesToUint32(v.line)
+		if err2 != nil {
+			invalid[invalidReasonOf(err2)]++
+			ip.logInvalid(ctx, &sampler, v.line, err2, slog.Int("chunk", v.chunk))
+			continue
+		}
+		valid++
+		if ip.filters != nil && !ip.allowed(ip32) {
+			continue
+		}
+		if ips.add(ip32) {
 			uniqueCount++
 		}
 	}
-	return uniqueCount, err
+	ip.progress.publish(bytesDone, valid, &invalid, uniqueCount)
+	if err != nil {
+		return ip.stop(err, snapshot())
+	}
+	if ip.keepSet {
+		ip.set = &bitmapSet{bits: ips, n: uniqueCount}
+	}
+	return uniqueCount, nil
 }
 
-// goroutineReader reads bytes from the file in a goroutine and sends IPv4 addresses to the channel.
-func (ip *IPCounter) goroutineReader(ctx context.Context, offset int64, limit int64, ch chan []byte, wordMaxLen64 int64) error {
+// goroutineReader reads bytes of the chunk from offset to limit in a goroutine and sends IPv4 addresses to the channel.
+func (ip *IPCounter) goroutineReader(ctx context.Context, chunk int, offset int64, limit int64, ch chan chunkMessage, wordMaxLen64 int64) error {
 	maxBytes := limit - offset
 	chunkSize := maxBytes
 	if maxBytes > 65536 {
@@ -208,6 +566,7 @@ func (ip *IPCounter) goroutineReader(ctx context.Context, offset int64, limit in
 	}
 	buffer := make([]byte, chunkSize)
 	str := make([]byte, wordMaxLen64)
+	file := ip.throttledFile(ctx)
 	var (
 		maxSize   int64
 		i         int64
@@ -220,15 +579,13 @@ func (ip *IPCounter) goroutineReader(ctx context.Context, offset int64, limit in
 		if checkContext(ctx) != nil {
 			return ctx.Err()
 		}
-		for j := 0; j < 3; j++ { // Retry reading up to 3 times
-			bytesRead, err = ip.file.ReadAt(buffer, offset)
-			if err == nil || errors.Is(err, io.EOF) {
-				break
-			}
-			if j == 2 {
-				return err
-			}
-			time.Sleep(10 * time.Millisecond) // Retry delay
+		err = ip.retry(ctx, func() error {
+			var readErr error
+			bytesRead, readErr = file.ReadAt(buffer, offset)
+			return readErr
+		})
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
 		}
 
 		offset += chunkSize
@@ -246,10 +603,10 @@ func (ip *IPCounter) goroutineReader(ctx context.Context, offset int64, limit in
 		for i = 0; i < maxSize; i++ {
 			if buffer[i] == ip.lineBreak || i == maxSize-1 {
 				if k > 0 {
-					ch <- append([]byte(nil), str[:k]...)
+					ch <- chunkMessage{line: append([]byte(nil), str[:k]...), chunk: chunk}
 					k = 0
 				}
-			} else if buffer[i] != ' ' {
+			} else if buffer[i] != ' ' && k < wordMaxLen64 { //longer lines can't be an ip anyway
 				str[k] = buffer[i]
 				k++
 			}
@@ -258,10 +615,14 @@ func (ip *IPCounter) goroutineReader(ctx context.Context, offset int64, limit in
 				break
 			}
 		}
+		if maxBytes > 0 && offset < limit && !errors.Is(err, io.EOF) {
+			ch <- chunkMessage{chunk: chunk, offset: offset}
+		}
 		if errors.Is(err, io.EOF) {
 			break
 		}
 	}
+	ch <- chunkMessage{chunk: chunk, offset: limit}
 	return nil
 }
 
@@ -297,7 +658,7 @@ func (ip *IPCounter) getPositions(ctx context.Context, wordMaxLen uint) ([]int64
 		i      int64
 	)
 	maxGoroutine := ip.GetMaxGoroutines()
-	file := ip.file
+	file := ip.throttledFile(ctx)
 	fileSize := ip.fileSize
 	chunkSize := fileSize / maxGoroutine
 	buffer := make([]byte, wordMaxLen)
@@ -311,15 +672,12 @@ func (ip *IPCounter) getPositions(ctx context.Context, wordMaxLen uint) ([]int64
 		if i == maxGoroutine-1 || offset > fileSize {
 			offset = fileSize
 		}
-		for k := 0; k < 3; k++ { // Retry reading up to 3 times
-			_, err = file.ReadAt(buffer, offset)
-			if err == nil || errors.Is(err, io.EOF) {
-				break
-			}
-			if k == 2 {
-				return nil, err
-			}
-			time.Sleep(20 * time.Millisecond) // Retry delay
+		err = ip.retry(ctx, func() error {
+			_, readErr := file.ReadAt(buffer, offset)
+			return readErr
+		})
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
 		}
 		isEndFile := errors.Is(err, io.EOF)
 		if !isEndFile {
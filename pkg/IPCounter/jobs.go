@@ -0,0 +1,563 @@
+package IPCounter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JobKind is what a job of a JobServer computes.
+type JobKind string
+
+const (
+	// JobCount counts the unique addresses of all paths together.
+	JobCount JobKind = "count"
+	// JobExport writes the unique addresses of one path, or of a set operation over several, for download.
+	JobExport JobKind = "export"
+	// JobDiff compares the sets of several paths like CompareSets.
+	JobDiff JobKind = "diff"
+)
+
+// JobStatus is the state of a job, queued jobs wait for a slot and for their memory.
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobDone      JobStatus = "done"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+var (
+	// ErrInvalidJob is returned by Submit for a request that can't run, e.g. a missing file or an unknown kind.
+	ErrInvalidJob = errors.New("invalid job")
+	// ErrJobNotFound is returned for an unknown or pruned job id.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobNotDone is returned when the result of a job that hasn't finished is asked for.
+	ErrJobNotDone = errors.New("job isn't done")
+	// ErrOutsideRoot is returned by ResolvePath for a path that leaves the root.
+	ErrOutsideRoot = errors.New("path outside the root")
+)
+
+// JobRequest describes a job over files local to the server.
+type JobRequest struct {
+	Kind   JobKind  `json:"kind"`
+	Paths  []string `json:"paths"`
+	Op     string   `json:"op,omitempty"`     // set operation of an export of several paths, union by default
+	Format string   `json:"format,omitempty"` // export format, text by default
+}
+
+// JobProgress is the progress of the scan a job is in, scans of several paths run one after another.
+type JobProgress struct {
+	File           int   `json:"file"` // index of the path being scanned
+	Files          int   `json:"files"`
+	BytesProcessed int64 `json:"bytes_processed"`
+	TotalBytes     int64 `json:"total_bytes"`
+	UniqueCount    int64 `json:"unique_count"`
+}
+
+// JobResult is the result of a finished job.
+type JobResult struct {
+	Count      int64          `json:"count"`                // unique addresses of a count, addresses written by an export, the union of a diff
+	Comparison *SetComparison `json:"comparison,omitempty"` // set sizes of a diff
+}
+
+// Job is the state of a submitted job.
+type Job struct {
+	ID        string      `json:"id"`
+	Request   JobRequest  `json:"request"`
+	Status    JobStatus   `json:"status"`
+	Memory    int64       `json:"memory"` // estimated bytes the job holds while it runs
+	Progress  JobProgress `json:"progress"`
+	Submitted time.Time   `json:"submitted"`
+	Started   *time.Time  `json:"started,omitempty"`
+	Finished  *time.Time  `json:"finished,omitempty"`
+	Result    *JobResult  `json:"result,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// JobConfig configures a JobServer.
+type JobConfig struct {
+	Concurrency  int           // jobs running at once, 1 when 0
+	MemoryBudget int64         // estimated bytes of all running jobs, 0 means no limit; a larger job runs alone
+	Goroutines   int64         // reader goroutines of every scan
+	Root         string        // when set, the paths of jobs have to be inside this directory
+	ResultDir    string        // directory of the export files, a temporary one when empty
+	Retention    time.Duration // finished jobs are forgotten after this long, 1h when 0
+}
+
+// JobServer runs count, export and diff jobs in the background, in submission order as slots and memory free up.
+// Every job gets its own IPCounter built with the options of NewJobServer.
+type JobServer struct {
+	config JobConfig
+	opts   []Option
+	run    func(ctx context.Context, j *job) (*JobResult, error)
+
+	mu      sync.Mutex
+	jobs    map[string]*job
+	queue   []*job
+	running int
+	memory  int64
+	nextID  int
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+type job struct {
+	Job
+	cancel context.CancelFunc
+	output string //export file
+}
+
+// NewJobServer returns a server running jobs with config, opts are applied to the IPCounter of every job.
+func NewJobServer(config JobConfig, opts ...Option) (*JobServer, error) {
+	config.Concurrency = max(config.Concurrency, 1)
+	if config.Retention <= 0 {
+		config.Retention = time.Hour
+	}
+	if config.ResultDir == "" {
+		dir, err := os.MkdirTemp("", "ip-counter-jobs")
+		if err != nil {
+			return nil, err
+		}
+		config.ResultDir = dir
+	} else if err := os.MkdirAll(config.ResultDir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &JobServer{config: config, opts: opts, jobs: make(map[string]*job)}
+	s.run = s.runJob
+	return s, nil
+}
+
+// Submit validates req and queues it, the job starts when a slot and its memory are free.
+func (s *JobServer) Submit(req JobRequest) (Job, error) {
+	memory, err := s.check(&req)
+	if err != nil {
+		return Job{}, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return Job{}, fmt.Errorf("%w: the server is closed", ErrInvalidJob)
+	}
+	s.prune()
+	s.nextID++
+	j := &job{Job: Job{
+		ID:        strconv.Itoa(s.nextID),
+		Request:   req,
+		Status:    JobQueued,
+		Memory:    memory,
+		Progress:  JobProgress{Files: len(req.Paths)},
+		Submitted: time.Now(),
+	}}
+	s.jobs[j.ID] = j
+	s.queue = append(s.queue, j)
+	s.schedule()
+	return j.Job, nil
+}
+
+// check validates req, fills in its defaults and returns the memory the job is estimated to hold. A scan holds at
+// most the 512mb bitmap and a small file about 4 bytes for each of its lines of at least 8 bytes.
+func (s *JobServer) check(req *JobRequest) (int64, error) {
+	switch {
+	case len(req.Paths) == 0:
+		return 0, errors.New("no paths")
+	case req.Kind == JobDiff && len(req.Paths) < 2:
+		return 0, errors.New("a diff needs at least two paths")
+	case req.Kind == JobExport:
+		if req.Format == "" {
+			req.Format = ExportText.String()
+		}
+		if _, err := ParseExportFormat(req.Format); err != nil {
+			return 0, err
+		}
+		if len(req.Paths) > 1 && req.Op == "" {
+			req.Op = SetUnion.String()
+		}
+		if len(req.Paths) > 1 {
+			if _, err := ParseSetOp(req.Op); err != nil {
+				return 0, err
+			}
+		}
+	case req.Kind != JobCount && req.Kind != JobDiff:
+		return 0, fmt.Errorf("unknown kind %q", req.Kind)
+	}
+	var memory int64
+	paths := make([]string, len(req.Paths)) //the caller keeps its slice
+	for i, path := range req.Paths {
+		path, err := ResolvePath(s.config.Root, path)
+		if err != nil {
+			return 0, err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return 0, err
+		}
+		if !info.Mode().IsRegular() {
+			return 0, fmt.Errorf("%s isn't a regular file", path)
+		}
+		paths[i] = path
+		memory += min(bitmapSize, info.Size()/2)
+	}
+	req.Paths = paths
+	return memory, nil
+}
+
+// ResolvePath returns the absolute path of a path a client names, with a root relative paths are inside it and
+// the path (with its symlinks resolved) has to stay inside it. An empty root allows every path.
+func ResolvePath(root, path string) (string, error) {
+	if root != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil || root == "" {
+		return path, err
+	}
+	root, err = filepath.Abs(root)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s is outside %s", ErrOutsideRoot, path, root)
+	}
+	return path, nil
+}
+
+// schedule starts the queued jobs in order while a slot and their memory are free, s.mu is held.
+func (s *JobServer) schedule() {
+	for len(s.queue) > 0 && s.running < s.config.Concurrency {
+		j := s.queue[0]
+		if s.running > 0 && s.config.MemoryBudget > 0 && s.memory+j.Memory > s.config.MemoryBudget {
+			return //the head waits, later jobs don't overtake it
+		}
+		s.queue = s.queue[1:]
+		s.running++
+		s.memory += j.Memory
+		ctx, cancel := context.WithCancel(context.Background())
+		j.cancel = cancel
+		j.Status = JobRunning
+		now := time.Now()
+		j.Started = &now
+		s.wg.Add(1)
+		go s.execute(ctx, j)
+	}
+}
+
+// execute runs a job and records its outcome.
+func (s *JobServer) execute(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	result, err := s.run(ctx, j)
+	j.cancel()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	j.Finished = &now
+	switch {
+	case err == nil:
+		j.Status, j.Result = JobDone, result
+	case errors.Is(err, context.Canceled):
+		j.Status, j.Error = JobCancelled, err.Error()
+	default:
+		j.Status, j.Error = JobFailed, err.Error()
+	}
+	if j.Status != JobDone && j.output != "" {
+		_ = os.Remove(j.output)
+		j.output = ""
+	}
+	s.running--
+	s.memory -= j.Memory
+	s.schedule()
+}
+
+// runJob computes a job with a new IPCounter that reports the progress of its scans into the job.
+func (s *JobServer) runJob(ctx context.Context, j *job) (*JobResult, error) {
+	req := j.Request
+	file := 0
+	observe := func(p Progress) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		j.Progress = JobProgress{File: file, Files: len(req.Paths), BytesProcessed: p.BytesProcessed, TotalBytes: p.TotalBytes, UniqueCount: p.UniqueCount}
+		if p.Done && file < len(req.Paths)-1 {
+			file++
+		}
+	}
+	ip := NewIPCounter(s.config.Goroutines, '\n', append(s.opts, WithProgress(observe, 0))...)
+	switch req.Kind {
+	case JobCount:
+		if len(req.Paths) == 1 {
+			count, err := ip.UniqueIP4(ctx, req.Paths[0])
+			return &JobResult{Count: count}, err
+		}
+		snapshot, err := ip.TakeSnapshot(ctx, SnapshotRoaring, req.Paths...)
+		if err != nil {
+			return nil, err
+		}
+		return &JobResult{Count: snapshot.Count()}, nil
+	case JobDiff:
+		comparison, err := ip.CompareSets(ctx, req.Paths...)
+		if err != nil {
+			return nil, err
+		}
+		return &JobResult{Count: comparison.Union, Comparison: comparison}, nil
+	}
+	format, _ := ParseExportFormat(req.Format)
+	var count int64
+	path := filepath.Join(s.config.ResultDir, j.ID+"."+format.String())
+	s.mu.Lock()
+	j.output = path
+	s.mu.Unlock()
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		var err error
+		if len(req.Paths) == 1 {
+			count, err = ip.ExportUniqueIP4(ctx, req.Paths[0], w, format)
+		} else {
+			op, _ := ParseSetOp(req.Op)
+			count, err = ip.ExportSetOp(ctx, op, req.Paths, w, format)
+		}
+		return err
+	})
+	return &JobResult{Count: count}, err
+}
+
+// Job returns the state of the job with id.
+func (s *JobServer) Job(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return j.Job, nil
+}
+
+// Jobs returns the state of every job in submission order.
+func (s *JobServer) Jobs() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, j.Job)
+	}
+	sort.Slice(jobs, func(a, b int) bool {
+		return len(jobs[a].ID) < len(jobs[b].ID) || len(jobs[a].ID) == len(jobs[b].ID) && jobs[a].ID < jobs[b].ID
+	})
+	return jobs
+}
+
+// Cancel stops a queued or running job through its context, a finished job is forgotten with its export file.
+func (s *JobServer) Cancel(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	switch j.Status {
+	case JobQueued:
+		for i, queued := range s.queue {
+			if queued == j {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				break
+			}
+		}
+		now := time.Now()
+		j.Status, j.Error, j.Finished = JobCancelled, context.Canceled.Error(), &now
+		s.schedule() //the jobs behind it may fit now
+	case JobRunning:
+		j.cancel()
+	default:
+		s.forget(j)
+	}
+	return j.Job, nil
+}
+
+// Output opens the export file of a finished export job.
+func (s *JobServer) Output(id string) (*os.File, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.prune()
+	j, ok := s.jobs[id]
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	case j.Status != JobDone:
+		return nil, fmt.Errorf("%w: %s is %s", ErrJobNotDone, id, j.Status)
+	case j.output == "":
+		return nil, fmt.Errorf("%w: %s is a %s job", ErrJobNotFound, id, j.Request.Kind)
+	}
+	return os.Open(j.output)
+}
+
+// prune forgets the jobs finished longer than the retention ago, s.mu is held.
+func (s *JobServer) prune() {
+	for _, j := range s.jobs {
+		if j.Finished != nil && time.Since(*j.Finished) > s.config.Retention {
+			s.forget(j)
+		}
+	}
+}
+
+func (s *JobServer) forget(j *job) {
+	if j.output != "" {
+		_ = os.Remove(j.output)
+	}
+	delete(s.jobs, j.ID)
+}
+
+// Close cancels the queued and running jobs and waits for them to stop, Submit fails afterwards.
+func (s *JobServer) Close() {
+	s.mu.Lock()
+	s.closed = true
+	now := time.Now()
+	for _, j := range s.queue {
+		j.Status, j.Error, j.Finished = JobCancelled, context.Canceled.Error(), &now
+	}
+	s.queue = nil
+	for _, j := range s.jobs {
+		if j.Status == JobRunning {
+			j.cancel()
+		}
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+// Handler serves the REST API of the jobs as JSON:
+//
+//	POST   /jobs             submit a JobRequest, 202 with the Job
+//	GET    /jobs             every Job
+//	GET    /jobs/{id}        the Job with its status and progress
+//	GET    /jobs/{id}/result the JobResult, 409 until the job is done
+//	GET    /jobs/{id}/output the file an export job wrote
+//	DELETE /jobs/{id}        cancel a queued or running job, forget a finished one
+//
+// Errors are {"error": "..."} with 400 for invalid requests, 404 for unknown jobs and 409 for jobs that aren't done.
+func (s *JobServer) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, action, _ := strings.Cut(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/"), "/")
+		switch {
+		case r.URL.Path != "/jobs" && !strings.HasPrefix(r.URL.Path, "/jobs/"):
+			writeJSONError(w, http.StatusNotFound, errors.New("not found"))
+		case id == "" && r.Method == http.MethodPost:
+			var req JobRequest
+			if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil {
+				writeJSONError(w, http.StatusBadRequest, fmt.Errorf("%w: %v", ErrInvalidJob, err))
+				return
+			}
+			j, err := s.Submit(req)
+			writeJSON(w, http.StatusAccepted, j, err)
+		case id == "" && r.Method == http.MethodGet:
+			writeJSON(w, http.StatusOK, s.Jobs(), nil)
+		case action == "" && r.Method == http.MethodGet:
+			j, err := s.Job(id)
+			writeJSON(w, http.StatusOK, j, err)
+		case action == "" && r.Method == http.MethodDelete:
+			j, err := s.Cancel(id)
+			writeJSON(w, http.StatusOK, j, err)
+		case action == "result" && r.Method == http.MethodGet:
+			j, err := s.Job(id)
+			if err == nil && j.Status != JobDone {
+				err = fmt.Errorf("%w: %s is %s", ErrJobNotDone, id, j.Status)
+			}
+			writeJSON(w, http.StatusOK, j.Result, err)
+		case action == "output" && r.Method == http.MethodGet:
+			file, err := s.Output(id)
+			if err != nil {
+				writeJSON(w, 0, nil, err)
+				return
+			}
+			defer file.Close()
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = io.Copy(w, file)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s %s isn't supported", r.Method, r.URL.Path))
+		}
+	})
+}
+
+// writeJSON writes v with status, or the error with the status of its kind.
+func writeJSON(w http.ResponseWriter, status int, v any, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidJob):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrJobNotDone):
+		status = http.StatusConflict
+	case err != nil:
+		status = http.StatusInternalServerError
+	}
+	if err != nil {
+		writeJSONError(w, status, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// ListenAndServe serves the API on addr until ctx is done, then it closes the server.
+func (s *JobServer) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves the API on listener until ctx is done, then it closes the server.
+// Finished jobs are forgotten once their retention is over, whether or not a client asks for them.
+func (s *JobServer) Serve(ctx context.Context, listener net.Listener) error {
+	defer s.Close()
+	server := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		ticker := time.NewTicker(min(s.config.Retention, time.Minute)) //an idle server removes expired exports too
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.mu.Lock()
+				s.prune()
+				s.mu.Unlock()
+			case <-ctx.Done():
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+				return
+			}
+		}
+	}()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitJob polls the job until it leaves the queued and running states.
+func waitJob(t *testing.T, s *JobServer, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := s.Job(id)
+		if err != nil {
+			t.Fatalf("Job(%s) returned an error: %v", id, err)
+		}
+		if j.Status != JobQueued && j.Status != JobRunning {
+			return j
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("job %s didn't finish", id)
+	return Job{}
+}
+
+func TestJobServerHTTP(t *testing.T) {
+	yesterday := writeTempFile(t, "1.1.1.1\n2.2.2.2\n3.3.3.3\n2.2.2.2\n")
+	today := writeTempFile(t, "2.2.2.2\n3.3.3.3\n4.4.4.4\n5.5.5.5\n")
+	s, err := NewJobServer(JobConfig{Concurrency: 2, Goroutines: 1, ResultDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJobServer() returned an error: %v", err)
+	}
+	defer s.Close()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+	call := func(method, path string, body string, wantStatus int, v any) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s returned an error: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != wantStatus {
+			t.Fatalf("%s %s = %d %s; want %d", method, path, resp.StatusCode, data, wantStatus)
+		}
+		if v != nil {
+			if err = json.Unmarshal(data, v); err != nil {
+				t.Fatalf("%s %s returned %q: %v", method, path, data, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name    string
+		request string
+		want    JobResult
+		output  string
+	}{
+		{name: "count", request: `{"kind":"count","paths":["` + yesterday + `"]}`, want: JobResult{Count: 3}},
+		{name: "count union", request: `{"kind":"count","paths":["` + yesterday + `","` + today + `"]}`, want: JobResult{Count: 5}},
+		{name: "export", request: `{"kind":"export","paths":["` + today + `"]}`, want: JobResult{Count: 4}, output: "2.2.2.2\n3.3.3.3\n4.4.4.4\n5.5.5.5\n"},
+		{name: "export op", request: `{"kind":"export","paths":["` + yesterday + `","` + today + `"],"op":"difference","format":"csv"}`,
+			want: JobResult{Count: 1}, output: "ip\n1.1.1.1\n"},
+		{name: "diff", request: `{"kind":"diff","paths":["` + yesterday + `","` + today + `"]}`,
+			want: JobResult{Count: 5, Comparison: &SetComparison{Unique: []int64{3, 4}, Union: 5, Intersection: 2, Difference: 1, SymmetricDifference: 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var j Job
+			call(http.MethodPost, "/jobs", tt.request, http.StatusAccepted, &j)
+			if j = waitJob(t, s, j.ID); j.Status != JobDone {
+				t.Fatalf("job is %s: %s", j.Status, j.Error)
+			}
+			var got JobResult
+			call(http.MethodGet, "/jobs/"+j.ID+"/result", "", http.StatusOK, &got)
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if !bytes.Equal(gotJSON, wantJSON) {
+				t.Errorf("result = %s; want %s", gotJSON, wantJSON)
+			}
+			if j.Progress.File != j.Progress.Files-1 || j.Progress.TotalBytes == 0 {
+				t.Errorf("progress = %+v", j.Progress)
+			}
+			if tt.output == "" {
+				call(http.MethodGet, "/jobs/"+j.ID+"/output", "", http.StatusNotFound, nil)
+				return
+			}
+			resp, err := http.Get(server.URL + "/jobs/" + j.ID + "/output")
+			if err != nil {
+				t.Fatalf("GET output returned an error: %v", err)
+			}
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if string(data) != tt.output {
+				t.Errorf("output = %q; want %q", data, tt.output)
+			}
+		})
+	}
+
+	var jobs []Job
+	call(http.MethodGet, "/jobs", "", http.StatusOK, &jobs)
+	if len(jobs) != len(tests) || jobs[0].ID != "1" {
+		t.Errorf("GET /jobs returned %d jobs; want %d", len(jobs), len(tests))
+	}
+	call(http.MethodDelete, "/jobs/1", "", http.StatusOK, nil)
+	call(http.MethodGet, "/jobs/1", "", http.StatusNotFound, nil)
+	call(http.MethodPost, "/jobs", `{"kind":"sum","paths":["`+today+`"]}`, http.StatusBadRequest, nil)
+	call(http.MethodPost, "/jobs", `{"kind":"count","paths":["/does/not/exist"]}`, http.StatusBadRequest, nil)
+	call(http.MethodPost, "/jobs", `{"kind":"diff","paths":["`+today+`"]}`, http.StatusBadRequest, nil)
+	call(http.MethodPost, "/jobs", `{"kind":"export","paths":["`+today+`"],"format":"xml"}`, http.StatusBadRequest, nil)
+	call(http.MethodPut, "/jobs", "", http.StatusMethodNotAllowed, nil)
+}
+
+func TestJobServerQueue(t *testing.T) {
+	path := writeTempFile(t, strings.Repeat("1.1.1.1\n", 100)) //estimated at 400 bytes
+	s, err := NewJobServer(JobConfig{Concurrency: 2, MemoryBudget: 700, ResultDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJobServer() returned an error: %v", err)
+	}
+	started := make(chan string, 4)
+	s.run = func(ctx context.Context, j *job) (*JobResult, error) {
+		started <- j.ID
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	submit := func() Job {
+		j, err := s.Submit(JobRequest{Kind: JobCount, Paths: []string{path}})
+		if err != nil {
+			t.Fatalf("Submit() returned an error: %v", err)
+		}
+		return j
+	}
+	status := func(id string) JobStatus {
+		j, _ := s.Job(id)
+		return j.Status
+	}
+	first, second, third := submit(), submit(), submit()
+	if id := <-started; id != first.ID {
+		t.Fatalf("job %s started first; want %s", id, first.ID)
+	}
+	if status(second.ID) != JobQueued || status(third.ID) != JobQueued {
+		t.Errorf("second job is %s and third %s; both should wait for memory", status(second.ID), status(third.ID))
+	}
+
+	if _, err = s.Cancel(second.ID); err != nil {
+		t.Fatalf("Cancel() returned an error: %v", err)
+	}
+	if status(second.ID) != JobCancelled {
+		t.Errorf("cancelled queued job is %s", status(second.ID))
+	}
+	if _, err = s.Cancel(first.ID); err != nil {
+		t.Fatalf("Cancel() returned an error: %v", err)
+	}
+	if id := <-started; id != third.ID {
+		t.Errorf("job %s started after the cancellation; want %s", id, third.ID)
+	}
+	if j := waitJob(t, s, first.ID); j.Status != JobCancelled || !strings.Contains(j.Error, context.Canceled.Error()) {
+		t.Errorf("cancelled running job is %s: %s", j.Status, j.Error)
+	}
+	s.Close()
+	if j := waitJob(t, s, third.ID); j.Status != JobCancelled {
+		t.Errorf("job running at Close is %s", j.Status)
+	}
+	if _, err = s.Submit(JobRequest{Kind: JobCount, Paths: []string{path}}); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Submit() after Close error = %v; want %v", err, ErrInvalidJob)
+	}
+}
+
+func TestJobServerRoot(t *testing.T) {
+	inside := writeTempFile(t, "1.1.1.1\n")
+	s, err := NewJobServer(JobConfig{Root: filepath.Dir(inside), ResultDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJobServer() returned an error: %v", err)
+	}
+	defer s.Close()
+	paths := []string{filepath.Base(inside)}
+	if _, err = s.Submit(JobRequest{Kind: JobCount, Paths: paths}); err != nil {
+		t.Errorf("Submit() of a path inside the root returned an error: %v", err)
+	}
+	if paths[0] != filepath.Base(inside) {
+		t.Errorf("Submit() changed the paths of the caller to %v", paths)
+	}
+	outside := writeTempFile(t, "1.1.1.1\n")
+	if _, err = s.Submit(JobRequest{Kind: JobCount, Paths: []string{outside}}); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Submit() of a path outside the root error = %v; want %v", err, ErrInvalidJob)
+	}
+	if _, err = s.Submit(JobRequest{Kind: JobCount, Paths: []string{"../" + filepath.Base(filepath.Dir(outside)) + "/ips"}}); !errors.Is(err, ErrInvalidJob) {
+		t.Errorf("Submit() of a relative path out of the root error = %v; want %v", err, ErrInvalidJob)
+	}
+}
+
+func TestJobServerPrune(t *testing.T) {
+	path := writeTempFile(t, "1.1.1.1\n2.2.2.2\n")
+	s, err := NewJobServer(JobConfig{Retention: 50 * time.Millisecond, ResultDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJobServer() returned an error: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(ctx, listener)
+	}()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned an error: %v", err)
+		}
+	}()
+
+	j, err := s.Submit(JobRequest{Kind: JobExport, Paths: []string{path}})
+	if err != nil {
+		t.Fatalf("Submit() returned an error: %v", err)
+	}
+	//nobody asks for the job, the server forgets it and removes the export on its own
+	var (
+		output string
+		status JobStatus
+	)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		kept, ok := s.jobs[j.ID]
+		if ok {
+			output, status = kept.output, kept.Status
+		}
+		s.mu.Unlock()
+		if !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s wasn't forgotten by the idle server", j.ID)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if status != JobDone || output == "" {
+		t.Fatalf("job %s was forgotten as %s with export %q; want a done export", j.ID, status, output)
+	}
+	if _, err = os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("export file of the forgotten job: %v; want it removed", err)
+	}
+}
+
+func TestJobServerPruneOnLookup(t *testing.T) {
+	s, err := NewJobServer(JobConfig{Retention: time.Millisecond, ResultDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewJobServer() returned an error: %v", err)
+	}
+	defer s.Close()
+	finished := time.Now().Add(-time.Second)
+	s.mu.Lock()
+	s.jobs["1"] = &job{Job: Job{ID: "1", Status: JobDone, Finished: &finished}}
+	s.mu.Unlock()
+	if _, err = s.Job("1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Job() of an expired job error = %v; want %v", err, ErrJobNotFound)
+	}
+	s.mu.Lock()
+	s.jobs["1"] = &job{Job: Job{ID: "1", Status: JobDone, Finished: &finished}}
+	s.mu.Unlock()
+	if _, err = s.Output("1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("Output() of an expired job error = %v; want %v", err, ErrJobNotFound)
+	}
+}
@@ -0,0 +1,27 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrLockUnsupported is returned by UniqueIP4 with WithSharedLock on platforms without file locks.
+var ErrLockUnsupported = errors.New("file locking is not supported on this platform")
+
+const lockPollInterval = 50 * time.Millisecond
+
+// lockShared takes a shared advisory lock of the file, waiting while a writer holds an exclusive one.
+// The lock is released by unlock or when the file is closed.
+func lockShared(ctx context.Context, file *os.File) error {
+	for {
+		locked, err := tryLockShared(file)
+		if err != nil || locked {
+			return err
+		}
+		if err = sleepContext(ctx, lockPollInterval); err != nil {
+			return err
+		}
+	}
+}
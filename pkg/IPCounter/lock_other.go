@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package IPCounter
+
+import "os"
+
+func tryLockShared(file *os.File) (bool, error) {
+	return false, ErrLockUnsupported
+}
+
+func unlock(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,49 @@
+//go:build unix
+
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestUniqueIP4SharedLock(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n10.0.0.2\n")
+	writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("Failed to open temp file: %v", err)
+	}
+	defer writer.Close()
+	fd := int(writer.Fd())
+	if err := unix.Flock(fd, unix.LOCK_EX); err != nil {
+		t.Fatalf("Failed to lock temp file: %v", err)
+	}
+
+	ipCounter := NewIPCounter(1, '\n', WithSharedLock())
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	if _, err := ipCounter.UniqueIP4(ctx, path); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("UniqueIP4() of exclusively locked file error = %v; want %v", err, context.DeadlineExceeded)
+	}
+
+	unlocked := make(chan struct{})
+	go func() {
+		defer close(unlocked)
+		time.Sleep(100 * time.Millisecond)
+		_ = unix.Flock(fd, unix.LOCK_UN)
+	}()
+	count, err := ipCounter.UniqueIP4(context.Background(), path)
+	<-unlocked
+	if err != nil || count != 2 {
+		t.Fatalf("UniqueIP4() after unlock = %d, %v; want 2, nil", count, err)
+	}
+	// the scan released its lock, a writer can lock the file again
+	if err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		t.Errorf("exclusive lock after the scan failed: %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package IPCounter
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const (
+	invalidSampleBurst    = 10          //invalid lines of a scan that are all logged
+	invalidSampleInterval = time.Second //after the burst one invalid line per interval is logged
+	invalidSampleMaxLen   = 64          //logged bytes of an invalid line
+)
+
+// discardHandler drops every record, it is the handler of the counter without WithLogger.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
+
+var discardLogger = slog.New(discardHandler{})
+
+// log returns the logger of the counter.
+func (ip *IPCounter) log() *slog.Logger {
+	if ip.logger == nil {
+		return discardLogger
+	}
+	return ip.logger
+}
+
+// lineSampler rate limits the log of invalid lines, so a file full of garbage doesn't flood the log.
+// It's used by the single goroutine that parses the lines.
+type lineSampler struct {
+	logged     int
+	last       time.Time
+	suppressed int64
+}
+
+// logInvalid logs a sample of an invalid line, attrs tell where the line was found.
+func (ip *IPCounter) logInvalid(ctx context.Context, s *lineSampler, line []byte, err error, attrs ...any) {
+	logger := ip.log()
+	if !logger.Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+	if s.logged >= invalidSampleBurst {
+		if now := time.Now(); now.Sub(s.last) < invalidSampleInterval {
+			s.suppressed++
+			return
+		}
+	}
+	s.logged++
+	s.last = time.Now()
+	if len(line) > invalidSampleMaxLen {
+		line = line[:invalidSampleMaxLen]
+	}
+	attrs = append(attrs, slog.String("line", string(line)), slog.String("reason", invalidReasonNames[invalidReasonOf(err)]),
+		slog.Int64("suppressed", s.suppressed))
+	s.suppressed = 0
+	logger.WarnContext(ctx, "invalid line", attrs...)
+}
+
+// logScan logs the result and the timings of a scan.
+func (ip *IPCounter) logScan(ctx context.Context, path string, uniqueCount int64, err error) {
+	attrs := []any{
+		slog.String("path", path),
+		slog.Int64("unique", uniqueCount),
+		slog.Duration("duration", ip.stats.Duration),
+		slog.Int64("lines", ip.stats.Lines),
+		slog.Int64("valid_lines", ip.stats.ValidLines),
+		slog.Int64("invalid_lines", ip.stats.InvalidLines),
+		slog.Int64("bytes_covered", ip.stats.BytesCovered),
+		slog.Duration("throttled", ip.stats.ThrottledTime),
+		slog.Int64("retries", ip.stats.Retries),
+	}
+	if isCancellation(err) {
+		attrs = append(attrs, slog.Bool("partial", ip.stats.Partial), slog.Any("error", err))
+		ip.log().WarnContext(ctx, "scan interrupted", attrs...)
+		return
+	}
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		ip.log().ErrorContext(ctx, "scan failed", attrs...)
+		return
+	}
+	ip.log().InfoContext(ctx, "scan finished", attrs...)
+}
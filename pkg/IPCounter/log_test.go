@@ -0,0 +1,85 @@
+package IPCounter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// readLogRecords decodes the records of a slog JSON handler.
+func readLogRecords(t *testing.T, data *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		record := map[string]any{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("log record %s isn't valid JSON: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLoggerUniqueIP4(t *testing.T) {
+	data := "10.0.0.1\n" + strings.Repeat("10.0.0.x\n", 100) + "10.0.0.2\n"
+	path := writeTempFile(t, data)
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	ipCounter := NewIPCounter(1, '\n', WithLogger(logger))
+	if _, err := ipCounter.UniqueIP4(context.Background(), path); err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+
+	messages := map[string][]map[string]any{}
+	for _, record := range readLogRecords(t, &buf) {
+		msg := record["msg"].(string)
+		messages[msg] = append(messages[msg], record)
+	}
+	if strategy := messages["scan strategy"]; len(strategy) != 1 || strategy[0]["sequential"] != true || strategy[0]["path"] != path {
+		t.Errorf("scan strategy records = %v", strategy)
+	}
+	invalid := messages["invalid line"]
+	if len(invalid) != invalidSampleBurst { //the rest comes within the sample interval
+		t.Fatalf("%d invalid line records; want %d", len(invalid), invalidSampleBurst)
+	}
+	if invalid[0]["line"] != "10.0.0.x" || invalid[0]["reason"] != "character" || invalid[0]["offset"] != float64(9) {
+		t.Errorf("invalid line record = %v", invalid[0])
+	}
+	finished := messages["scan finished"]
+	if len(finished) != 1 || finished[0]["unique"] != float64(2) || finished[0]["invalid_lines"] != float64(100) {
+		t.Errorf("scan finished records = %v", finished)
+	}
+}
+
+func TestLineSampler(t *testing.T) {
+	var buf bytes.Buffer
+	ipCounter := NewIPCounter(1, '\n', WithLogger(slog.New(slog.NewJSONHandler(&buf, nil))))
+	var sampler lineSampler
+	for i := 0; i < invalidSampleBurst+5; i++ {
+		ipCounter.logInvalid(context.Background(), &sampler, []byte(strings.Repeat("x", 100)), errIP4Character)
+	}
+	sampler.last = sampler.last.Add(-invalidSampleInterval) //the interval has passed
+	ipCounter.logInvalid(context.Background(), &sampler, []byte("1.2.3"), errIP4Format)
+
+	records := readLogRecords(t, &buf)
+	if len(records) != invalidSampleBurst+1 {
+		t.Fatalf("%d records; want %d", len(records), invalidSampleBurst+1)
+	}
+	if line := records[0]["line"].(string); len(line) != invalidSampleMaxLen {
+		t.Errorf("logged line of %d bytes; want %d", len(line), invalidSampleMaxLen)
+	}
+	if last := records[len(records)-1]; last["suppressed"] != float64(5) || last["reason"] != "format" {
+		t.Errorf("last record = %v; want 5 suppressed lines", last)
+	}
+
+	buf.Reset()
+	NewIPCounter(1, '\n').logInvalid(context.Background(), &sampler, []byte("x"), errIP4Character)
+	if buf.Len() != 0 {
+		t.Errorf("counter without a logger logged %s", buf.String())
+	}
+}
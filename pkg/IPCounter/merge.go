@@ -0,0 +1,147 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MergeMode selects whether merged snapshots keep the addresses or a HyperLogLog sketch.
+type MergeMode uint8
+
+const (
+	// MergeAuto merges into an exact snapshot when every input is exact and into a sketch otherwise.
+	MergeAuto MergeMode = iota
+	// MergeExact merges the sets of the inputs, a sketch among them returns ErrSnapshotMismatch.
+	MergeExact
+	// MergeApprox merges into a sketch, exact inputs are sketched first.
+	MergeApprox
+)
+
+var mergeModeNames = [...]string{MergeAuto: "auto", MergeExact: "exact", MergeApprox: "approx"}
+
+// ErrUnknownMergeMode is returned by ParseMergeMode for a name that isn't a merge mode.
+var ErrUnknownMergeMode = errors.New("unknown merge mode")
+
+func (m MergeMode) String() string {
+	if int(m) < len(mergeModeNames) {
+		return mergeModeNames[m]
+	}
+	return fmt.Sprintf("MergeMode(%d)", m)
+}
+
+// ParseMergeMode returns the merge mode with the given name: auto, exact or approx.
+func ParseMergeMode(name string) (MergeMode, error) {
+	for m, n := range mergeModeNames {
+		if n == name {
+			return MergeMode(m), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownMergeMode, name)
+}
+
+// MergeSnapshots returns the snapshot of the union of snapshots with the sources of all of them, e.g. the partial
+// results of several hosts. Exact merges keep the kind of the first input. Sketches of different precisions are
+// folded to the lowest one, exact inputs of a sketch merge are sketched at that precision, or at
+// DefaultHLLPrecision when there is no sketch among the inputs.
+// Every source keeps the tool version that counted it. Builds may parse or count files differently, so when
+// Meta.ToolVersions lists more than one version the merged count may be off.
+func MergeSnapshots(ctx context.Context, mode MergeMode, snapshots ...*Snapshot) (*Snapshot, error) {
+	m := newSnapshotMerger(mode)
+	for _, s := range snapshots {
+		if err := m.add(ctx, s); err != nil {
+			return nil, err
+		}
+	}
+	return m.result()
+}
+
+// MergeSnapshotFiles is MergeSnapshots of snapshot files, loaded one at a time so only the merged set and the
+// snapshot being added are in memory.
+func MergeSnapshotFiles(ctx context.Context, mode MergeMode, paths ...string) (*Snapshot, error) {
+	m := newSnapshotMerger(mode)
+	for _, path := range paths {
+		s, err := LoadSnapshot(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = m.add(ctx, s); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return m.result()
+}
+
+// snapshotMerger folds snapshots into the union of the sets, until the first sketch when the sets become a sketch too.
+type snapshotMerger struct {
+	mode   MergeMode
+	merged *Snapshot
+	set    ip4Set
+}
+
+func newSnapshotMerger(mode MergeMode) *snapshotMerger {
+	return &snapshotMerger{mode: mode, merged: &Snapshot{Meta: SnapshotMeta{Created: time.Now(), ToolVersion: toolVersion()}}}
+}
+
+func (m *snapshotMerger) add(ctx context.Context, s *Snapshot) error {
+	if s.sketch != nil && m.mode == MergeExact {
+		return fmt.Errorf("%w: %s snapshot in an exact merge", ErrSnapshotMismatch, s.kind)
+	}
+	for _, source := range s.Meta.Sources {
+		m.merged.Meta.addSource(source)
+	}
+	if m.merged.kind == 0 {
+		m.merged.kind = s.kind
+	}
+	if s.sketch == nil && m.merged.sketch == nil && m.mode != MergeApprox {
+		if m.set == nil {
+			m.set = s.set
+			return nil
+		}
+		union, err := unionSets(ctx, []ip4Set{m.set, s.set})
+		m.set = union
+		return err
+	}
+
+	sketch := s.sketch
+	if sketch == nil {
+		precision := DefaultHLLPrecision
+		if m.merged.sketch != nil {
+			precision = int(m.merged.sketch.precision)
+		}
+		sketch, _ = newHyperLogLog(precision)
+		if err := sketch.addSet(ctx, s.set); err != nil {
+			return err
+		}
+	}
+	if m.merged.sketch == nil {
+		//the sets merged so far are sketched at the precision of the first sketch
+		m.merged.kind = SnapshotHLL
+		m.merged.sketch, _ = newHyperLogLog(int(sketch.precision))
+		if m.set != nil {
+			if err := m.merged.sketch.addSet(ctx, m.set); err != nil {
+				return err
+			}
+			m.set = nil
+		}
+	}
+	switch {
+	case sketch.precision < m.merged.sketch.precision:
+		m.merged.sketch = m.merged.sketch.reduce(sketch.precision)
+	case sketch.precision > m.merged.sketch.precision:
+		sketch = sketch.reduce(m.merged.sketch.precision)
+	}
+	m.merged.sketch.merge(sketch)
+	return nil
+}
+
+func (m *snapshotMerger) result() (*Snapshot, error) {
+	if m.merged.kind == 0 {
+		return nil, errors.New("nothing to merge")
+	}
+	if m.merged.sketch == nil {
+		m.merged.set = convertSet(m.set, m.merged.kind)
+	}
+	return m.merged, nil
+}
@@ -0,0 +1,151 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestMergeSnapshots(t *testing.T) {
+	ctx := context.Background()
+	take := func(precision int, kind SnapshotKind, data string) *Snapshot {
+		t.Helper()
+		s, err := NewIPCounter(1, '\n', WithHLLPrecision(precision)).TakeSnapshot(ctx, kind, writeTempFile(t, data))
+		if err != nil {
+			t.Fatalf("TakeSnapshot() returned an error: %v", err)
+		}
+		return s
+	}
+	exact := take(DefaultHLLPrecision, SnapshotRoaring, "1.1.1.1\n2.2.2.2\n3.3.3.3\n")
+	sorted := take(DefaultHLLPrecision, SnapshotSorted, "3.3.3.3\n4.4.4.4\n")
+	sketch := take(12, SnapshotHLL, "4.4.4.4\n5.5.5.5\n")
+	coarse := take(10, SnapshotHLL, "5.5.5.5\n6.6.6.6\n")
+	tests := []struct {
+		name      string
+		mode      MergeMode
+		snapshots []*Snapshot
+		kind      SnapshotKind
+		count     int64
+		precision uint8
+		err       error
+	}{
+		{name: "exact", mode: MergeAuto, snapshots: []*Snapshot{exact, sorted}, kind: SnapshotRoaring, count: 4},
+		{name: "approx of exact", mode: MergeApprox, snapshots: []*Snapshot{exact, sorted}, kind: SnapshotHLL, count: 4, precision: DefaultHLLPrecision},
+		{name: "mixed", mode: MergeAuto, snapshots: []*Snapshot{exact, sorted, sketch}, kind: SnapshotHLL, count: 5, precision: 12},
+		{name: "precisions", mode: MergeAuto, snapshots: []*Snapshot{sketch, exact, coarse}, kind: SnapshotHLL, count: 6, precision: 10},
+		{name: "sketch in exact", mode: MergeExact, snapshots: []*Snapshot{exact, sketch}, err: ErrSnapshotMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeSnapshots(ctx, tt.mode, tt.snapshots...)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Errorf("MergeSnapshots() error = %v; want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeSnapshots() returned an error: %v", err)
+			}
+			if merged.Kind() != tt.kind || merged.Count() != tt.count || len(merged.Meta.Sources) != len(tt.snapshots) {
+				t.Errorf("merged %s snapshot with %d addresses and %d sources; want %s with %d", merged.Kind(), merged.Count(),
+					len(merged.Meta.Sources), tt.kind, tt.count)
+			}
+			if tt.precision != 0 && merged.sketch.precision != tt.precision {
+				t.Errorf("merged sketch precision = %d; want %d", merged.sketch.precision, tt.precision)
+			}
+		})
+	}
+	if _, err := MergeSnapshots(ctx, MergeAuto); err == nil {
+		t.Errorf("MergeSnapshots() of nothing returned no error")
+	}
+}
+
+func TestMergeSnapshotFiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	var paths []string
+	for host := 0; host < 4; host++ {
+		var data bytes.Buffer
+		for i := 0; i < 20000; i++ {
+			data.WriteString(addrFrom32(uint32(host*10000+i)*2654435761).String() + "\n") //hosts overlap by half
+		}
+		for _, kind := range []SnapshotKind{SnapshotRoaring, SnapshotHLL} {
+			s, err := NewIPCounter(1, '\n').TakeSnapshot(ctx, kind, writeTempFile(t, data.String()))
+			if err != nil {
+				t.Fatalf("TakeSnapshot() returned an error: %v", err)
+			}
+			path := filepath.Join(dir, kind.String()+string(rune('a'+host))+".snap")
+			if err = s.Save(path); err != nil {
+				t.Fatalf("Save() returned an error: %v", err)
+			}
+			paths = append(paths, path)
+		}
+	}
+	exact, err := MergeSnapshotFiles(ctx, MergeExact, paths[0], paths[2], paths[4], paths[6])
+	if err != nil {
+		t.Fatalf("MergeSnapshotFiles() returned an error: %v", err)
+	}
+	if !exact.Exact() || exact.Count() != 50000 {
+		t.Errorf("exact merge has %d addresses, exact %v; want 50000", exact.Count(), exact.Exact())
+	}
+	approx, err := MergeSnapshotFiles(ctx, MergeAuto, paths...)
+	if err != nil {
+		t.Fatalf("MergeSnapshotFiles() returned an error: %v", err)
+	}
+	if approx.Exact() || math.Abs(float64(approx.Count()-50000)) > 0.03*50000 {
+		t.Errorf("approximate merge has %d addresses, exact %v; want about 50000", approx.Count(), approx.Exact())
+	}
+	if _, err = MergeSnapshotFiles(ctx, MergeExact, paths...); !errors.Is(err, ErrSnapshotMismatch) {
+		t.Errorf("MergeSnapshotFiles() of sketches in exact mode error = %v; want %v", err, ErrSnapshotMismatch)
+	}
+}
+
+func TestMergeToolVersions(t *testing.T) {
+	ctx := context.Background()
+	old, err := NewIPCounter(1, '\n').TakeSnapshot(ctx, SnapshotRoaring, writeTempFile(t, "1.1.1.1\n"))
+	if err != nil {
+		t.Fatalf("TakeSnapshot() returned an error: %v", err)
+	}
+	old.Meta.Sources[0].ToolVersion = "v1.0.0"
+	s, err := NewIPCounter(1, '\n').TakeSnapshot(ctx, SnapshotRoaring, writeTempFile(t, "3.3.3.3\n"))
+	if err != nil {
+		t.Fatalf("TakeSnapshot() returned an error: %v", err)
+	}
+	if s.Meta.Sources[0].ToolVersion != s.Meta.ToolVersion {
+		t.Errorf("source counted by %q; want %q", s.Meta.Sources[0].ToolVersion, s.Meta.ToolVersion)
+	}
+	s.Meta.Sources[0].ToolVersion = "v1.1.0"
+	var buf bytes.Buffer
+	if _, err = s.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() returned an error: %v", err)
+	}
+	if s, err = ReadSnapshot(&buf); err != nil {
+		t.Fatalf("ReadSnapshot() returned an error: %v", err)
+	}
+	merged, err := MergeSnapshots(ctx, MergeAuto, s, old)
+	if err != nil {
+		t.Fatalf("MergeSnapshots() returned an error: %v", err)
+	}
+	if got := merged.Meta.ToolVersions(); !slices.Equal(got, []string{"v1.0.0", "v1.1.0"}) {
+		t.Errorf("ToolVersions() = %v; want [v1.0.0 v1.1.0]", got)
+	}
+	if merged, err = MergeSnapshots(ctx, MergeAuto, s, s); err != nil || len(merged.Meta.ToolVersions()) != 1 {
+		t.Errorf("ToolVersions() of one version = %v, %v", merged.Meta.ToolVersions(), err)
+	}
+}
+
+func TestParseMergeMode(t *testing.T) {
+	for m := MergeAuto; m <= MergeApprox; m++ {
+		if got, err := ParseMergeMode(m.String()); err != nil || got != m {
+			t.Errorf("ParseMergeMode(%q) = %s, %v", m.String(), got, err)
+		}
+	}
+	if _, err := ParseMergeMode("fast"); !errors.Is(err, ErrUnknownMergeMode) {
+		t.Errorf("ParseMergeMode(fast) error = %v; want %v", err, ErrUnknownMergeMode)
+	}
+}
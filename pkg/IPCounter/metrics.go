@@ -0,0 +1,185 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// readLatencyBuckets are the upper bounds in seconds of the read latency histogram.
+var readLatencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5}
+
+// Metrics collects the metrics of the scans of one or more IPCounters and exposes them in the Prometheus text format,
+// without depending on the Prometheus client library. Create it with NewMetrics and pass it with WithMetrics.
+type Metrics struct {
+	readBytes    atomic.Int64
+	bytes        atomic.Int64
+	valid        atomic.Int64
+	invalid      [numInvalidReasons]atomic.Int64
+	unique       atomic.Int64
+	workers      atomic.Int64
+	retries      atomic.Int64
+	scans        atomic.Int64
+	readBuckets  []atomic.Int64 //one per bucket and +Inf, not cumulative
+	readCount    atomic.Int64
+	readDuration atomic.Int64 //nanoseconds
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{readBuckets: make([]atomic.Int64, len(readLatencyBuckets)+1)}
+}
+
+func (m *Metrics) addLines(bytes int64, valid int64, invalid *invalidCounts, unique int64) {
+	m.bytes.Add(bytes)
+	m.valid.Add(valid)
+	for reason, n := range invalid {
+		if n != 0 {
+			m.invalid[reason].Add(n)
+		}
+	}
+	m.unique.Store(unique)
+}
+
+func (m *Metrics) observeRead(bytes int, duration time.Duration) {
+	m.readBytes.Add(int64(bytes))
+	m.readCount.Add(1)
+	m.readDuration.Add(int64(duration))
+	seconds := duration.Seconds()
+	bucket := len(readLatencyBuckets)
+	for i, bound := range readLatencyBuckets {
+		if seconds <= bound {
+			bucket = i
+			break
+		}
+	}
+	m.readBuckets[bucket].Add(1)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var written int64
+	write := func(format string, args ...any) {
+		n, _ := fmt.Fprintf(bw, format, args...)
+		written += int64(n)
+	}
+	metric := func(name string, kind string, help string, value int64) {
+		write("# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+	}
+	metric("ipcounter_read_bytes_total", "counter", "Bytes read from input files.", m.readBytes.Load())
+	metric("ipcounter_processed_bytes_total", "counter", "Bytes of input files whose lines were parsed.", m.bytes.Load())
+	valid := m.valid.Load()
+	var invalid int64
+	for i := range m.invalid {
+		invalid += m.invalid[i].Load()
+	}
+	metric("ipcounter_lines_total", "counter", "Non-empty lines parsed.", valid+invalid)
+	metric("ipcounter_valid_lines_total", "counter", "Lines holding an IPv4 address.", valid)
+	write("# HELP ipcounter_invalid_lines_total Lines rejected as IPv4 addresses by reason.\n# TYPE ipcounter_invalid_lines_total counter\n")
+	for reason := range m.invalid {
+		write("ipcounter_invalid_lines_total{reason=%q} %d\n", invalidReasonNames[reason], m.invalid[reason].Load())
+	}
+	metric("ipcounter_unique_addresses", "gauge", "Unique IPv4 addresses of the current or last scan.", m.unique.Load())
+	metric("ipcounter_workers", "gauge", "Reader goroutines of running scans.", m.workers.Load())
+	metric("ipcounter_read_retries_total", "counter", "Failed reads that were retried.", m.retries.Load())
+	metric("ipcounter_scans_total", "counter", "Scans started.", m.scans.Load())
+
+	write("# HELP ipcounter_read_duration_seconds Latency of single reads from input files.\n# TYPE ipcounter_read_duration_seconds histogram\n")
+	var cumulative int64
+	for i := range m.readBuckets {
+		cumulative += m.readBuckets[i].Load()
+		le := "+Inf"
+		if i < len(readLatencyBuckets) {
+			le = strconv.FormatFloat(readLatencyBuckets[i], 'g', -1, 64)
+		}
+		write("ipcounter_read_duration_seconds_bucket{le=%q} %d\n", le, cumulative)
+	}
+	write("ipcounter_read_duration_seconds_sum %s\n", strconv.FormatFloat(time.Duration(m.readDuration.Load()).Seconds(), 'g', -1, 64))
+	write("ipcounter_read_duration_seconds_count %d\n", m.readCount.Load())
+	return written, bw.Flush()
+}
+
+// Handler serves the metrics for Prometheus to scrape.
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = m.WriteTo(w)
+	})
+}
+
+// ListenAndServe serves the metrics on addr at /metrics until ctx is done.
+func (m *Metrics) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return m.Serve(ctx, listener)
+}
+
+// Serve serves the metrics at /metrics on listener until ctx is done.
+func (m *Metrics) Serve(ctx context.Context, listener net.Listener) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// WriteTextfile writes the metrics atomically to path, for the textfile collector of node_exporter (path must end with .prom).
+func (m *Metrics) WriteTextfile(path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := m.WriteTo(w)
+		return err
+	})
+}
+
+// RunTextfileWriter writes the metrics to path every interval until ctx is done, and once more at the end.
+func (m *Metrics) RunTextfileWriter(ctx context.Context, path string, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return m.WriteTextfile(path)
+		case <-ticker.C:
+			if err := m.WriteTextfile(path); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// measuredReader records the latency and size of every read into the metrics.
+type measuredReader struct {
+	reader  fileReader
+	metrics *Metrics
+}
+
+func (r *measuredReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.reader.Read(p)
+	r.metrics.observeRead(n, time.Since(start))
+	return n, err
+}
+
+func (r *measuredReader) ReadAt(p []byte, off int64) (int, error) {
+	start := time.Now()
+	n, err := r.reader.ReadAt(p, off)
+	r.metrics.observeRead(n, time.Since(start))
+	return n, err
+}
@@ -0,0 +1,95 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetricsUniqueIP4(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n10.0.0.1\n10.0.0.2\n10.0.0.x\n10.0.0.01\n300.0.0.1\n")
+	metrics := NewMetrics()
+	ipCounter := NewIPCounter(1, '\n', WithMetrics(metrics))
+	if _, err := ipCounter.UniqueIP4(context.Background(), path); err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+	stats := ipCounter.GetStats()
+	if stats.InvalidByReason["character"] != 1 || stats.InvalidByReason["leading_zero"] != 1 || stats.InvalidByReason["octet_range"] != 1 {
+		t.Errorf("GetStats().InvalidByReason = %v", stats.InvalidByReason)
+	}
+
+	var buf bytes.Buffer
+	if _, err := metrics.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() returned an error: %v", err)
+	}
+	text := buf.String()
+	for _, want := range []string{
+		"ipcounter_lines_total 6\n",
+		"ipcounter_valid_lines_total 3\n",
+		`ipcounter_invalid_lines_total{reason="character"} 1` + "\n",
+		`ipcounter_invalid_lines_total{reason="octet_range"} 1` + "\n",
+		"ipcounter_unique_addresses 2\n",
+		"ipcounter_workers 0\n",
+		"ipcounter_scans_total 1\n",
+		"# TYPE ipcounter_read_duration_seconds histogram\n",
+		`ipcounter_read_duration_seconds_bucket{le="+Inf"} `,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("WriteTo() output doesn't contain %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "ipcounter_read_bytes_total 0\n") {
+		t.Errorf("WriteTo() output has no read bytes:\n%s", text)
+	}
+}
+
+func TestMetricsServe(t *testing.T) {
+	metrics := NewMetrics()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- metrics.Serve(ctx, listener) }()
+
+	resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics returned an error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "ipcounter_scans_total 0") {
+		t.Errorf("GET /metrics = %d %s", resp.StatusCode, body)
+	}
+	cancel()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Errorf("Serve() returned an error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() didn't stop after cancel")
+	}
+}
+
+func TestMetricsTextfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipcounter.prom")
+	if err := NewMetrics().WriteTextfile(path); err != nil {
+		t.Fatalf("WriteTextfile() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	if !strings.Contains(string(data), "# TYPE ipcounter_lines_total counter") {
+		t.Errorf("textfile = %s", data)
+	}
+}
@@ -0,0 +1,157 @@
+package IPCounter
+
+import (
+	"log/slog"
+	"net/netip"
+	"time"
+)
+
+// Option configures optional behaviour of an IPCounter created with NewIPCounter.
+type Option func(*IPCounter)
+
+// WithReadMode selects how the input file is read, see ReadMode.
+func WithReadMode(mode ReadMode) Option {
+	return func(ip *IPCounter) {
+		ip.readMode = mode
+	}
+}
+
+// WithReadLimit limits the read bandwidth to bytesPerSecond across all reader goroutines, see IPCounter.SetReadLimit.
+func WithReadLimit(bytesPerSecond int64) Option {
+	return func(ip *IPCounter) {
+		ip.limiter.setRate(bytesPerSecond)
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for failed reads.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(ip *IPCounter) {
+		ip.retryPolicy = policy
+	}
+}
+
+// WithCheckpoint saves the scan state to path every interval (0 disables periodic checkpoints)
+// and when the scan stops with an error, including context cancellation. The file is removed when the scan completes.
+// A checkpoint of the bitmap takes 512MB on disk.
+func WithCheckpoint(path string, interval time.Duration) Option {
+	return func(ip *IPCounter) {
+		ip.checkpointPath = path
+		ip.checkpointInterval = interval
+	}
+}
+
+// WithResume continues a scan from the WithCheckpoint file if it exists. UniqueIP4 returns ErrCheckpointMismatch
+// when the input file was changed since the checkpoint and only the incomplete parts of the file are read otherwise.
+func WithResume() Option {
+	return func(ip *IPCounter) {
+		ip.resume = true
+	}
+}
+
+// WithPartialResult makes UniqueIP4 return the number of unique addresses found so far together with
+// the error when the context is cancelled, a lower bound of the real count. GetStats reports which ranges were covered.
+func WithPartialResult() Option {
+	return func(ip *IPCounter) {
+		ip.partialResult = true
+	}
+}
+
+// WithSharedLock holds a shared advisory lock (flock, LockFileEx on Windows) of the input file during the scan.
+// UniqueIP4 waits while another process holds an exclusive lock and cooperating writers wait until the scan ends.
+func WithSharedLock() Option {
+	return func(ip *IPCounter) {
+		ip.sharedLock = true
+	}
+}
+
+// WithChangeCheck compares size, mtime and inode of the input file before and after the scan, see ChangeCheck.
+func WithChangeCheck(check ChangeCheck) Option {
+	return func(ip *IPCounter) {
+		ip.changeCheck = check
+	}
+}
+
+// WithFollowPoll sets how often Follow checks the file for new lines and rotation, 250ms by default.
+func WithFollowPoll(interval time.Duration) Option {
+	return func(ip *IPCounter) {
+		ip.followPoll = interval
+	}
+}
+
+// WithWatchPoll sets how often Watch lists the directory when it has to poll, 5s by default.
+func WithWatchPoll(interval time.Duration) Option {
+	return func(ip *IPCounter) {
+		ip.watchPoll = interval
+	}
+}
+
+// WithProgress calls observer every interval (1s when 0) during UniqueIP4 with the progress aggregated over all readers,
+// and once more with Progress.Done at the end. observer is called from a separate goroutine.
+func WithProgress(observer func(Progress), interval time.Duration) Option {
+	return func(ip *IPCounter) {
+		ip.onProgress = observer
+		ip.progressInterval = interval
+	}
+}
+
+// WithMetrics records the scans into metrics, one Metrics may be shared by several counters.
+func WithMetrics(metrics *Metrics) Option {
+	return func(ip *IPCounter) {
+		ip.metrics = metrics
+		ip.progress.metrics = metrics
+	}
+}
+
+// WithTracer traces the phases of UniqueIP4 (open, planning, every worker range, the merge loop and the final sort) with tracer.
+func WithTracer(tracer Tracer) Option {
+	return func(ip *IPCounter) {
+		ip.tracer = tracer
+	}
+}
+
+// WithLogger logs structured events of the scans to logger: the strategy decision, retries, samples of invalid lines,
+// chunk boundaries (debug level), checkpoints and the result with its timings. Nothing is logged by default.
+func WithLogger(logger *slog.Logger) Option {
+	return func(ip *IPCounter) {
+		ip.logger = logger
+	}
+}
+
+// WithRegistry classifies addresses by registry instead of DefaultRegistry.
+func WithRegistry(registry []RegistryEntry) Option {
+	return func(ip *IPCounter) {
+		ip.registry = registry
+	}
+}
+
+// WithExcludeCategories leaves the addresses of categories (e.g. CategoryPrivate) out of the count,
+// Stats.Rejected reports how many unique addresses every category lost.
+func WithExcludeCategories(categories ...string) Option {
+	return func(ip *IPCounter) {
+		ip.excludeCategories = categories
+	}
+}
+
+// WithIncludeCIDRs counts only the addresses of prefixes, together with the prefixes of other include lists.
+// Stats.Rejected reports the addresses outside every include list under IncludeFilterName.
+func WithIncludeCIDRs(name string, prefixes ...netip.Prefix) Option {
+	return func(ip *IPCounter) {
+		ip.includeLists = append(ip.includeLists, cidrList{name: name, prefixes: prefixes})
+	}
+}
+
+// WithExcludeCIDRs leaves the addresses of prefixes out of the count, Stats.Rejected reports them under
+// ExcludeFilterPrefix + name.
+func WithExcludeCIDRs(name string, prefixes ...netip.Prefix) Option {
+	return func(ip *IPCounter) {
+		ip.excludeLists = append(ip.excludeLists, cidrList{name: name, prefixes: prefixes})
+	}
+}
+
+// WithHLLPrecision sets the precision of the HyperLogLog sketches of snapshots, 4 to 18, DefaultHLLPrecision by default.
+// A sketch takes 2^precision bytes and its standard error is about 1.04/sqrt(2^precision).
+func WithHLLPrecision(precision int) Option {
+	return func(ip *IPCounter) {
+		ip.hllPrecision = precision
+	}
+}
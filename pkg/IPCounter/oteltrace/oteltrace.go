@@ -0,0 +1,76 @@
+// Package oteltrace adapts an OpenTelemetry tracer to the Tracer of the package IPCounter, so the phases of a scan
+// are exported with the OpenTelemetry SDK like the rest of a program's traces.
+package oteltrace
+
+import (
+	"context"
+	"fmt"
+	"ip-counter/pkg/IPCounter"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer starts OpenTelemetry spans for IPCounter.WithTracer.
+type Tracer struct {
+	tracer trace.Tracer
+}
+
+// NewTracer returns a tracer starting its spans with tracer, e.g. otel.Tracer("ip-counter").
+func NewTracer(tracer trace.Tracer) *Tracer {
+	return &Tracer{tracer: tracer}
+}
+
+// Start starts a span that is a child of the OpenTelemetry span in ctx, if any.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...IPCounter.Attribute) (context.Context, IPCounter.Span) {
+	ctx, span := t.tracer.Start(ctx, name, trace.WithAttributes(keyValues(attrs)...))
+	return ctx, spanAdapter{span}
+}
+
+type spanAdapter struct {
+	span trace.Span
+}
+
+func (s spanAdapter) SetAttributes(attrs ...IPCounter.Attribute) {
+	s.span.SetAttributes(keyValues(attrs)...)
+}
+
+// RecordError records err as an event and marks the span as failed.
+func (s spanAdapter) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.span.RecordError(err)
+	s.span.SetStatus(codes.Error, err.Error())
+}
+
+func (s spanAdapter) End() {
+	s.span.End()
+}
+
+// keyValues converts attributes, values of other types than strings, integers, floats and booleans become strings.
+func keyValues(attrs []IPCounter.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, len(attrs))
+	for i, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			kvs[i] = attribute.String(attr.Key, v)
+		case bool:
+			kvs[i] = attribute.Bool(attr.Key, v)
+		case int:
+			kvs[i] = attribute.Int(attr.Key, v)
+		case int64:
+			kvs[i] = attribute.Int64(attr.Key, v)
+		case int32:
+			kvs[i] = attribute.Int64(attr.Key, int64(v))
+		case uint32:
+			kvs[i] = attribute.Int64(attr.Key, int64(v))
+		case float64:
+			kvs[i] = attribute.Float64(attr.Key, v)
+		default:
+			kvs[i] = attribute.String(attr.Key, fmt.Sprint(v))
+		}
+	}
+	return kvs
+}
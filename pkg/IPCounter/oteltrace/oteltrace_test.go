@@ -0,0 +1,60 @@
+package oteltrace
+
+import (
+	"context"
+	"errors"
+	"ip-counter/pkg/IPCounter"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tracer := NewTracer(provider.Tracer("test"))
+
+	path := filepath.Join(t.TempDir(), "ips")
+	if err := os.WriteFile(path, []byte("1.1.1.1\n2.2.2.2\n1.1.1.1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ip := IPCounter.NewIPCounter(1, '\n', IPCounter.WithTracer(tracer))
+	if n, err := ip.UniqueIP4(context.Background(), path); err != nil || n != 2 {
+		t.Fatalf("UniqueIP4() = %d, %v; want 2", n, err)
+	}
+	spans := recorder.Ended()
+	var root sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if span.Name() == "ipcounter.UniqueIP4" {
+			root = span
+		}
+	}
+	if root == nil {
+		t.Fatalf("no ipcounter.UniqueIP4 span in %d spans", len(spans))
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range root.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	if attrs["path"].AsString() != path || attrs["unique"].AsInt64() != 2 {
+		t.Errorf("attributes = %v; want the path and 2 unique addresses", root.Attributes())
+	}
+	for _, span := range spans {
+		if span.SpanContext().TraceID() != root.SpanContext().TraceID() {
+			t.Errorf("span %s isn't in the trace of the scan", span.Name())
+		}
+	}
+
+	_, span := tracer.Start(context.Background(), "failing", IPCounter.Attr("size", uint32(7)))
+	span.RecordError(errors.New("boom"))
+	span.End()
+	failed := recorder.Ended()[len(recorder.Ended())-1]
+	if failed.Status().Code != codes.Error || failed.Status().Description != "boom" || failed.Attributes()[0].Value.AsInt64() != 7 {
+		t.Errorf("failed span status = %v, attributes %v; want an error and size 7", failed.Status(), failed.Attributes())
+	}
+}
@@ -0,0 +1,195 @@
+package IPCounter
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"math/bits"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OverlapSketchSize is the number of hashes of the MinHash sketch of every input, the error of an estimated
+// Jaccard similarity is about 1/sqrt(OverlapSketchSize).
+const OverlapSketchSize = 1024
+
+// Overlap is the N×N matrix of how much the unique addresses of N files overlap.
+type Overlap struct {
+	Labels       []string    `json:"labels"`       // base names of the files without extension, the full path for duplicates
+	Unique       []int64     `json:"unique"`       // exact unique addresses of every file
+	Intersection [][]int64   `json:"intersection"` // addresses two files share, estimated when Exact is false
+	Jaccard      [][]float64 `json:"jaccard"`      // intersection over union, 0 for two empty files
+	Exact        bool        `json:"exact"`        // computed from the sets instead of MinHash sketches
+}
+
+// OverlapMatrix counts the unique IPv4 addresses of every path like UniqueIP4 and returns the intersection size and
+// Jaccard similarity of every pair. The set of every file is kept in compressed form while the sets take at most
+// maxMemory bytes, and the matrix is exact. Past that, or with maxMemory 0, the sets are dropped and the matrix is
+// estimated from a bottom-k MinHash sketch of every file together with its exact unique count; pairs whose union
+// fits the sketch are still exact.
+func (ip *IPCounter) OverlapMatrix(ctx context.Context, paths []string, maxMemory int64) (*Overlap, error) {
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	n := len(paths)
+	result := &Overlap{Labels: overlapLabels(paths), Unique: make([]int64, n), Exact: maxMemory > 0}
+	sets := make([]ip4Set, n)
+	sketches := make([]bottomK, n)
+	var memory int64
+	for i, path := range paths {
+		unique, err := ip.UniqueIP4(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		result.Unique[i] = unique
+		if sketches[i], err = newBottomK(ctx, ip.set, OverlapSketchSize); err != nil {
+			return nil, err
+		}
+		if result.Exact {
+			compact := roaringFromSet(ip.set)
+			if memory += compact.memory(); memory > maxMemory {
+				result.Exact = false
+				clear(sets)
+			} else {
+				sets[i] = compact
+			}
+		}
+		ip.set = nil
+	}
+	result.Intersection = make([][]int64, n)
+	result.Jaccard = make([][]float64, n)
+	for i := range paths {
+		result.Intersection[i] = make([]int64, n)
+		result.Jaccard[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			var intersection int64
+			switch {
+			case i == j:
+				intersection = result.Unique[i]
+			case result.Exact:
+				err := combineWords(ctx, []ip4Set{sets[i], sets[j]}, func(_ uint32, words []uint64) bool {
+					intersection += int64(bits.OnesCount64(words[0] & words[1]))
+					return true
+				})
+				if err != nil {
+					return nil, err
+				}
+			default:
+				jaccard := sketches[i].jaccard(sketches[j], OverlapSketchSize)
+				intersection = int64(math.Round(jaccard * float64(result.Unique[i]+result.Unique[j]) / (1 + jaccard)))
+				intersection = min(intersection, result.Unique[i], result.Unique[j])
+			}
+			var jaccard float64
+			if union := result.Unique[i] + result.Unique[j] - intersection; union > 0 {
+				jaccard = float64(intersection) / float64(union)
+			}
+			result.Intersection[i][j], result.Intersection[j][i] = intersection, intersection
+			result.Jaccard[i][j], result.Jaccard[j][i] = jaccard, jaccard
+		}
+	}
+	return result, nil
+}
+
+// overlapLabels returns the base names of paths without extension, the full path for the names that repeat.
+func overlapLabels(paths []string) []string {
+	labels := make([]string, len(paths))
+	seen := map[string]int{}
+	for i, path := range paths {
+		base := filepath.Base(path)
+		labels[i] = strings.TrimSuffix(base, filepath.Ext(base))
+		seen[labels[i]]++
+	}
+	for i, path := range paths {
+		if seen[labels[i]] > 1 {
+			labels[i] = path
+		}
+	}
+	return labels
+}
+
+// bottomK is a MinHash sketch: the smallest hashes of the addresses of a set, ascending.
+type bottomK []uint64
+
+// newBottomK returns the sketch of the k smallest hashes of set.
+func newBottomK(ctx context.Context, set ip4Seq, k int) (bottomK, error) {
+	h := make(hashHeap, 0, k)
+	var (
+		seen int64
+		err  error
+	)
+	set.each(func(ip32 uint32) bool {
+		if seen++; seen%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		hash := hash32(ip32)
+		if len(h) < k {
+			heap.Push(&h, hash)
+		} else if hash < h[0] {
+			h[0] = hash
+			heap.Fix(&h, 0)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(h, func(i, j int) bool {
+		return h[i] < h[j]
+	})
+	return bottomK(h), nil
+}
+
+// jaccard estimates the Jaccard similarity of the sets of two sketches of size k: of the k smallest hashes of
+// the union, the share both sets have. It's exact when the union has no more than k addresses.
+func (a bottomK) jaccard(b bottomK, k int) float64 {
+	var taken, both int
+	for i, j := 0, 0; taken < k && (i < len(a) || j < len(b)); taken++ {
+		switch {
+		case j == len(b) || i < len(a) && a[i] < b[j]:
+			i++
+		case i == len(a) || b[j] < a[i]:
+			j++
+		default:
+			both++
+			i++
+			j++
+		}
+	}
+	if taken == 0 {
+		return 0
+	}
+	return float64(both) / float64(taken)
+}
+
+// hash32 mixes ip32 into 64 bits with the splitmix64 finalizer, a bijection, so distinct addresses never collide.
+func hash32(ip32 uint32) uint64 {
+	return mix64(uint64(ip32) + 0x9e3779b97f4a7c15)
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(z uint64) uint64 {
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// hashHeap is a max-heap of hashes, its root is the first to be replaced by a smaller one.
+type hashHeap []uint64
+
+func (h hashHeap) Len() int           { return len(h) }
+func (h hashHeap) Less(i, j int) bool { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x any)        { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,94 @@
+package IPCounter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOverlapMatrix(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, addrs ...string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(strings.Join(addrs, "\n")+"\n"), 0o644); err != nil {
+			t.Fatalf("Failed to write data to temp file: %v", err)
+		}
+		return path
+	}
+	paths := []string{
+		write("fw.log", "1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4"),
+		write("proxy.log", "3.3.3.3", "4.4.4.4", "5.5.5.5", "3.3.3.3"),
+		write("vpn.txt", "9.9.9.9", "1.1.1.1"),
+	}
+	wantIntersection := [][]int64{{4, 2, 1}, {2, 3, 0}, {1, 0, 2}}
+	wantJaccard := [][]float64{{1, 0.4, 0.2}, {0.4, 1, 0}, {0.2, 0, 1}}
+	for _, maxMemory := range []int64{1 << 20, 0, 1} {
+		t.Run(fmt.Sprint(maxMemory), func(t *testing.T) {
+			result, err := NewIPCounter(1, '\n').OverlapMatrix(context.Background(), paths, maxMemory)
+			if err != nil {
+				t.Fatalf("OverlapMatrix() returned an error: %v", err)
+			}
+			if result.Exact != (maxMemory == 1<<20) {
+				t.Errorf("Exact = %v with %d bytes", result.Exact, maxMemory)
+			}
+			if !reflect.DeepEqual(result.Labels, []string{"fw", "proxy", "vpn"}) {
+				t.Errorf("Labels = %v", result.Labels)
+			}
+			if !reflect.DeepEqual(result.Unique, []int64{4, 3, 2}) {
+				t.Errorf("Unique = %v", result.Unique)
+			}
+			// the sets are smaller than the sketch, so the estimates are exact too
+			if !reflect.DeepEqual(result.Intersection, wantIntersection) {
+				t.Errorf("Intersection = %v; want %v", result.Intersection, wantIntersection)
+			}
+			if !reflect.DeepEqual(result.Jaccard, wantJaccard) {
+				t.Errorf("Jaccard = %v; want %v", result.Jaccard, wantJaccard)
+			}
+		})
+	}
+}
+
+func TestBottomKJaccard(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a, b := newRoaringSet(), newRoaringSet()
+	for i := 0; i < 60000; i++ {
+		ip32 := rng.Uint32()
+		switch i % 3 {
+		case 0:
+			a.add(ip32)
+		case 1:
+			b.add(ip32)
+		default:
+			a.add(ip32)
+			b.add(ip32)
+		}
+	}
+	sketchA, err := newBottomK(context.Background(), a, OverlapSketchSize)
+	if err != nil {
+		t.Fatalf("newBottomK() returned an error: %v", err)
+	}
+	sketchB, _ := newBottomK(context.Background(), b, OverlapSketchSize)
+	if got := sketchA.jaccard(sketchB, OverlapSketchSize); math.Abs(got-1.0/3) > 0.05 {
+		t.Errorf("jaccard() = %f; want about 1/3", got)
+	}
+	if got := sketchA.jaccard(sketchA, OverlapSketchSize); got != 1 {
+		t.Errorf("jaccard() of the same sketch = %f; want 1", got)
+	}
+	if got := sketchA.jaccard(nil, OverlapSketchSize); got != 0 {
+		t.Errorf("jaccard() with an empty sketch = %f; want 0", got)
+	}
+}
+
+func TestOverlapLabels(t *testing.T) {
+	got := overlapLabels([]string{"a/fw.log", "b/fw.log", "c/proxy.log.gz", "vpn"})
+	want := []string{"a/fw.log", "b/fw.log", "proxy.log", "vpn"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("overlapLabels() = %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,55 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+)
+
+// Range is the byte range [Start, End) of the input file.
+type Range struct {
+	Start int64
+	End   int64
+}
+
+// stop ends a scan interrupted by err: it saves the final checkpoint, records the processed ranges and,
+// with WithPartialResult, returns the number of unique addresses found so far when the scan was cancelled.
+func (ip *IPCounter) stop(err error, cp *checkpoint) (int64, error) {
+	ip.covered = cp.coveredRanges()
+	err = ip.finalCheckpoint(err, cp)
+	if !ip.partialResult || !isCancellation(err) {
+		return 0, err
+	}
+	if cp.bitmap != nil {
+		return cp.uniqueCount, err
+	}
+	return ip4SortCount(cp.ips), err
+}
+
+// coveredRanges returns the processed part of every chunk, adjacent parts are joined.
+func (cp *checkpoint) coveredRanges() []Range {
+	ranges := make([]Range, 0, len(cp.positions))
+	for i := range cp.positions {
+		start, end := cp.chunkStart(i), cp.progress[i]
+		if end <= start {
+			continue
+		}
+		if last := len(ranges) - 1; last >= 0 && ranges[last].End == start {
+			ranges[last].End = end
+			continue
+		}
+		ranges = append(ranges, Range{Start: start, End: end})
+	}
+	return ranges
+}
+
+func rangesLength(ranges []Range) int64 {
+	var length int64
+	for _, r := range ranges {
+		length += r.End - r.Start
+	}
+	return length
+}
+
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,73 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCoveredRanges(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []int64
+		progress  []int64
+		want      []Range
+	}{
+		{name: "Sequential", positions: []int64{100}, progress: []int64{40}, want: []Range{{Start: 0, End: 40}}},
+		{name: "Nothing processed", positions: []int64{100}, progress: []int64{0}, want: []Range{}},
+		{name: "Completed chunks are joined", positions: []int64{10, 20, 30}, progress: []int64{10, 20, 25}, want: []Range{{Start: 0, End: 25}}},
+		{name: "Gaps between chunks", positions: []int64{10, 20, 30}, progress: []int64{5, 10, 30}, want: []Range{{Start: 0, End: 5}, {Start: 20, End: 30}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cp := &checkpoint{positions: tt.positions, progress: tt.progress}
+			if got := cp.coveredRanges(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coveredRanges() = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUniqueIP4PartialResult(t *testing.T) {
+	var data strings.Builder
+	for i := 0; i < 30000; i++ {
+		data.WriteString(fmt.Sprintf("10.0.%d.%d\n", i/256, i%256))
+	}
+	path := writeTempFile(t, data.String())
+
+	tests := []struct {
+		name    string
+		options []Option
+		partial bool
+	}{
+		{name: "Without partial result", options: nil, partial: false},
+		{name: "With partial result", options: []Option{WithPartialResult()}, partial: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipCounter := NewIPCounter(1, '\n', append(tt.options, WithReadLimit(100000))...)
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+			count, err := ipCounter.UniqueIP4(ctx, path)
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("UniqueIP4() error = %v; want %v", err, context.DeadlineExceeded)
+			}
+			stats := ipCounter.GetStats()
+			if !stats.Partial || len(stats.CoveredRanges) != 1 || stats.CoveredRanges[0].Start != 0 {
+				t.Fatalf("GetStats() = %+v; want a partial scan from the start of the file", stats)
+			}
+			covered := data.String()[:stats.BytesCovered]
+			wantCount := int64(strings.Count(covered, "\n")) //every line is a different address
+			if !tt.partial {
+				wantCount = 0
+			}
+			if count != wantCount {
+				t.Errorf("UniqueIP4() = %d; want %d", count, wantCount)
+			}
+		})
+	}
+}
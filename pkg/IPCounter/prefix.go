@@ -0,0 +1,143 @@
+package IPCounter
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+)
+
+// ErrInvalidPrefixLength is returned for a prefix length outside 0..32.
+var ErrInvalidPrefixLength = errors.New("invalid IPv4 prefix length")
+
+// PrefixStats are the unique addresses of a file grouped by prefixes of one length.
+type PrefixStats struct {
+	Bits     int           // the prefix length
+	Distinct int64         // prefixes holding at least one address, e.g. the number of distinct /24s
+	Top      []PrefixCount // the densest prefixes, most addresses first, lower prefixes first on ties
+}
+
+// PrefixCount is the number of unique addresses in a prefix.
+type PrefixCount struct {
+	Prefix netip.Prefix
+	Count  int64
+}
+
+// PrefixCounts counts the unique IPv4 addresses of path like UniqueIP4 and groups them by every prefix length of lengths,
+// all from the set of the single scan. For every length it returns the number of distinct prefixes and the topK densest ones.
+// histogram (may be nil) receives every non-empty prefix with its count as soon as the walk leaves it: the prefixes of
+// one length come in ascending order, interleaved with those of the other lengths (Prefix.Bits tells them apart).
+func (ip *IPCounter) PrefixCounts(ctx context.Context, path string, lengths []int, topK int, histogram func(PrefixCount)) ([]PrefixStats, error) {
+	for _, length := range lengths {
+		if length < 0 || length > 32 {
+			return nil, fmt.Errorf("%w: %d", ErrInvalidPrefixLength, length)
+		}
+	}
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	if _, err := ip.UniqueIP4(ctx, path); err != nil {
+		return nil, err
+	}
+	return prefixCounts(ctx, ip.set, lengths, topK, histogram)
+}
+
+// prefixGroup follows the prefixes of one length while the set is walked in ascending order.
+type prefixGroup struct {
+	stats   PrefixStats
+	shift   uint
+	current uint32
+	count   int64
+	top     prefixHeap
+	topK    int
+}
+
+// flush ends the current prefix.
+func (g *prefixGroup) flush(histogram func(PrefixCount)) {
+	if g.count == 0 {
+		return
+	}
+	g.stats.Distinct++
+	pc := PrefixCount{Prefix: netip.PrefixFrom(addrFrom32(uint32(uint64(g.current)<<g.shift)), g.stats.Bits), Count: g.count}
+	if histogram != nil {
+		histogram(pc)
+	}
+	if g.topK > 0 {
+		if len(g.top) < g.topK {
+			heap.Push(&g.top, pc)
+		} else if pc.Count > g.top[0].Count { //on ties the prefix already kept is lower
+			g.top[0] = pc
+			heap.Fix(&g.top, 0)
+		}
+	}
+	g.count = 0
+}
+
+// prefixCounts groups set by every length of lengths in one walk over the set.
+func prefixCounts(ctx context.Context, set ip4Set, lengths []int, topK int, histogram func(PrefixCount)) ([]PrefixStats, error) {
+	groups := make([]prefixGroup, len(lengths))
+	for i, length := range lengths {
+		groups[i] = prefixGroup{stats: PrefixStats{Bits: length}, shift: uint(32 - length), topK: topK}
+	}
+	var (
+		seen int64
+		err  error
+	)
+	set.each(func(ip32 uint32) bool {
+		if seen++; seen%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		for i := range groups {
+			g := &groups[i]
+			prefix := uint32(uint64(ip32) >> g.shift)
+			if g.count > 0 && prefix != g.current {
+				g.flush(histogram)
+			}
+			g.current = prefix
+			g.count++
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := make([]PrefixStats, len(groups))
+	for i := range groups {
+		g := &groups[i]
+		g.flush(histogram)
+		sort.Slice(g.top, func(a, b int) bool {
+			return g.top.less(b, a)
+		})
+		g.stats.Top = g.top
+		stats[i] = g.stats
+	}
+	return stats, nil
+}
+
+// prefixHeap is a min-heap of the densest prefixes, its root is the first to be replaced.
+type prefixHeap []PrefixCount
+
+// less orders by count and then by prefix descending, so of equal counts the higher prefix goes first.
+func (h prefixHeap) less(i, j int) bool {
+	if h[i].Count != h[j].Count {
+		return h[i].Count < h[j].Count
+	}
+	return h[j].Prefix.Addr().Less(h[i].Prefix.Addr())
+}
+
+func (h prefixHeap) Len() int           { return len(h) }
+func (h prefixHeap) Less(i, j int) bool { return h.less(i, j) }
+func (h prefixHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *prefixHeap) Push(x any)        { *h = append(*h, x.(PrefixCount)) }
+func (h *prefixHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,79 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestPrefixCounts(t *testing.T) {
+	set := setOf(t, "10.0.0.1", "10.0.0.2", "10.0.1.1", "10.1.0.1", "10.1.0.2", "10.1.0.3", "192.168.0.1")
+	var histogram []string
+	stats, err := prefixCounts(context.Background(), set, []int{0, 8, 16, 24, 32}, 2, func(pc PrefixCount) {
+		if pc.Prefix.Bits() == 24 {
+			histogram = append(histogram, fmt.Sprintf("%s=%d", pc.Prefix, pc.Count))
+		}
+	})
+	if err != nil {
+		t.Fatalf("prefixCounts() returned an error: %v", err)
+	}
+	tests := []struct {
+		bits     int
+		distinct int64
+		top      []string
+	}{
+		{bits: 0, distinct: 1, top: []string{"0.0.0.0/0=7"}},
+		{bits: 8, distinct: 2, top: []string{"10.0.0.0/8=6", "192.0.0.0/8=1"}},
+		{bits: 16, distinct: 3, top: []string{"10.0.0.0/16=3", "10.1.0.0/16=3"}},
+		{bits: 24, distinct: 4, top: []string{"10.1.0.0/24=3", "10.0.0.0/24=2"}},
+		{bits: 32, distinct: 7, top: []string{"10.0.0.1/32=1", "10.0.0.2/32=1"}},
+	}
+	for i, tt := range tests {
+		got := stats[i]
+		top := make([]string, len(got.Top))
+		for j, pc := range got.Top {
+			top[j] = fmt.Sprintf("%s=%d", pc.Prefix, pc.Count)
+		}
+		if got.Bits != tt.bits || got.Distinct != tt.distinct || !reflect.DeepEqual(top, tt.top) {
+			t.Errorf("prefixCounts() /%d = %d distinct, top %v; want %d, %v", tt.bits, got.Distinct, top, tt.distinct, tt.top)
+		}
+	}
+	wantHistogram := []string{"10.0.0.0/24=2", "10.0.1.0/24=1", "10.1.0.0/24=3", "192.168.0.0/24=1"}
+	if !reflect.DeepEqual(histogram, wantHistogram) {
+		t.Errorf("histogram of /24 = %v; want %v", histogram, wantHistogram)
+	}
+}
+
+func TestPrefixCountsHistogramOrder(t *testing.T) {
+	set := setOf(t, "10.0.0.1", "10.0.0.2", "10.0.1.1", "10.1.0.1", "10.1.0.2", "10.1.0.3", "192.168.0.1")
+	var histogram []string
+	_, err := prefixCounts(context.Background(), set, []int{16, 24}, 0, func(pc PrefixCount) {
+		histogram = append(histogram, fmt.Sprintf("%s=%d", pc.Prefix, pc.Count))
+	})
+	if err != nil {
+		t.Fatalf("prefixCounts() returned an error: %v", err)
+	}
+	want := []string{
+		"10.0.0.0/24=2", "10.0.0.0/16=3", "10.0.1.0/24=1", "10.1.0.0/16=3",
+		"10.1.0.0/24=3", "192.168.0.0/16=1", "192.168.0.0/24=1",
+	}
+	if !reflect.DeepEqual(histogram, want) {
+		t.Errorf("histogram of /16 and /24 = %v; want %v", histogram, want)
+	}
+}
+
+func TestPrefixCountsFile(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n10.0.0.2\n10.0.1.1\n10.0.0.1\n")
+	stats, err := NewIPCounter(1, '\n').PrefixCounts(context.Background(), path, []int{24}, 0, nil)
+	if err != nil {
+		t.Fatalf("PrefixCounts() returned an error: %v", err)
+	}
+	if len(stats) != 1 || stats[0].Distinct != 2 || len(stats[0].Top) != 0 {
+		t.Errorf("PrefixCounts() = %+v; want 2 distinct /24s", stats)
+	}
+	if _, err = NewIPCounter(1, '\n').PrefixCounts(context.Background(), path, []int{33}, 0, nil); !errors.Is(err, ErrInvalidPrefixLength) {
+		t.Errorf("PrefixCounts() of /33 error = %v; want %v", err, ErrInvalidPrefixLength)
+	}
+}
@@ -0,0 +1,144 @@
+package IPCounter
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+const defaultProgressInterval = time.Second
+
+// Progress is a snapshot of a running scan, aggregated over all reader goroutines.
+type Progress struct {
+	BytesProcessed int64 // bytes of the file whose lines are counted, a resumed scan includes the part done before
+	TotalBytes     int64
+	Lines          int64 // non-empty lines
+	ValidLines     int64 // lines holding an IPv4 address
+	InvalidLines   int64
+	UniqueCount    int64 // unique addresses so far, the sequential reader of small files knows it only at the end
+	Elapsed        time.Duration
+	ETA            time.Duration // estimated time left, 0 when unknown
+	Done           bool          // the last report of the scan
+}
+
+// invalidCounts are the numbers of rejected lines by reason.
+type invalidCounts [numInvalidReasons]int64
+
+func (c *invalidCounts) total() int64 {
+	var total int64
+	for _, n := range c {
+		total += n
+	}
+	return total
+}
+
+// byName returns the non-zero counts by reason name.
+func (c *invalidCounts) byName() map[string]int64 {
+	counts := make(map[string]int64)
+	for reason, n := range c {
+		if n > 0 {
+			counts[invalidReasonNames[reason]] = n
+		}
+	}
+	return counts
+}
+
+// scanProgress holds the counters the readers publish for the progress reporter and the metrics.
+type scanProgress struct {
+	bytes   atomic.Int64
+	valid   atomic.Int64
+	invalid [numInvalidReasons]atomic.Int64
+	unique  atomic.Int64
+	metrics *Metrics //receives what changed since the previous publish, may be nil
+}
+
+func (p *scanProgress) reset() {
+	p.bytes.Store(0)
+	p.valid.Store(0)
+	for i := range p.invalid {
+		p.invalid[i].Store(0)
+	}
+	p.unique.Store(0)
+}
+
+// publish stores the counters of a reader, it's called every few thousand lines rather than for every one.
+// Only one goroutine of a scan publishes.
+func (p *scanProgress) publish(bytes int64, valid int64, invalid *invalidCounts, unique int64) {
+	bytesDelta := bytes - p.bytes.Swap(bytes)
+	validDelta := valid - p.valid.Swap(valid)
+	var invalidDelta invalidCounts
+	for i, n := range invalid {
+		invalidDelta[i] = n - p.invalid[i].Swap(n)
+	}
+	p.unique.Store(unique)
+	if p.metrics != nil {
+		p.metrics.addLines(bytesDelta, validDelta, &invalidDelta, unique)
+	}
+}
+
+// setUnique stores the unique count of a scan that knows it only at the end.
+func (p *scanProgress) setUnique(unique int64) {
+	p.unique.Store(unique)
+	if p.metrics != nil {
+		p.metrics.unique.Store(unique)
+	}
+}
+
+func (p *scanProgress) invalidCounts() invalidCounts {
+	var counts invalidCounts
+	for i := range p.invalid {
+		counts[i] = p.invalid[i].Load()
+	}
+	return counts
+}
+
+// snapshot builds the Progress of a scan started at start with startBytes already processed (resume).
+func (p *scanProgress) snapshot(total int64, start time.Time, startBytes int64) Progress {
+	invalid := p.invalidCounts()
+	progress := Progress{
+		BytesProcessed: p.bytes.Load(),
+		TotalBytes:     total,
+		ValidLines:     p.valid.Load(),
+		InvalidLines:   invalid.total(),
+		UniqueCount:    p.unique.Load(),
+		Elapsed:        time.Since(start),
+	}
+	progress.Lines = progress.ValidLines + progress.InvalidLines
+	if done := progress.BytesProcessed - startBytes; done > 0 && progress.BytesProcessed < total {
+		rate := float64(done) / progress.Elapsed.Seconds()
+		progress.ETA = time.Duration(float64(total-progress.BytesProcessed) / rate * float64(time.Second)).Round(time.Second)
+	}
+	return progress
+}
+
+// startProgress calls the progress observer every interval until the returned stop is called, stop makes the final Done report.
+func (ip *IPCounter) startProgress(start time.Time, startBytes int64) (stop func()) {
+	if ip.onProgress == nil {
+		return func() {}
+	}
+	interval := ip.progressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	quit := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-quit:
+				return
+			case <-ticker.C:
+				ip.onProgress(ip.progress.snapshot(ip.fileSize, start, startBytes))
+			}
+		}
+	}()
+	return func() {
+		close(quit)
+		<-finished
+		final := ip.progress.snapshot(ip.fileSize, start, startBytes)
+		final.Done = true
+		ip.onProgress(final)
+	}
+}
@@ -0,0 +1,65 @@
+package IPCounter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScanProgressSnapshot(t *testing.T) {
+	var progress scanProgress
+	invalid := invalidCounts{reasonCharacter: 3, reasonFormat: 2}
+	progress.publish(250, 20, &invalid, 10)
+	start := time.Now().Add(-10 * time.Second)
+	got := progress.snapshot(1000, start, 0)
+	if got.BytesProcessed != 250 || got.Lines != 25 || got.ValidLines != 20 || got.InvalidLines != 5 || got.UniqueCount != 10 {
+		t.Errorf("snapshot() = %+v", got)
+	}
+	if got.ETA < 29*time.Second || got.ETA > 31*time.Second { //a quarter took 10s
+		t.Errorf("snapshot().ETA = %s; want 30s", got.ETA)
+	}
+	// 200 bytes were done before a resume, only the last 50 tell the speed
+	if got := progress.snapshot(1000, start, 200); got.ETA < 149*time.Second || got.ETA > 151*time.Second {
+		t.Errorf("snapshot().ETA of resumed scan = %s; want 150s", got.ETA)
+	}
+	if got := progress.snapshot(1000, time.Now(), 250); got.ETA != 0 {
+		t.Errorf("snapshot().ETA without progress = %s; want 0", got.ETA)
+	}
+}
+
+func TestUniqueIP4Progress(t *testing.T) {
+	data := generateLargeFileData(20000, '\n') + "invalid\n\n"
+	path := writeTempFile(t, data)
+	var (
+		mu      sync.Mutex
+		reports []Progress
+	)
+	observer := func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, p)
+	}
+	ipCounter := NewIPCounter(1, '\n', WithProgress(observer, 50*time.Millisecond), WithReadLimit(200000))
+	if _, err := ipCounter.UniqueIP4(context.Background(), path); err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 3 {
+		t.Fatalf("observer was called %d times; want periodic reports", len(reports))
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].BytesProcessed < reports[i-1].BytesProcessed {
+			t.Errorf("BytesProcessed went back from %d to %d", reports[i-1].BytesProcessed, reports[i].BytesProcessed)
+		}
+	}
+	last := reports[len(reports)-1]
+	if !last.Done || last.BytesProcessed != int64(len(data)) || last.ValidLines != 20000 || last.InvalidLines != 1 || last.UniqueCount != 255 {
+		t.Errorf("final report = %+v", last)
+	}
+	stats := ipCounter.GetStats()
+	if stats.Lines != 20001 || stats.InvalidLines != 1 {
+		t.Errorf("GetStats() lines = %d, invalid = %d; want 20001, 1", stats.Lines, stats.InvalidLines)
+	}
+}
@@ -0,0 +1,127 @@
+package IPCounter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting read bandwidth in bytes per second.
+// One limiter is shared by all readers of a scan and its rate may be changed while they run.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      int64 //bytes per second, 0 means unlimited
+	tokens    float64
+	last      time.Time
+	throttled atomic.Int64 //nanoseconds spent waiting
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	l := &rateLimiter{}
+	l.setRate(bytesPerSecond)
+	return l
+}
+
+// setRate changes the limit, the bucket starts full so the new rate applies from the next read.
+func (l *rateLimiter) setRate(bytesPerSecond int64) {
+	if bytesPerSecond < 0 {
+		bytesPerSecond = 0
+	}
+	l.mu.Lock()
+	l.rate = bytesPerSecond
+	l.tokens = l.burst()
+	l.last = time.Now()
+	l.mu.Unlock()
+}
+
+func (l *rateLimiter) getRate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// burst is the bucket size: one second of traffic, but never less than a single read chunk.
+func (l *rateLimiter) burst() float64 {
+	if l.rate < directIOChunkSize {
+		return directIOChunkSize
+	}
+	return float64(l.rate)
+}
+
+// wait takes n bytes from the bucket and sleeps until they are paid off or the context is done.
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate == 0 {
+		l.mu.Unlock()
+		return nil
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if burst := l.burst(); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	start := time.Now()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.throttled.Add(int64(time.Since(start)))
+		return ctx.Err()
+	case <-timer.C:
+	}
+	l.throttled.Add(int64(time.Since(start)))
+	return nil
+}
+
+// throttledTime returns the time all readers spent waiting for the limiter since the last reset.
+func (l *rateLimiter) throttledTime() time.Duration {
+	return time.Duration(l.throttled.Load())
+}
+
+func (l *rateLimiter) resetThrottled() {
+	l.throttled.Store(0)
+}
+
+// throttledReader paces the reads of the underlying reader through a shared limiter. The bytes are paid after the read,
+// so a short read at the end of the file costs only what it returned. Every scan reads through its own throttledReader,
+// waiting for the limiter ends when the context of that scan is done.
+type throttledReader struct {
+	ctx     context.Context
+	reader  fileReader
+	limiter *rateLimiter
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	n, err := t.reader.Read(p)
+	if waitErr := t.limiter.wait(t.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+func (t *throttledReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := t.reader.ReadAt(p, off)
+	if waitErr := t.limiter.wait(t.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+	return n, err
+}
+
+// throttledFile returns the scanned file for the reads of the scan with ctx.
+func (ip *IPCounter) throttledFile(ctx context.Context) fileReader {
+	if ip.limiter == nil {
+		return ip.file
+	}
+	return &throttledReader{ctx: ctx, reader: ip.file, limiter: ip.limiter}
+}
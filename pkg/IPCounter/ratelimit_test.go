@@ -0,0 +1,112 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWait(t *testing.T) {
+	const rate = 1 << 20 //1mb per second
+	limiter := newRateLimiter(rate)
+	start := time.Now()
+	if err := limiter.wait(context.Background(), rate); err != nil { //drains the full bucket without waiting
+		t.Fatalf("wait() returned an error: %v", err)
+	}
+	if err := limiter.wait(context.Background(), rate/4); err != nil {
+		t.Fatalf("wait() returned an error: %v", err)
+	}
+	elapsed := time.Since(start)
+	if elapsed < 200*time.Millisecond || elapsed > time.Second {
+		t.Errorf("wait() took %s; want about 250ms", elapsed)
+	}
+	if limiter.throttledTime() < 200*time.Millisecond {
+		t.Errorf("throttledTime() = %s; want about 250ms", limiter.throttledTime())
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	limiter := newRateLimiter(1)
+	limiter.setRate(0)
+	if err := limiter.wait(context.Background(), 1<<30); err != nil {
+		t.Fatalf("wait() returned an error: %v", err)
+	}
+	if limiter.throttledTime() != 0 {
+		t.Errorf("throttledTime() = %s; want 0", limiter.throttledTime())
+	}
+}
+
+func TestRateLimiterContextCanceled(t *testing.T) {
+	limiter := newRateLimiter(1024)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := limiter.wait(ctx, 10*directIOChunkSize)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("wait() error = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	limiter := newRateLimiter(directIOChunkSize)
+	ipCounter := &IPCounter{file: strings.NewReader("10.0.0.1\n"), limiter: limiter}
+	buf := make([]byte, directIOChunkSize)
+	//only the 9 bytes read are paid, so the full bucket isn't drained and the next read doesn't wait
+	for i := 0; i < 2; i++ {
+		start := time.Now()
+		if n, err := ipCounter.throttledFile(context.Background()).ReadAt(buf, 0); n != 9 || !errors.Is(err, io.EOF) {
+			t.Fatalf("ReadAt() = %d, %v; want 9, EOF", n, err)
+		}
+		if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+			t.Errorf("ReadAt() %d waited %s", i, elapsed)
+		}
+	}
+
+	//once the bucket is empty the wait ends with the context of the reading scan
+	limiter.setRate(1)
+	if err := limiter.wait(context.Background(), directIOChunkSize); err != nil {
+		t.Fatalf("wait() returned an error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ipCounter.throttledFile(ctx).ReadAt(buf, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadAt() of a canceled scan error = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestUniqueIP4ReadLimit(t *testing.T) {
+	data := generateLargeFileData(20000, '\n') //about 260kb
+	tmpFile, err := os.CreateTemp("", "testfile")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(data); err != nil {
+		t.Fatalf("Failed to write data to temp file: %v", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		t.Fatalf("Failed to close temp file: %v", err)
+	}
+
+	ipCounter := NewIPCounter(1, '\n', WithReadLimit(200000)) //a bit more than one second of reading
+	count, err := ipCounter.UniqueIP4(context.Background(), tmpFile.Name())
+	if err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+	if count != 255 {
+		t.Errorf("UniqueIP4() = %d; want 255", count)
+	}
+	if ipCounter.GetStats().ThrottledTime == 0 {
+		t.Errorf("GetStats().ThrottledTime = 0; want > 0")
+	}
+	if ipCounter.GetReadLimit() != 200000 {
+		t.Errorf("GetReadLimit() = %d; want 200000", ipCounter.GetReadLimit())
+	}
+	ipCounter.SetReadLimit(0)
+	if ipCounter.GetReadLimit() != 0 {
+		t.Errorf("GetReadLimit() after SetReadLimit(0) = %d; want 0", ipCounter.GetReadLimit())
+	}
+}
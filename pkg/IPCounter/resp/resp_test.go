@@ -0,0 +1,224 @@
+package resp
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// client is a minimal RESP client reading replies as their raw first line.
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newTestClients serves a Server on a local port and returns n clients connected to it.
+func newTestClients(t *testing.T, n int) []*client {
+	t.Helper()
+	server, err := NewServer(14, nil)
+	if err != nil {
+		t.Fatalf("NewServer() returned an error: %v", err)
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- server.Serve(ctx, listener)
+	}()
+	clients := make([]*client, n)
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve() returned an error: %v", err)
+		}
+		for _, c := range clients {
+			if c != nil {
+				c.conn.Close()
+			}
+		}
+	})
+	for i := range clients {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		clients[i] = &client{conn: conn, r: bufio.NewReader(conn)}
+	}
+	return clients
+}
+
+// newTestClient serves a Server on a local port and returns a client connected to it.
+func newTestClient(t *testing.T) *client {
+	t.Helper()
+	return newTestClients(t, 1)[0]
+}
+
+// encode returns args as a RESP array of bulk strings.
+func encode(args ...string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return b.String()
+}
+
+// reply reads one reply, a bulk string is returned as its value.
+func (c *client) reply(t *testing.T) string {
+	t.Helper()
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading a reply: %v", err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if strings.HasPrefix(line, "$") && line != "$-1" {
+		value, err := c.r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading a bulk string: %v", err)
+		}
+		return strings.TrimSuffix(value, "\r\n")
+	}
+	return line
+}
+
+func (c *client) do(t *testing.T, args ...string) string {
+	t.Helper()
+	if _, err := c.conn.Write([]byte(encode(args...))); err != nil {
+		t.Fatal(err)
+	}
+	return c.reply(t)
+}
+
+func TestCommands(t *testing.T) {
+	c := newTestClient(t)
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"PING"}, want: "+PONG"},
+		{args: []string{"echo", "hi"}, want: "hi"},
+		{args: []string{"SADD", "seen", "1.1.1.1", "2001:db8::1", "1.1.1.1", "2.2.2.2"}, want: ":3"},
+		{args: []string{"SADD", "seen", "2.2.2.2", "3.3.3.3"}, want: ":1"},
+		{args: []string{"SADD", "seen", "4.4.4.4", "nope"}, want: "-ERR 'nope' isn't an IP address"},
+		{args: []string{"SCARD", "seen"}, want: ":4"},
+		{args: []string{"SCARD", "missing"}, want: ":0"},
+		{args: []string{"SISMEMBER", "seen", "2001:db8::1"}, want: ":1"},
+		{args: []string{"SISMEMBER", "seen", "4.4.4.4"}, want: ":0"},
+		{args: []string{"SISMEMBER", "seen", "nope"}, want: ":0"},
+		{args: []string{"PFADD", "a", "1.1.1.1", "2.2.2.2"}, want: ":1"},
+		{args: []string{"PFADD", "a", "1.1.1.1"}, want: ":0"},
+		{args: []string{"PFADD", "b"}, want: ":1"},
+		{args: []string{"PFADD", "b", "2.2.2.2", "2001:db8::1"}, want: ":1"},
+		{args: []string{"PFADD", "b", "nope"}, want: "-ERR 'nope' isn't an IP address"},
+		{args: []string{"PFCOUNT", "a"}, want: ":2"},
+		{args: []string{"PFCOUNT", "a", "b", "missing"}, want: ":3"},
+		{args: []string{"PFCOUNT", "a"}, want: ":2"},
+		{args: []string{"PFMERGE", "c", "a", "b"}, want: "+OK"},
+		{args: []string{"PFCOUNT", "c"}, want: ":3"},
+		{args: []string{"PFADD", "seen", "1.1.1.1"}, want: "-" + wrongType},
+		{args: []string{"PFCOUNT", "a", "seen"}, want: "-" + wrongType},
+		{args: []string{"SADD", "a", "1.1.1.1"}, want: "-" + wrongType},
+		{args: []string{"SCARD", "a"}, want: "-" + wrongType},
+		{args: []string{"EXISTS", "a", "seen", "missing"}, want: ":2"},
+		{args: []string{"DEL", "a", "missing"}, want: ":1"},
+		{args: []string{"SADD", "a", "1.1.1.1"}, want: ":1"},
+		{args: []string{"SELECT", "1"}, want: "-ERR DB index is out of range"},
+		{args: []string{"SCARD"}, want: "-ERR wrong number of arguments for 'scard' command"},
+		{args: []string{"GET", "a"}, want: "-ERR unknown command 'GET'"},
+		{args: []string{"QUIT"}, want: "+OK"},
+	}
+	for _, tt := range tests {
+		if got := c.do(t, tt.args...); got != tt.want {
+			t.Errorf("%v = %q; want %q", tt.args, got, tt.want)
+		}
+	}
+	if _, err := c.r.ReadByte(); err == nil {
+		t.Errorf("connection still open after QUIT")
+	}
+}
+
+func TestPipelining(t *testing.T) {
+	c := newTestClient(t)
+	var batch strings.Builder
+	for i := 0; i < 1000; i++ {
+		batch.WriteString(encode("SADD", "seen", fmt.Sprintf("10.0.%d.%d", i/256, i%256), "10.0.0.0"))
+	}
+	batch.WriteString("SCARD seen\r\nPING\n")
+	if _, err := c.conn.Write([]byte(batch.String())); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		if got := c.reply(t); got != ":1" {
+			t.Fatalf("reply %d = %q; want \":1\"", i, got)
+		}
+	}
+	for _, want := range []string{":1000", "+PONG"} {
+		if got := c.reply(t); got != want {
+			t.Errorf("inline reply = %q; want %q", got, want)
+		}
+	}
+}
+
+func TestLongInline(t *testing.T) {
+	c := newTestClient(t)
+	addrs := make([]string, 1000)
+	for i := range addrs {
+		addrs[i] = fmt.Sprintf("10.0.%d.%d", i/256, i%256)
+	}
+	line := "SADD seen " + strings.Join(addrs, " ") //about 11kb, beyond the default buffer of bufio
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.reply(t); got != ":1000" {
+		t.Errorf("reply to an inline SADD of %d bytes = %q; want \":1000\"", len(line), got)
+	}
+}
+
+func TestConcurrentPFADD(t *testing.T) {
+	clients := newTestClients(t, 8)
+	replies := make(chan string, len(clients))
+	for _, c := range clients {
+		go func(c *client) {
+			_, _ = c.conn.Write([]byte(encode("PFADD", "new")))
+			line, _ := c.r.ReadString('\n')
+			replies <- strings.TrimSuffix(line, "\r\n")
+		}(c)
+	}
+	created := 0
+	for range clients {
+		if <-replies == ":1" {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("%d clients created the key; want 1", created)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	for _, request := range []string{"*1\r\n+PING\r\n", fmt.Sprintf("*%d\r\n", maxArgs+1), "*1\r\n$70000\r\n",
+		strings.Repeat("PING ", maxInline/5+1) + "\r\n"} {
+		c := newTestClient(t)
+		if _, err := c.conn.Write([]byte(request)); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.reply(t); !strings.HasPrefix(got, "-ERR Protocol error") {
+			t.Errorf("reply to %q = %q; want a protocol error", request, got)
+		}
+		if _, err := c.r.ReadByte(); err == nil {
+			t.Errorf("connection still open after a protocol error")
+		}
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(3, nil); err == nil {
+		t.Errorf("NewServer(3) returned no error")
+	}
+}
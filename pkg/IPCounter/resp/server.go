@@ -0,0 +1,451 @@
+// Package resp serves sets of addresses over the Redis protocol (RESP2), so Redis clients can push addresses and
+// ask for distinct counts. Set keys are AddrSets and HyperLogLog keys Sketches of the package IPCounter, members
+// and elements have to be IPv4 or IPv6 addresses.
+package resp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"ip-counter/pkg/IPCounter"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server keeps the keys in memory and answers SADD, SISMEMBER, SCARD, PFADD, PFCOUNT and PFMERGE, plus PING,
+// ECHO, EXISTS, DEL, SELECT 0, COMMAND and QUIT for clients that send them.
+type Server struct {
+	precision int
+	logger    *slog.Logger
+
+	mu   sync.Mutex
+	keys map[string]any //*IPCounter.AddrSet or *IPCounter.Sketch
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+	wg      sync.WaitGroup
+}
+
+// NewServer returns a server creating the sketches of PFADD and PFMERGE with precision, logger may be nil.
+func NewServer(precision int, logger *slog.Logger) (*Server, error) {
+	if _, err := IPCounter.NewSketch(precision); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+	return &Server{precision: precision, logger: logger, keys: make(map[string]any), conns: make(map[net.Conn]struct{})}, nil
+}
+
+// ListenAndServe serves clients on addr until ctx is done.
+func (s *Server) ListenAndServe(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ctx, listener)
+}
+
+// Serve serves clients on listener until ctx is done, then it closes the connections and waits for them.
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	stop := context.AfterFunc(ctx, func() {
+		_ = listener.Close()
+		s.connsMu.Lock()
+		defer s.connsMu.Unlock()
+		for conn := range s.conns {
+			_ = conn.Close()
+		}
+	})
+	defer stop()
+	defer s.wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		s.connsMu.Lock()
+		s.conns[conn] = struct{}{}
+		s.connsMu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serveConn(conn)
+			s.connsMu.Lock()
+			delete(s.conns, conn)
+			s.connsMu.Unlock()
+			_ = conn.Close()
+		}()
+	}
+}
+
+// serveConn answers the commands of one client in order, replies to pipelined commands are flushed together.
+func (s *Server) serveConn(conn net.Conn) {
+	r := bufio.NewReaderSize(conn, maxInline) //an inline command has to fit in the buffer of ReadSlice
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			var protocolErr protocolError
+			if errors.As(err, &protocolErr) {
+				writeError(w, "ERR Protocol error: "+err.Error())
+				_ = w.Flush()
+			}
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				s.logger.Debug("RESP connection closed", slog.String("remote", conn.RemoteAddr().String()), slog.Any("error", err))
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.execute(w, args)
+		if r.Buffered() == 0 || quit {
+			if err = w.Flush(); err != nil || quit {
+				return
+			}
+		}
+	}
+}
+
+// command is a command with its arity like Redis counts it: the name included, negative for at least -arity.
+type command struct {
+	arity int
+	run   func(s *Server, w *bufio.Writer, args []string)
+}
+
+var commands = map[string]command{
+	"sadd":      {arity: -3, run: (*Server).sadd},
+	"sismember": {arity: 3, run: (*Server).sismember},
+	"scard":     {arity: 2, run: (*Server).scard},
+	"pfadd":     {arity: -2, run: (*Server).pfadd},
+	"pfcount":   {arity: -2, run: (*Server).pfcount},
+	"pfmerge":   {arity: -2, run: (*Server).pfmerge},
+	"exists":    {arity: -2, run: (*Server).exists},
+	"del":       {arity: -2, run: (*Server).del},
+	"ping": {arity: -1, run: func(_ *Server, w *bufio.Writer, args []string) {
+		if len(args) > 1 {
+			writeBulk(w, args[1])
+		} else {
+			writeSimple(w, "PONG")
+		}
+	}},
+	"echo": {arity: 2, run: func(_ *Server, w *bufio.Writer, args []string) {
+		writeBulk(w, args[1])
+	}},
+	"select": {arity: 2, run: func(_ *Server, w *bufio.Writer, args []string) {
+		if args[1] != "0" {
+			writeError(w, "ERR DB index is out of range")
+			return
+		}
+		writeSimple(w, "OK")
+	}},
+	"command": {arity: -1, run: func(_ *Server, w *bufio.Writer, _ []string) {
+		writeArrayHeader(w, 0) //redis-cli asks for the command docs on start
+	}},
+}
+
+// execute runs a command and writes its reply, it reports whether the client quits.
+func (s *Server) execute(w *bufio.Writer, args []string) (quit bool) {
+	name := strings.ToLower(args[0])
+	if name == "quit" {
+		writeSimple(w, "OK")
+		return true
+	}
+	cmd, ok := commands[name]
+	switch {
+	case !ok:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	case cmd.arity > 0 && len(args) != cmd.arity, cmd.arity < 0 && len(args) < -cmd.arity:
+		writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	default:
+		cmd.run(s, w, args)
+	}
+	return false
+}
+
+const wrongType = "WRONGTYPE Operation against a key holding the wrong kind of value"
+
+// parseAddrs parses every member, the whole command fails on one that isn't an address.
+func parseAddrs(w *bufio.Writer, members []string) ([]netip.Addr, bool) {
+	addrs := make([]netip.Addr, len(members))
+	for i, member := range members {
+		addr, err := netip.ParseAddr(member)
+		if err != nil {
+			writeError(w, fmt.Sprintf("ERR '%s' isn't an IP address", member))
+			return nil, false
+		}
+		addrs[i] = addr
+	}
+	return addrs, true
+}
+
+// set returns the set of key, creating it if asked, and false when key holds a sketch.
+func (s *Server) set(key string, create bool) (*IPCounter.AddrSet, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch v := s.keys[key].(type) {
+	case *IPCounter.AddrSet:
+		return v, true
+	case nil:
+		if !create {
+			return nil, true
+		}
+		set := IPCounter.NewAddrSet()
+		s.keys[key] = set
+		return set, true
+	}
+	return nil, false
+}
+
+// sketch returns the sketch of key, creating it if asked, and ok false when key holds a set. created reports
+// whether this call created it, the lookup and the creation are one step so only one client creates a key.
+func (s *Server) sketch(key string, create bool) (sketch *IPCounter.Sketch, created, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch v := s.keys[key].(type) {
+	case *IPCounter.Sketch:
+		return v, false, true
+	case nil:
+		if !create {
+			return nil, false, true
+		}
+		sketch, _ = IPCounter.NewSketch(s.precision)
+		s.keys[key] = sketch
+		return sketch, true, true
+	}
+	return nil, false, false
+}
+
+func (s *Server) sadd(w *bufio.Writer, args []string) {
+	addrs, ok := parseAddrs(w, args[2:])
+	if !ok {
+		return
+	}
+	set, ok := s.set(args[1], true)
+	if !ok {
+		writeError(w, wrongType)
+		return
+	}
+	added := 0
+	for _, addr := range addrs {
+		if set.Add(addr) {
+			added++
+		}
+	}
+	writeInt(w, int64(added))
+}
+
+func (s *Server) sismember(w *bufio.Writer, args []string) {
+	set, ok := s.set(args[1], false)
+	if !ok {
+		writeError(w, wrongType)
+		return
+	}
+	addr, err := netip.ParseAddr(args[2])
+	if set == nil || err != nil || !set.Contains(addr) {
+		writeInt(w, 0)
+		return
+	}
+	writeInt(w, 1)
+}
+
+func (s *Server) scard(w *bufio.Writer, args []string) {
+	set, ok := s.set(args[1], false)
+	switch {
+	case !ok:
+		writeError(w, wrongType)
+	case set == nil:
+		writeInt(w, 0)
+	default:
+		writeInt(w, set.Count())
+	}
+}
+
+// pfadd replies 1 when the key was created or the sketch changed, like Redis.
+func (s *Server) pfadd(w *bufio.Writer, args []string) {
+	addrs, ok := parseAddrs(w, args[2:])
+	if !ok {
+		return
+	}
+	sketch, changed, ok := s.sketch(args[1], true)
+	if !ok {
+		writeError(w, wrongType)
+		return
+	}
+	for _, addr := range addrs {
+		if sketch.Add(addr) {
+			changed = true
+		}
+	}
+	if changed {
+		writeInt(w, 1)
+	} else {
+		writeInt(w, 0)
+	}
+}
+
+// sketches returns the sketches of keys, missing keys are left out.
+func (s *Server) sketches(w *bufio.Writer, keys []string) ([]*IPCounter.Sketch, bool) {
+	var sketches []*IPCounter.Sketch
+	for _, key := range keys {
+		sketch, _, ok := s.sketch(key, false)
+		if !ok {
+			writeError(w, wrongType)
+			return nil, false
+		}
+		if sketch != nil {
+			sketches = append(sketches, sketch)
+		}
+	}
+	return sketches, true
+}
+
+// pfcount replies the estimate of one key or of the union of several keys.
+func (s *Server) pfcount(w *bufio.Writer, args []string) {
+	sketches, ok := s.sketches(w, args[1:])
+	switch {
+	case !ok:
+	case len(sketches) == 0:
+		writeInt(w, 0)
+	case len(sketches) == 1:
+		writeInt(w, sketches[0].Count())
+	default:
+		union, _ := IPCounter.NewSketch(s.precision)
+		union.Merge(sketches...)
+		writeInt(w, union.Count())
+	}
+}
+
+func (s *Server) pfmerge(w *bufio.Writer, args []string) {
+	sources, ok := s.sketches(w, args[2:])
+	if !ok {
+		return
+	}
+	dest, _, ok := s.sketch(args[1], true)
+	if !ok {
+		writeError(w, wrongType)
+		return
+	}
+	dest.Merge(sources...)
+	writeSimple(w, "OK")
+}
+
+func (s *Server) exists(w *bufio.Writer, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, key := range args[1:] {
+		if _, ok := s.keys[key]; ok {
+			n++
+		}
+	}
+	writeInt(w, int64(n))
+}
+
+func (s *Server) del(w *bufio.Writer, args []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, key := range args[1:] {
+		if _, ok := s.keys[key]; ok {
+			delete(s.keys, key)
+			n++
+		}
+	}
+	writeInt(w, int64(n))
+}
+
+const (
+	maxArgs      = 1 << 16
+	maxArgLength = 1 << 16 //addresses are short, this leaves room for PING and ECHO
+	maxInline    = 1 << 16
+)
+
+// protocolError is a request that isn't RESP, the connection is closed after the reply.
+type protocolError string
+
+func (e protocolError) Error() string {
+	return string(e)
+}
+
+// readCommand reads a command as an array of bulk strings, or an inline command of words separated by spaces.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > maxArgs {
+		return nil, protocolError("invalid multibulk length")
+	}
+	args := make([]string, 0, min(max(n, 0), 1024)) //the client may announce more arguments than it sends
+	for i := 0; i < n; i++ {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(line, "$") {
+			return nil, protocolError(fmt.Sprintf("expected '$', got '%.1s'", line))
+		}
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 || length > maxArgLength {
+			return nil, protocolError("invalid bulk length")
+		}
+		buf := make([]byte, length+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[length] != '\r' || buf[length+1] != '\n' {
+			return nil, protocolError("bulk string without CRLF")
+		}
+		args = append(args, string(buf[:length]))
+	}
+	return args, nil
+}
+
+// readLine reads a line ended by CRLF (or LF from a telnet client) without the line break.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxInline {
+		return "", protocolError("too big inline request")
+	}
+	if err != nil {
+		if len(line) > 0 && errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(line), "\n"), "\r"), nil
+}
+
+func writeSimple(w *bufio.Writer, s string) {
+	_, _ = w.WriteString("+" + s + "\r\n")
+}
+
+// writeError writes an error reply, s starts with the error code like ERR or WRONGTYPE.
+func writeError(w *bufio.Writer, s string) {
+	_, _ = w.WriteString("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(s) + "\r\n")
+}
+
+func writeInt(w *bufio.Writer, n int64) {
+	_, _ = w.WriteString(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func writeBulk(w *bufio.Writer, s string) {
+	_, _ = w.WriteString("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func writeArrayHeader(w *bufio.Writer, n int) {
+	_, _ = w.WriteString("*" + strconv.Itoa(n) + "\r\n")
+}
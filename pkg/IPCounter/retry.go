@@ -0,0 +1,120 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy decides whether a failed read is retried and how long to wait before the attempt.
+type RetryPolicy interface {
+	// Backoff is called after the attempt-th failed read (starting at 1) and returns the delay
+	// before the next attempt, or false if err must be returned to the caller.
+	Backoff(attempt int, err error) (time.Duration, bool)
+}
+
+// TransientError marks a read error that is worth retrying (EINTR, EAGAIN, EIO on network filesystems).
+// The counter wraps read errors with it before asking the RetryPolicy.
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return "transient read error: " + e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsTransient reports whether err was classified as transient.
+func IsTransient(err error) bool {
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
+
+// BackoffPolicy retries transient errors with exponential backoff and random jitter.
+type BackoffPolicy struct {
+	MaxRetries int           // retries after the first attempt
+	BaseDelay  time.Duration // delay before the first retry, doubled for every next one
+	MaxDelay   time.Duration // cap of a single delay, 0 means no cap
+	Jitter     float64       // fraction (0..1) of the delay that is randomized
+}
+
+// DefaultRetryPolicy returns the policy used when none is configured: 2 retries starting at 10ms.
+func DefaultRetryPolicy() *BackoffPolicy {
+	return &BackoffPolicy{MaxRetries: 2, BaseDelay: 10 * time.Millisecond, MaxDelay: time.Second, Jitter: 0.5}
+}
+
+func (p *BackoffPolicy) Backoff(attempt int, err error) (time.Duration, bool) {
+	if attempt > p.MaxRetries || !IsTransient(err) {
+		return 0, false
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay, true
+}
+
+// retry calls read until it succeeds, reaches io.EOF or the retry policy gives up.
+func (ip *IPCounter) retry(ctx context.Context, read func() error) error {
+	policy := ip.retryPolicy
+	if policy == nil {
+		policy = DefaultRetryPolicy()
+	}
+	for attempt := 1; ; attempt++ {
+		err := read()
+		if err == nil || errors.Is(err, io.EOF) {
+			return err
+		}
+		err = classifyReadError(err, ip.networkFS)
+		delay, ok := policy.Backoff(attempt, err)
+		if !ok {
+			return err
+		}
+		ip.retries.Add(1)
+		if ip.metrics != nil {
+			ip.metrics.retries.Add(1)
+		}
+		ip.log().WarnContext(ctx, "read retry", slog.Int("attempt", attempt), slog.Duration("delay", delay), slog.Any("error", err))
+		if err := sleepContext(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// classifyReadError wraps err into TransientError if another attempt may succeed.
+func classifyReadError(err error, networkFS bool) error {
+	if isCancellation(err) || IsTransient(err) {
+		return err
+	}
+	if isTransientErrno(err) || (networkFS && isIOErrno(err)) {
+		return &TransientError{Err: err}
+	}
+	return err
+}
+
+// sleepContext waits for the delay or until the context is done.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return checkContext(ctx)
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
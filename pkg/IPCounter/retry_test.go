@@ -0,0 +1,116 @@
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestBackoffPolicy(t *testing.T) {
+	policy := &BackoffPolicy{MaxRetries: 4, BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	transient := &TransientError{Err: syscall.EINTR}
+	tests := []struct {
+		name      string
+		attempt   int
+		err       error
+		wantDelay time.Duration
+		wantRetry bool
+	}{
+		{name: "First retry", attempt: 1, err: transient, wantDelay: 10 * time.Millisecond, wantRetry: true},
+		{name: "Second retry doubles", attempt: 2, err: transient, wantDelay: 20 * time.Millisecond, wantRetry: true},
+		{name: "Delay is capped", attempt: 4, err: transient, wantDelay: 30 * time.Millisecond, wantRetry: true},
+		{name: "Too many attempts", attempt: 5, err: transient, wantDelay: 0, wantRetry: false},
+		{name: "Permanent error", attempt: 1, err: syscall.EISDIR, wantDelay: 0, wantRetry: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, retry := policy.Backoff(tt.attempt, tt.err)
+			if delay != tt.wantDelay || retry != tt.wantRetry {
+				t.Errorf("Backoff() = %s, %v; want %s, %v", delay, retry, tt.wantDelay, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestBackoffPolicyJitter(t *testing.T) {
+	policy := &BackoffPolicy{MaxRetries: 1, BaseDelay: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		delay, _ := policy.Backoff(1, &TransientError{Err: syscall.EINTR})
+		if delay < 50*time.Millisecond || delay > 100*time.Millisecond {
+			t.Fatalf("Backoff() with jitter = %s; want between 50ms and 100ms", delay)
+		}
+	}
+}
+
+func TestClassifyReadError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		networkFS     bool
+		wantTransient bool
+	}{
+		{name: "EINTR", err: syscall.EINTR, wantTransient: true},
+		{name: "EIO on local disk", err: syscall.EIO, wantTransient: false},
+		{name: "EIO on network filesystem", err: syscall.EIO, networkFS: true, wantTransient: true},
+		{name: "EISDIR", err: syscall.EISDIR, networkFS: true, wantTransient: false},
+		{name: "Context canceled", err: context.Canceled, networkFS: true, wantTransient: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := classifyReadError(tt.err, tt.networkFS)
+			if IsTransient(err) != tt.wantTransient {
+				t.Errorf("classifyReadError(%v) transient = %v; want %v", tt.err, IsTransient(err), tt.wantTransient)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classifyReadError(%v) lost the original error", tt.err)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	policy := &BackoffPolicy{MaxRetries: 3, BaseDelay: time.Millisecond}
+	tests := []struct {
+		name        string
+		errs        []error
+		wantErr     error
+		wantRetries int64
+	}{
+		{name: "Success", errs: []error{nil}, wantErr: nil, wantRetries: 0},
+		{name: "EOF is not retried", errs: []error{io.EOF}, wantErr: io.EOF, wantRetries: 0},
+		{name: "Transient then success", errs: []error{syscall.EINTR, syscall.EINTR, nil}, wantErr: nil, wantRetries: 2},
+		{name: "Permanent error", errs: []error{syscall.EISDIR, nil}, wantErr: syscall.EISDIR, wantRetries: 0},
+		{name: "Retries exhausted", errs: []error{syscall.EINTR, syscall.EINTR, syscall.EINTR, syscall.EINTR, nil}, wantErr: syscall.EINTR, wantRetries: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ipCounter := NewIPCounter(1, '\n', WithRetryPolicy(policy))
+			calls := 0
+			err := ipCounter.retry(context.Background(), func() error {
+				calls++
+				return tt.errs[calls-1]
+			})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("retry() error = %v; want %v", err, tt.wantErr)
+			}
+			if ipCounter.retries.Load() != tt.wantRetries {
+				t.Errorf("retries = %d; want %d", ipCounter.retries.Load(), tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestRetryContextCanceled(t *testing.T) {
+	ipCounter := NewIPCounter(1, '\n', WithRetryPolicy(&BackoffPolicy{MaxRetries: 1, BaseDelay: time.Hour}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err := ipCounter.retry(ctx, func() error {
+		return syscall.EINTR
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("retry() error = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
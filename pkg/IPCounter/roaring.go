@@ -0,0 +1,283 @@
+package IPCounter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+)
+
+const roaringArrayMax = 4096 //an array container above 4096 values takes more than the 8kb bitmap container
+
+// roaringSet is a compressed set of IPv4 addresses in the spirit of Roaring bitmaps: addresses are split by
+// their high 16 bits into containers which hold the low 16 bits either as a sorted array (sparse) or a 65536 bit bitmap (dense).
+// It costs about 2 bytes per address for sparse data and never more than the 512mb of ip4Bitmap.
+type roaringSet struct {
+	keys       []uint16 //sorted high 16 bits of the containers
+	containers []*roaringContainer
+	n          int64
+}
+
+type roaringContainer struct {
+	array  []uint16 //sorted low 16 bits, nil once the container is converted to bitmap
+	bitmap []uint64
+	n      int
+}
+
+func newRoaringSet() *roaringSet {
+	return &roaringSet{}
+}
+
+// container returns the container of the high bits and its position, creating it if asked.
+func (s *roaringSet) container(high uint16, create bool) *roaringContainer {
+	i := sort.Search(len(s.keys), func(i int) bool {
+		return s.keys[i] >= high
+	})
+	if i < len(s.keys) && s.keys[i] == high {
+		return s.containers[i]
+	}
+	if !create {
+		return nil
+	}
+	c := &roaringContainer{}
+	s.keys = append(s.keys, 0)
+	copy(s.keys[i+1:], s.keys[i:])
+	s.keys[i] = high
+	s.containers = append(s.containers, nil)
+	copy(s.containers[i+1:], s.containers[i:])
+	s.containers[i] = c
+	return c
+}
+
+func (s *roaringSet) add(ip32 uint32) bool {
+	if s.container(uint16(ip32>>16), true).add(uint16(ip32)) {
+		s.n++
+		return true
+	}
+	return false
+}
+
+func (s *roaringSet) contains(ip32 uint32) bool {
+	c := s.container(uint16(ip32>>16), false)
+	return c != nil && c.contains(uint16(ip32))
+}
+
+func (s *roaringSet) count() int64 {
+	return s.n
+}
+
+func (s *roaringSet) each(fn func(ip32 uint32) bool) {
+	for i, c := range s.containers {
+		high := uint32(s.keys[i]) << 16
+		if !c.each(func(low uint16) bool {
+			return fn(high | uint32(low))
+		}) {
+			return
+		}
+	}
+}
+
+func (c *roaringContainer) add(low uint16) bool {
+	if c.bitmap != nil {
+		word, bit := low>>6, uint64(1)<<(low&63)
+		if c.bitmap[word]&bit != 0 {
+			return false
+		}
+		c.bitmap[word] |= bit
+		c.n++
+		return true
+	}
+	i := sort.Search(len(c.array), func(i int) bool {
+		return c.array[i] >= low
+	})
+	if i < len(c.array) && c.array[i] == low {
+		return false
+	}
+	if len(c.array) == roaringArrayMax {
+		c.toBitmap()
+		return c.add(low)
+	}
+	c.array = append(c.array, 0)
+	copy(c.array[i+1:], c.array[i:])
+	c.array[i] = low
+	c.n++
+	return true
+}
+
+func (c *roaringContainer) toBitmap() {
+	c.bitmap = make([]uint64, 1024)
+	for _, v := range c.array {
+		c.bitmap[v>>6] |= 1 << (v & 63)
+	}
+	c.array = nil
+}
+
+func (c *roaringContainer) contains(low uint16) bool {
+	if c.bitmap != nil {
+		return c.bitmap[low>>6]&(1<<(low&63)) != 0
+	}
+	i := sort.Search(len(c.array), func(i int) bool {
+		return c.array[i] >= low
+	})
+	return i < len(c.array) && c.array[i] == low
+}
+
+func (c *roaringContainer) each(fn func(low uint16) bool) bool {
+	if c.bitmap == nil {
+		for _, v := range c.array {
+			if !fn(v) {
+				return false
+			}
+		}
+		return true
+	}
+	for i, word := range c.bitmap {
+		for word != 0 {
+			if !fn(uint16(i<<6 | bits.TrailingZeros64(word))) {
+				return false
+			}
+			word &= word - 1
+		}
+	}
+	return true
+}
+
+// memory returns about how many bytes the set takes.
+func (s *roaringSet) memory() int64 {
+	size := int64(len(s.keys)) * (2 + 8 + 64) //key, pointer and container header
+	for _, c := range s.containers {
+		size += int64(cap(c.array))*2 + int64(len(c.bitmap))*8
+	}
+	return size
+}
+
+// roaringBuilder builds a roaringSet from 64-bit words in ascending index order, word i holds the addresses i<<6 to i<<6+63.
+type roaringBuilder struct {
+	set *roaringSet
+	c   *roaringContainer //container of the last word
+}
+
+func newRoaringBuilder() *roaringBuilder {
+	return &roaringBuilder{set: newRoaringSet()}
+}
+
+// addWord adds the addresses of word, index has to be higher than the one of the previous word.
+func (b *roaringBuilder) addWord(index uint32, word uint64) {
+	if word == 0 {
+		return
+	}
+	key := uint16(index >> 10)
+	if n := len(b.set.keys); n == 0 || b.set.keys[n-1] != key {
+		b.c = &roaringContainer{}
+		b.set.keys = append(b.set.keys, key)
+		b.set.containers = append(b.set.containers, b.c)
+	}
+	c, low := b.c, index&1023
+	count := bits.OnesCount64(word)
+	if c.bitmap == nil && c.n+count > roaringArrayMax {
+		c.toBitmap()
+	}
+	if c.bitmap != nil {
+		c.bitmap[low] = word
+	} else {
+		for w := word; w != 0; w &= w - 1 {
+			c.array = append(c.array, uint16(low<<6)|uint16(bits.TrailingZeros64(w)))
+		}
+	}
+	c.n += count
+	b.set.n += int64(count)
+}
+
+// roaringFromSet returns set as a roaringSet, a roaringSet itself is returned as it is.
+func roaringFromSet(set ip4Set) *roaringSet {
+	if r, ok := set.(*roaringSet); ok {
+		return r
+	}
+	b := newRoaringBuilder()
+	cursor := wordsOf(set)
+	for index, word, ok := cursor.next(); ok; index, word, ok = cursor.next() {
+		b.addWord(index, word)
+	}
+	return b.set
+}
+
+const (
+	roaringKindArray byte = iota
+	roaringKindBitmap
+)
+
+// writeTo encodes the set in little endian: the number of containers, then key, kind, count and values of every container.
+func (s *roaringSet) writeTo(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, uint32(len(s.keys))); err != nil {
+		return err
+	}
+	for i, c := range s.containers {
+		kind := roaringKindArray
+		if c.bitmap != nil {
+			kind = roaringKindBitmap
+		}
+		for _, v := range []any{s.keys[i], kind, uint32(c.n)} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		var err error
+		if c.bitmap != nil {
+			err = binary.Write(w, binary.LittleEndian, c.bitmap)
+		} else {
+			err = binary.Write(w, binary.LittleEndian, c.array)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRoaringSet decodes a set written by roaringSet.writeTo.
+func readRoaringSet(r io.Reader) (*roaringSet, error) {
+	var containers uint32
+	if err := binary.Read(r, binary.LittleEndian, &containers); err != nil {
+		return nil, err
+	}
+	if containers > 1<<16 {
+		return nil, fmt.Errorf("too many containers: %d", containers)
+	}
+	s := newRoaringSet()
+	for i := uint32(0); i < containers; i++ {
+		var (
+			key  uint16
+			kind byte
+			n    uint32
+			c    roaringContainer
+		)
+		for _, v := range []any{&key, &kind, &n} {
+			if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+				return nil, err
+			}
+		}
+		if len(s.keys) > 0 && key <= s.keys[len(s.keys)-1] {
+			return nil, fmt.Errorf("container %d is out of order", key)
+		}
+		switch {
+		case kind == roaringKindArray && n > 0 && n <= roaringArrayMax:
+			c.array = make([]uint16, n)
+			if err := binary.Read(r, binary.LittleEndian, c.array); err != nil {
+				return nil, err
+			}
+		case kind == roaringKindBitmap && n <= 1<<16:
+			c.bitmap = make([]uint64, 1024)
+			if err := binary.Read(r, binary.LittleEndian, c.bitmap); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("container %d has kind %d with %d values", key, kind, n)
+		}
+		c.n = int(n)
+		s.keys = append(s.keys, key)
+		s.containers = append(s.containers, &c)
+		s.n += int64(n)
+	}
+	return s, nil
+}
@@ -0,0 +1,5 @@
+// Package rpc serves the counter over gRPC, the service is ipcounter.v1.IPCounter of ipcounter.proto. The messages,
+// the client and the service descriptor are generated by protoc-gen-go and protoc-gen-go-grpc.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ipcounter.proto
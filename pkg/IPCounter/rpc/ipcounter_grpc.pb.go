@@ -0,0 +1,294 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: ipcounter.proto
+
+package rpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	IPCounter_Count_FullMethodName      = "/ipcounter.v1.IPCounter/Count"
+	IPCounter_Diff_FullMethodName       = "/ipcounter.v1.IPCounter/Diff"
+	IPCounter_Ingest_FullMethodName     = "/ipcounter.v1.IPCounter/Ingest"
+	IPCounter_WatchCount_FullMethodName = "/ipcounter.v1.IPCounter/WatchCount"
+)
+
+// IPCounterClient is the client API for IPCounter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type IPCounterClient interface {
+	// Count returns the unique addresses of files local to the server, all paths together, or of a named set.
+	Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error)
+	// Diff compares the unique addresses of two or more files.
+	Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*DiffResponse, error)
+	// Ingest adds batches of addresses to a named set, the first message names the set.
+	Ingest(ctx context.Context, opts ...grpc.CallOption) (IPCounter_IngestClient, error)
+	// WatchCount counts files like Count and streams the progress of the scan, the last message has done set and the count.
+	WatchCount(ctx context.Context, in *WatchCountRequest, opts ...grpc.CallOption) (IPCounter_WatchCountClient, error)
+}
+
+type iPCounterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewIPCounterClient(cc grpc.ClientConnInterface) IPCounterClient {
+	return &iPCounterClient{cc}
+}
+
+func (c *iPCounterClient) Count(ctx context.Context, in *CountRequest, opts ...grpc.CallOption) (*CountResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CountResponse)
+	err := c.cc.Invoke(ctx, IPCounter_Count_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPCounterClient) Diff(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*DiffResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DiffResponse)
+	err := c.cc.Invoke(ctx, IPCounter_Diff_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *iPCounterClient) Ingest(ctx context.Context, opts ...grpc.CallOption) (IPCounter_IngestClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IPCounter_ServiceDesc.Streams[0], IPCounter_Ingest_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &iPCounterIngestClient{ClientStream: stream}
+	return x, nil
+}
+
+type IPCounter_IngestClient interface {
+	Send(*IngestRequest) error
+	CloseAndRecv() (*IngestResponse, error)
+	grpc.ClientStream
+}
+
+type iPCounterIngestClient struct {
+	grpc.ClientStream
+}
+
+func (x *iPCounterIngestClient) Send(m *IngestRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *iPCounterIngestClient) CloseAndRecv() (*IngestResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(IngestResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *iPCounterClient) WatchCount(ctx context.Context, in *WatchCountRequest, opts ...grpc.CallOption) (IPCounter_WatchCountClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &IPCounter_ServiceDesc.Streams[1], IPCounter_WatchCount_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &iPCounterWatchCountClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type IPCounter_WatchCountClient interface {
+	Recv() (*CountProgress, error)
+	grpc.ClientStream
+}
+
+type iPCounterWatchCountClient struct {
+	grpc.ClientStream
+}
+
+func (x *iPCounterWatchCountClient) Recv() (*CountProgress, error) {
+	m := new(CountProgress)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// IPCounterServer is the server API for IPCounter service.
+// All implementations must embed UnimplementedIPCounterServer
+// for forward compatibility
+type IPCounterServer interface {
+	// Count returns the unique addresses of files local to the server, all paths together, or of a named set.
+	Count(context.Context, *CountRequest) (*CountResponse, error)
+	// Diff compares the unique addresses of two or more files.
+	Diff(context.Context, *DiffRequest) (*DiffResponse, error)
+	// Ingest adds batches of addresses to a named set, the first message names the set.
+	Ingest(IPCounter_IngestServer) error
+	// WatchCount counts files like Count and streams the progress of the scan, the last message has done set and the count.
+	WatchCount(*WatchCountRequest, IPCounter_WatchCountServer) error
+	mustEmbedUnimplementedIPCounterServer()
+}
+
+// UnimplementedIPCounterServer must be embedded to have forward compatible implementations.
+type UnimplementedIPCounterServer struct {
+}
+
+func (UnimplementedIPCounterServer) Count(context.Context, *CountRequest) (*CountResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedIPCounterServer) Diff(context.Context, *DiffRequest) (*DiffResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Diff not implemented")
+}
+func (UnimplementedIPCounterServer) Ingest(IPCounter_IngestServer) error {
+	return status.Errorf(codes.Unimplemented, "method Ingest not implemented")
+}
+func (UnimplementedIPCounterServer) WatchCount(*WatchCountRequest, IPCounter_WatchCountServer) error {
+	return status.Errorf(codes.Unimplemented, "method WatchCount not implemented")
+}
+func (UnimplementedIPCounterServer) mustEmbedUnimplementedIPCounterServer() {}
+
+// UnsafeIPCounterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to IPCounterServer will
+// result in compilation errors.
+type UnsafeIPCounterServer interface {
+	mustEmbedUnimplementedIPCounterServer()
+}
+
+func RegisterIPCounterServer(s grpc.ServiceRegistrar, srv IPCounterServer) {
+	s.RegisterService(&IPCounter_ServiceDesc, srv)
+}
+
+func _IPCounter_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CountRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPCounterServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IPCounter_Count_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPCounterServer).Count(ctx, req.(*CountRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPCounter_Diff_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiffRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(IPCounterServer).Diff(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: IPCounter_Diff_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(IPCounterServer).Diff(ctx, req.(*DiffRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _IPCounter_Ingest_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(IPCounterServer).Ingest(&iPCounterIngestServer{ServerStream: stream})
+}
+
+type IPCounter_IngestServer interface {
+	SendAndClose(*IngestResponse) error
+	Recv() (*IngestRequest, error)
+	grpc.ServerStream
+}
+
+type iPCounterIngestServer struct {
+	grpc.ServerStream
+}
+
+func (x *iPCounterIngestServer) SendAndClose(m *IngestResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *iPCounterIngestServer) Recv() (*IngestRequest, error) {
+	m := new(IngestRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _IPCounter_WatchCount_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchCountRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(IPCounterServer).WatchCount(m, &iPCounterWatchCountServer{ServerStream: stream})
+}
+
+type IPCounter_WatchCountServer interface {
+	Send(*CountProgress) error
+	grpc.ServerStream
+}
+
+type iPCounterWatchCountServer struct {
+	grpc.ServerStream
+}
+
+func (x *iPCounterWatchCountServer) Send(m *CountProgress) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// IPCounter_ServiceDesc is the grpc.ServiceDesc for IPCounter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var IPCounter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ipcounter.v1.IPCounter",
+	HandlerType: (*IPCounterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Count",
+			Handler:    _IPCounter_Count_Handler,
+		},
+		{
+			MethodName: "Diff",
+			Handler:    _IPCounter_Diff_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Ingest",
+			Handler:       _IPCounter_Ingest_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "WatchCount",
+			Handler:       _IPCounter_WatchCount_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "ipcounter.proto",
+}
@@ -0,0 +1,204 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeTempFile writes data to the file name in dir and returns its path.
+func writeTempFile(t *testing.T, dir, name, data string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTestClient serves a Server of the directory root on an in-process listener and returns a client connected
+// to it.
+func newTestClient(t *testing.T, root string) IPCounterClient {
+	t.Helper()
+	srv, err := NewServer(root, 1)
+	if err != nil {
+		t.Fatalf("NewServer() returned an error: %v", err)
+	}
+	listener := bufconn.Listen(1 << 20)
+	server := NewGRPCServer(srv)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() returned an error: %v", err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return NewIPCounterClient(conn)
+}
+
+func TestCountAndDiff(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	client := newTestClient(t, root)
+	yesterday := writeTempFile(t, root, "yesterday", "1.1.1.1\n2.2.2.2\n3.3.3.3\n2.2.2.2\n")
+	today := writeTempFile(t, root, "today", "2.2.2.2\n3.3.3.3\n4.4.4.4\n5.5.5.5\n")
+	outside := writeTempFile(t, t.TempDir(), "ips", "1.1.1.1\n")
+
+	tests := []struct {
+		paths []string
+		want  int64
+	}{
+		{paths: []string{yesterday}, want: 3},
+		{paths: []string{yesterday, "today"}, want: 5},
+	}
+	for _, tt := range tests {
+		resp, err := client.Count(ctx, &CountRequest{Paths: tt.paths})
+		if err != nil || resp.Count != tt.want {
+			t.Errorf("Count(%d paths) = %v, %v; want %d", len(tt.paths), resp, err, tt.want)
+		}
+	}
+	diff, err := client.Diff(ctx, &DiffRequest{Paths: []string{yesterday, today}})
+	want := &DiffResponse{Unique: []int64{3, 4}, Union: 5, Intersection: 2, Difference: 1, SymmetricDifference: 3}
+	if err != nil || !proto.Equal(diff, want) {
+		t.Errorf("Diff() = %v, %v; want %v", diff, err, want)
+	}
+
+	errorTests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{name: "missing file", call: func() error {
+			_, err := client.Count(ctx, &CountRequest{Paths: []string{"missing"}})
+			return err
+		}, want: codes.NotFound},
+		{name: "outside the root", call: func() error {
+			_, err := client.Count(ctx, &CountRequest{Paths: []string{outside}})
+			return err
+		}, want: codes.PermissionDenied},
+		{name: "diff out of the root", call: func() error {
+			_, err := client.Diff(ctx, &DiffRequest{Paths: []string{today, "../" + filepath.Base(filepath.Dir(outside)) + "/ips"}})
+			return err
+		}, want: codes.PermissionDenied},
+		{name: "no paths", call: func() error {
+			_, err := client.Count(ctx, &CountRequest{})
+			return err
+		}, want: codes.InvalidArgument},
+		{name: "unknown set", call: func() error {
+			_, err := client.Count(ctx, &CountRequest{Set: "nope"})
+			return err
+		}, want: codes.NotFound},
+		{name: "diff of one path", call: func() error {
+			_, err := client.Diff(ctx, &DiffRequest{Paths: []string{today}})
+			return err
+		}, want: codes.InvalidArgument},
+	}
+	for _, tt := range errorTests {
+		if got := status.Code(tt.call()); got != tt.want {
+			t.Errorf("%s: code %s; want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIngest(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t, t.TempDir())
+	packed := make([]byte, 0, 12)
+	for _, ip32 := range []uint32{0x01010101, 0x0a000001, 0x0a000001} {
+		packed = binary.BigEndian.AppendUint32(packed, ip32)
+	}
+	stream, err := client.Ingest(ctx)
+	if err != nil {
+		t.Fatalf("Ingest() returned an error: %v", err)
+	}
+	batches := []*IngestRequest{
+		{Set: "edge", Text: "1.1.1.1\n2.2.2.2\n\nnot an address\n2001:db8::1\n"},
+		{Packed: packed},
+		{Set: "edge", Text: "2.2.2.2"},
+	}
+	for _, batch := range batches {
+		if err = stream.Send(batch); err != nil {
+			t.Fatalf("Send() returned an error: %v", err)
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	want := &IngestResponse{Set: "edge", Added: 4, Invalid: 1, Count: 4}
+	if err != nil || !proto.Equal(resp, want) {
+		t.Fatalf("CloseAndRecv() = %v, %v; want %v", resp, err, want)
+	}
+	count, err := client.Count(ctx, &CountRequest{Set: "edge"})
+	if err != nil || count.Count != 4 {
+		t.Errorf("Count(edge) = %v, %v; want 4", count, err)
+	}
+
+	for name, batch := range map[string]*IngestRequest{
+		"unnamed":     {Text: "1.1.1.1"},
+		"odd packing": {Set: "edge", Packed: []byte{1, 2, 3}},
+	} {
+		stream, err := client.Ingest(ctx)
+		if err != nil {
+			t.Fatalf("Ingest() returned an error: %v", err)
+		}
+		_ = stream.Send(batch)
+		if _, err = stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: CloseAndRecv() error = %v; want %s", name, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestWatchCount(t *testing.T) {
+	root := t.TempDir()
+	client := newTestClient(t, root)
+	paths := []string{
+		writeTempFile(t, root, "a", strings.Repeat("1.1.1.1\n2.2.2.2\n", 1000)),
+		writeTempFile(t, root, "b", "3.3.3.3\n"),
+	}
+	stream, err := client.WatchCount(context.Background(), &WatchCountRequest{Paths: paths, IntervalMs: 1})
+	if err != nil {
+		t.Fatalf("WatchCount() returned an error: %v", err)
+	}
+	var last *CountProgress
+	for {
+		progress, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Recv() returned an error: %v", err)
+		}
+		if last != nil && last.Done {
+			t.Errorf("progress %v after the last message", progress)
+		}
+		last = progress
+	}
+	if last == nil || !last.Done || last.Count != 3 || last.File != 1 {
+		t.Errorf("last message = %v; want done with 3 addresses", last)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = client.WatchCount(ctx, &WatchCountRequest{Paths: paths}); status.Code(err) != codes.Canceled {
+		t.Errorf("WatchCount() with a cancelled context error = %v; want %s", err, codes.Canceled)
+	}
+}
@@ -0,0 +1,267 @@
+package rpc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"ip-counter/pkg/IPCounter"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the IPCounter service with files local to the server and named sets in its memory.
+type Server struct {
+	UnimplementedIPCounterServer
+
+	root       string
+	goroutines int64
+	opts       []IPCounter.Option
+
+	mu   sync.Mutex
+	sets map[string]*IPCounter.AddrSet
+}
+
+// NewServer returns a server scanning the files inside the directory root with goroutines readers and opts, like
+// NewIPCounter. Clients name the files, so the root is required, relative paths are inside it.
+func NewServer(root string, goroutines int64, opts ...IPCounter.Option) (*Server, error) {
+	if root == "" {
+		return nil, errors.New("no root directory")
+	}
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("root %s isn't a directory", root)
+	}
+	return &Server{root: root, goroutines: goroutines, opts: opts, sets: make(map[string]*IPCounter.AddrSet)}, nil
+}
+
+// NewGRPCServer returns a grpc.Server with the service of srv registered.
+func NewGRPCServer(srv IPCounterServer, opts ...grpc.ServerOption) *grpc.Server {
+	s := grpc.NewServer(opts...)
+	RegisterIPCounterServer(s, srv)
+	return s
+}
+
+// Set returns the named set, creating it if asked.
+func (s *Server) Set(name string, create bool) *IPCounter.AddrSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	set, ok := s.sets[name]
+	if !ok && create {
+		set = IPCounter.NewAddrSet()
+		s.sets[name] = set
+	}
+	return set
+}
+
+// resolve returns the paths of a request inside the root.
+func (s *Server) resolve(paths []string) ([]string, error) {
+	resolved := make([]string, len(paths))
+	for i, path := range paths {
+		var err error
+		if resolved[i], err = IPCounter.ResolvePath(s.root, path); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// counter returns an IPCounter for one call with the options of the server and opts.
+func (s *Server) counter(opts ...IPCounter.Option) *IPCounter.IPCounter {
+	return IPCounter.NewIPCounter(s.goroutines, '\n', append(append([]IPCounter.Option(nil), s.opts...), opts...)...)
+}
+
+// count returns the unique addresses of all paths together.
+func count(ctx context.Context, ip *IPCounter.IPCounter, paths []string) (int64, error) {
+	if len(paths) == 1 {
+		return ip.UniqueIP4(ctx, paths[0])
+	}
+	snapshot, err := ip.TakeSnapshot(ctx, IPCounter.SnapshotRoaring, paths...)
+	if err != nil {
+		return 0, err
+	}
+	return snapshot.Count(), nil
+}
+
+// statusOf returns the grpc status of an error of the package.
+func statusOf(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, fs.ErrNotExist):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, fs.ErrPermission), errors.Is(err, IPCounter.ErrOutsideRoot):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, IPCounter.ErrSetInputs):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+// Count counts the paths together, or returns the size of a named set.
+func (s *Server) Count(ctx context.Context, in *CountRequest) (*CountResponse, error) {
+	switch {
+	case in.Set != "" && len(in.Paths) > 0:
+		return nil, status.Error(codes.InvalidArgument, "count either paths or a set")
+	case in.Set != "":
+		set := s.Set(in.Set, false)
+		if set == nil {
+			return nil, status.Errorf(codes.NotFound, "set %q doesn't exist", in.Set)
+		}
+		return &CountResponse{Count: set.Count()}, nil
+	case len(in.Paths) == 0:
+		return nil, status.Error(codes.InvalidArgument, "no paths")
+	}
+	paths, err := s.resolve(in.Paths)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	n, err := count(ctx, s.counter(), paths)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &CountResponse{Count: n}, nil
+}
+
+// Diff compares the sets of the paths like CompareSets.
+func (s *Server) Diff(ctx context.Context, in *DiffRequest) (*DiffResponse, error) {
+	paths, err := s.resolve(in.Paths)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	result, err := s.counter().CompareSets(ctx, paths...)
+	if err != nil {
+		return nil, statusOf(err)
+	}
+	return &DiffResponse{
+		Unique:              result.Unique,
+		Union:               result.Union,
+		Intersection:        result.Intersection,
+		Difference:          result.Difference,
+		SymmetricDifference: result.SymmetricDifference,
+	}, nil
+}
+
+// Ingest adds the batches to the set named by the first message, later messages may leave the name out.
+func (s *Server) Ingest(stream IPCounter_IngestServer) error {
+	var (
+		set *IPCounter.AddrSet
+		out IngestResponse
+	)
+	for {
+		in, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case set == nil && in.Set == "":
+			return status.Error(codes.InvalidArgument, "the first message has to name the set")
+		case set == nil:
+			out.Set, set = in.Set, s.Set(in.Set, true)
+		case in.Set != "" && in.Set != out.Set:
+			return status.Errorf(codes.InvalidArgument, "set %q in a stream of set %q", in.Set, out.Set)
+		}
+		if len(in.Packed)%4 != 0 {
+			return status.Errorf(codes.InvalidArgument, "packed addresses of %d bytes aren't uint32s", len(in.Packed))
+		}
+		for b := in.Packed; len(b) > 0; b = b[4:] {
+			if set.AddUint32(binary.BigEndian.Uint32(b)) {
+				out.Added++
+			}
+		}
+		for text := in.Text; text != ""; {
+			var line string
+			line, text, _ = strings.Cut(text, "\n")
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+			addr, err := netip.ParseAddr(line)
+			switch {
+			case err != nil:
+				out.Invalid++
+			case set.Add(addr):
+				out.Added++
+			}
+		}
+	}
+	if set == nil {
+		return status.Error(codes.InvalidArgument, "no messages")
+	}
+	out.Count = set.Count()
+	return stream.SendAndClose(&out)
+}
+
+// WatchCount sends the progress of the scans every interval, a client too slow to take them misses some but
+// always gets the last message with the count.
+func (s *Server) WatchCount(in *WatchCountRequest, stream IPCounter_WatchCountServer) error {
+	if len(in.Paths) == 0 {
+		return status.Error(codes.InvalidArgument, "no paths")
+	}
+	paths, err := s.resolve(in.Paths)
+	if err != nil {
+		return statusOf(err)
+	}
+	var file int32
+	updates := make(chan *CountProgress, 16)
+	observe := func(p IPCounter.Progress) {
+		update := &CountProgress{BytesProcessed: p.BytesProcessed, TotalBytes: p.TotalBytes, UniqueCount: p.UniqueCount, File: file}
+		if p.Done && int(file) < len(paths)-1 {
+			file++
+		}
+		select {
+		case updates <- update:
+		default:
+		}
+	}
+	ip := s.counter(IPCounter.WithProgress(observe, time.Duration(in.IntervalMs)*time.Millisecond))
+	var (
+		n    int64
+		done = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		n, err = count(stream.Context(), ip, paths)
+	}()
+	last := &CountProgress{}
+	for {
+		select {
+		case last = <-updates:
+			if sendErr := stream.Send(last); sendErr != nil {
+				<-done
+				return sendErr
+			}
+		case <-done:
+			if err != nil {
+				return statusOf(err)
+			}
+			for len(updates) > 0 {
+				last = <-updates
+			}
+			return stream.Send(&CountProgress{
+				BytesProcessed: last.BytesProcessed,
+				TotalBytes:     last.TotalBytes,
+				UniqueCount:    n,
+				File:           last.File,
+				Done:           true,
+				Count:          n,
+			})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package IPCounter
+
+import (
+	"math/bits"
+	"sort"
+)
+
+const bitmapSize = (256 * 256 * 256 * 256) / 8 //512mb, one bit for every IPv4 address
+
+// ip4Seq is a sequence of IPv4 addresses in ascending order.
+type ip4Seq interface {
+	// each calls fn for every address in ascending order until fn returns false.
+	each(fn func(ip32 uint32) bool)
+}
+
+// ip4Set is a set of IPv4 addresses the scans collect into.
+type ip4Set interface {
+	ip4Seq
+	// add inserts ip32 and reports whether it wasn't in the set before.
+	add(ip32 uint32) bool
+	contains(ip32 uint32) bool
+	count() int64
+}
+
+// ip4Bitmap is a dense set of IPv4 addresses, bit ip32 is set when the address was seen.
+type ip4Bitmap []byte
+
+func newIP4Bitmap() ip4Bitmap {
+	return make(ip4Bitmap, bitmapSize)
+}
+
+// add marks ip32 as seen and reports whether it wasn't seen before.
+func (b ip4Bitmap) add(ip32 uint32) bool {
+	index := ip32 >> 3    //bitwise 3 shift right is the same as divide 8 without remainder(/8)
+	byteIndex := ip32 & 7 //the same as divide 8 with remainder(%8)
+	if b[index]&(1<<byteIndex) == 0 {
+		b[index] |= 1 << byteIndex
+		return true
+	}
+	return false
+}
+
+func (b ip4Bitmap) contains(ip32 uint32) bool {
+	return b[ip32>>3]&(1<<(ip32&7)) != 0
+}
+
+// bitmapSet is the ip4Set of the dense bitmap, it keeps the count the readers maintain anyway.
+type bitmapSet struct {
+	bits ip4Bitmap
+	n    int64
+}
+
+func (s *bitmapSet) add(ip32 uint32) bool {
+	if s.bits.add(ip32) {
+		s.n++
+		return true
+	}
+	return false
+}
+
+func (s *bitmapSet) contains(ip32 uint32) bool {
+	return s.bits.contains(ip32)
+}
+
+func (s *bitmapSet) count() int64 {
+	return s.n
+}
+
+func (s *bitmapSet) each(fn func(ip32 uint32) bool) {
+	for i, b := range s.bits {
+		for b != 0 {
+			bit := bits.TrailingZeros8(b)
+			if !fn(uint32(i)<<3 | uint32(bit)) {
+				return
+			}
+			b &= b - 1
+		}
+	}
+}
+
+// sortedSet is a sorted slice of distinct addresses, what the sequential reader of small files ends with.
+// Adding to it is O(n), it's meant to be read.
+type sortedSet []uint32
+
+// newSortedSet sorts ips and removes duplicates in place.
+func newSortedSet(ips []uint32) *sortedSet {
+	sort.Slice(ips, func(i, j int) bool {
+		return ips[i] < ips[j]
+	})
+	unique := ips[:0]
+	for i, v := range ips {
+		if i == 0 || v != ips[i-1] {
+			unique = append(unique, v)
+		}
+	}
+	set := sortedSet(unique)
+	return &set
+}
+
+func (s *sortedSet) search(ip32 uint32) int {
+	return sort.Search(len(*s), func(i int) bool {
+		return (*s)[i] >= ip32
+	})
+}
+
+func (s *sortedSet) add(ip32 uint32) bool {
+	i := s.search(ip32)
+	if i < len(*s) && (*s)[i] == ip32 {
+		return false
+	}
+	*s = append(*s, 0)
+	copy((*s)[i+1:], (*s)[i:])
+	(*s)[i] = ip32
+	return true
+}
+
+func (s *sortedSet) contains(ip32 uint32) bool {
+	i := s.search(ip32)
+	return i < len(*s) && (*s)[i] == ip32
+}
+
+func (s *sortedSet) count() int64 {
+	return int64(len(*s))
+}
+
+func (s *sortedSet) each(fn func(ip32 uint32) bool) {
+	for _, v := range *s {
+		if !fn(v) {
+			return
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package IPCounter
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIP4Sets(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	values := make([]uint32, 0, 30000)
+	for i := 0; i < 10000; i++ {
+		values = append(values, rnd.Uint32())
+	}
+	for i := 0; i < 20000; i++ { //dense container that is converted to bitmap
+		values = append(values, 0x0a000000|uint32(rnd.Intn(8000)))
+	}
+	unique := map[uint32]bool{}
+	for _, v := range values {
+		unique[v] = true
+	}
+	want := make([]uint32, 0, len(unique))
+	for v := range unique {
+		want = append(want, v)
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+
+	sets := map[string]ip4Set{
+		"roaring": newRoaringSet(),
+		"sorted":  newSortedSet(nil),
+	}
+	for name, set := range sets {
+		t.Run(name, func(t *testing.T) {
+			seen := map[uint32]bool{}
+			for _, v := range values {
+				if set.add(v) == seen[v] {
+					t.Fatalf("add(%d) reported new = %v, seen before = %v", v, !seen[v], seen[v])
+				}
+				seen[v] = true
+			}
+			if set.count() != int64(len(want)) {
+				t.Errorf("count() = %d; want %d", set.count(), len(want))
+			}
+			var got []uint32
+			set.each(func(ip32 uint32) bool {
+				got = append(got, ip32)
+				return true
+			})
+			if len(got) != len(want) {
+				t.Fatalf("each() visited %d addresses; want %d", len(got), len(want))
+			}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("each() address %d = %d; want %d", i, got[i], want[i])
+				}
+			}
+			if !set.contains(want[0]) || set.contains(0x0a000000|9000) {
+				t.Errorf("contains() is wrong")
+			}
+		})
+	}
+}
+
+func TestNewSortedSet(t *testing.T) {
+	set := newSortedSet([]uint32{5, 1, 5, 3, 1})
+	if got := []uint32(*set); len(got) != 3 || got[0] != 1 || got[1] != 3 || got[2] != 5 {
+		t.Errorf("newSortedSet() = %v; want [1 3 5]", got)
+	}
+}
+
+func TestRoaringSetEncoding(t *testing.T) {
+	set := newRoaringSet()
+	for i := uint32(0); i < 5000; i++ {
+		set.add(0x0a000000 | i)   //bitmap container
+		set.add(i * 7919 * 65536) //array containers
+	}
+	var buf bytes.Buffer
+	if err := set.writeTo(&buf); err != nil {
+		t.Fatalf("writeTo() returned an error: %v", err)
+	}
+	encoded := buf.Bytes()
+	got, err := readRoaringSet(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("readRoaringSet() returned an error: %v", err)
+	}
+	if got.count() != set.count() {
+		t.Fatalf("count() after decoding = %d; want %d", got.count(), set.count())
+	}
+	set.each(func(ip32 uint32) bool {
+		if !got.contains(ip32) {
+			t.Fatalf("decoded set misses %d", ip32)
+		}
+		return true
+	})
+	if _, err := readRoaringSet(bytes.NewReader(encoded[:10])); err == nil {
+		t.Errorf("readRoaringSet() of truncated data returned no error")
+	}
+}
+
+func TestRoaringFromSet(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	dense := &bitmapSet{bits: newIP4Bitmap()}
+	for i := 0; i < 10000; i++ {
+		dense.add(uint32(rng.Intn(1 << 17))) //one bitmap and one array container
+	}
+	for i := 0; i < 1000; i++ {
+		dense.add(rng.Uint32())
+	}
+	dense.add(1<<32 - 1)
+	r := roaringFromSet(dense)
+	if r.count() != dense.count() {
+		t.Fatalf("count() = %d; want %d", r.count(), dense.count())
+	}
+	var want, got []uint32
+	dense.each(func(ip32 uint32) bool {
+		want = append(want, ip32)
+		return true
+	})
+	r.each(func(ip32 uint32) bool {
+		got = append(got, ip32)
+		return true
+	})
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("roaringFromSet() has different addresses than the bitmap")
+	}
+	for _, c := range r.containers {
+		if c.bitmap == nil && c.n > roaringArrayMax || c.bitmap != nil && c.n <= roaringArrayMax {
+			t.Errorf("container with %d values has the wrong kind", c.n)
+		}
+	}
+}
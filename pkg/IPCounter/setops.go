@@ -0,0 +1,351 @@
+package IPCounter
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// SetOp is an operation over the unique addresses of several files.
+type SetOp int
+
+const (
+	// SetUnion is every address of any input.
+	SetUnion SetOp = iota
+	// SetIntersection is the addresses of every input.
+	SetIntersection
+	// SetDifference is the addresses of the first input that none of the others has.
+	SetDifference
+	// SetSymmetricDifference is the addresses of an odd number of inputs, of two inputs the ones only one of them has.
+	SetSymmetricDifference
+)
+
+var (
+	// ErrSetInputs is returned when a set operation gets fewer than two inputs.
+	ErrSetInputs = errors.New("set operations need at least two inputs")
+	// ErrUnknownSetOp is returned by ParseSetOp for a name it doesn't know.
+	ErrUnknownSetOp = errors.New("unknown set operation")
+)
+
+var setOpNames = [...]string{SetUnion: "union", SetIntersection: "intersection", SetDifference: "difference", SetSymmetricDifference: "symmetric-difference"}
+
+func (op SetOp) String() string {
+	if op >= 0 && int(op) < len(setOpNames) {
+		return setOpNames[op]
+	}
+	return fmt.Sprintf("SetOp(%d)", int(op))
+}
+
+// ParseSetOp returns the operation named union, intersection, difference or symmetric-difference.
+func ParseSetOp(name string) (SetOp, error) {
+	name = strings.ToLower(name)
+	for op, opName := range setOpNames {
+		if name == opName {
+			return SetOp(op), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownSetOp, name)
+}
+
+// apply combines the words of the inputs at one index.
+func (op SetOp) apply(words []uint64) uint64 {
+	if op == SetDifference {
+		return words[0] &^ restOf(words)
+	}
+	result := words[0]
+	for _, w := range words[1:] {
+		switch op {
+		case SetUnion:
+			result |= w
+		case SetIntersection:
+			result &= w
+		case SetSymmetricDifference:
+			result ^= w
+		}
+	}
+	return result
+}
+
+// restOf returns the union of the words of every input but the first.
+func restOf(words []uint64) uint64 {
+	var rest uint64
+	for _, w := range words[1:] {
+		rest |= w
+	}
+	return rest
+}
+
+// SetComparison is the result of CompareSets.
+type SetComparison struct {
+	Unique              []int64 `json:"unique"` // unique addresses of every input, in the order of the paths
+	Union               int64   `json:"union"`
+	Intersection        int64   `json:"intersection"`
+	Difference          int64   `json:"difference"`           // addresses of the first input that none of the others has
+	SymmetricDifference int64   `json:"symmetric_difference"` // addresses of an odd number of inputs
+}
+
+// CompareSets counts the unique IPv4 addresses of every path like UniqueIP4 and the sizes of their union, intersection,
+// difference and symmetric difference. The sets of the scans are kept until the end, the dense bitmap of a big file
+// takes 512MB, and all four sizes come from one word-wise pass over them.
+func (ip *IPCounter) CompareSets(ctx context.Context, paths ...string) (*SetComparison, error) {
+	sets, err := ip.scanSets(ctx, paths)
+	if err != nil {
+		return nil, err
+	}
+	return compareSets(ctx, sets)
+}
+
+// compareSets returns the sizes of the operations over sets in one pass.
+func compareSets(ctx context.Context, sets []ip4Set) (*SetComparison, error) {
+	result := &SetComparison{Unique: make([]int64, len(sets))}
+	for i, set := range sets {
+		result.Unique[i] = set.count()
+	}
+	err := combineWords(ctx, sets, func(_ uint32, words []uint64) bool {
+		union, intersection, xor := words[0], words[0], words[0]
+		for _, w := range words[1:] {
+			union |= w
+			intersection &= w
+			xor ^= w
+		}
+		result.Union += int64(bits.OnesCount64(union))
+		result.Intersection += int64(bits.OnesCount64(intersection))
+		result.Difference += int64(bits.OnesCount64(words[0] &^ restOf(words)))
+		result.SymmetricDifference += int64(bits.OnesCount64(xor))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ExportSetOp counts every path like UniqueIP4 and writes the addresses of op over their sets to w in ascending order,
+// see ExportUniqueIP4 for the formats. The result is streamed from the word-wise pass, it's never stored. It returns
+// the number of addresses written.
+func (ip *IPCounter) ExportSetOp(ctx context.Context, op SetOp, paths []string, w io.Writer, format ExportFormat) (int64, error) {
+	if err := checkSetExport(op, format); err != nil {
+		return 0, err
+	}
+	sets, err := ip.scanSets(ctx, paths)
+	if err != nil {
+		return 0, err
+	}
+	return exportSetOp(ctx, op, sets, w, format)
+}
+
+// exportSetOp writes the addresses of op over sets as they come out of the word-wise pass.
+func exportSetOp(ctx context.Context, op SetOp, sets []ip4Set, w io.Writer, format ExportFormat) (int64, error) {
+	result := &combinedSet{ctx: ctx, op: op, inputs: sets}
+	written, err := writeSet(ctx, w, result, format)
+	if err == nil {
+		err = result.err
+	}
+	return written, err
+}
+
+// checkSetExport validates the arguments of an export of a set operation before anything is scanned.
+func checkSetExport(op SetOp, format ExportFormat) error {
+	if op < 0 || int(op) >= len(setOpNames) {
+		return fmt.Errorf("%w: %s", ErrUnknownSetOp, op)
+	}
+	if format < 0 || int(format) >= len(exportFormatNames) {
+		return fmt.Errorf("%w: %s", ErrUnknownExportFormat, format)
+	}
+	return nil
+}
+
+// unionSets returns the union of sets as a roaringSet, built from the words of the pass.
+func unionSets(ctx context.Context, sets []ip4Set) (*roaringSet, error) {
+	b := newRoaringBuilder()
+	err := combineWords(ctx, sets, func(index uint32, words []uint64) bool {
+		b.addWord(index, SetUnion.apply(words))
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return b.set, nil
+}
+
+// scanSets counts every path like UniqueIP4 and returns the set of every scan.
+func (ip *IPCounter) scanSets(ctx context.Context, paths []string) ([]ip4Set, error) {
+	if len(paths) < 2 {
+		return nil, fmt.Errorf("%w: got %d", ErrSetInputs, len(paths))
+	}
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	sets := make([]ip4Set, len(paths))
+	for i, path := range paths {
+		if _, err := ip.UniqueIP4(ctx, path); err != nil {
+			return nil, err
+		}
+		sets[i] = ip.set
+	}
+	return sets, nil
+}
+
+// combinedSet is the result of op over the inputs, it's computed word by word every time it's walked.
+type combinedSet struct {
+	ctx    context.Context
+	op     SetOp
+	inputs []ip4Set
+	err    error //of the last walk
+}
+
+func (s *combinedSet) each(fn func(ip32 uint32) bool) {
+	s.err = combineWords(s.ctx, s.inputs, func(index uint32, words []uint64) bool {
+		for word := s.op.apply(words); word != 0; word &= word - 1 {
+			if !fn(index<<6 | uint32(bits.TrailingZeros64(word))) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// combineWords walks the non-zero words of the inputs in ascending index order and calls fn with the word of every
+// input at that index, 0 for the inputs without one, until fn returns false. Word i holds the addresses i<<6 to i<<6+63.
+func combineWords(ctx context.Context, inputs []ip4Set, fn func(index uint32, words []uint64) bool) error {
+	cursors := make([]wordCursor, len(inputs))
+	heads := make([]wordHead, len(inputs))
+	for i, set := range inputs {
+		cursors[i] = wordsOf(set)
+		heads[i].index, heads[i].word, heads[i].ok = cursors[i].next()
+	}
+	words := make([]uint64, len(inputs))
+	for steps := 1; ; steps++ {
+		if steps%exportBatch == 0 {
+			if err := checkContext(ctx); err != nil {
+				return err
+			}
+		}
+		var (
+			index uint32
+			found bool
+		)
+		for _, h := range heads {
+			if h.ok && (!found || h.index < index) {
+				index, found = h.index, true
+			}
+		}
+		if !found {
+			return nil
+		}
+		for i := range heads {
+			words[i] = 0
+			if h := &heads[i]; h.ok && h.index == index {
+				words[i] = h.word
+				h.index, h.word, h.ok = cursors[i].next()
+			}
+		}
+		if !fn(index, words) {
+			return nil
+		}
+	}
+}
+
+// wordHead is the next word of a cursor.
+type wordHead struct {
+	index uint32
+	word  uint64
+	ok    bool
+}
+
+// wordCursor returns the non-zero 64-bit words of a set in ascending index order, ok is false after the last one.
+type wordCursor interface {
+	next() (index uint32, word uint64, ok bool)
+}
+
+// wordsOf returns the cursor of set.
+func wordsOf(set ip4Set) wordCursor {
+	switch s := set.(type) {
+	case *bitmapSet:
+		return &bitmapCursor{bits: s.bits}
+	case *sortedSet:
+		return &sortedCursor{ips: *s}
+	case *roaringSet:
+		return &roaringCursor{set: s}
+	}
+	var ips []uint32
+	set.each(func(ip32 uint32) bool {
+		ips = append(ips, ip32)
+		return true
+	})
+	return &sortedCursor{ips: ips}
+}
+
+// bitmapCursor reads the dense bitmap 8 bytes at a time, byte k holds the addresses 8k to 8k+7 in its bits from low to high,
+// so a little endian word holds 64 addresses in the same order.
+type bitmapCursor struct {
+	bits ip4Bitmap
+	i    int
+}
+
+func (c *bitmapCursor) next() (uint32, uint64, bool) {
+	for ; c.i+8 <= len(c.bits); c.i += 8 {
+		if word := binary.LittleEndian.Uint64(c.bits[c.i:]); word != 0 {
+			index := uint32(c.i >> 3)
+			c.i += 8
+			return index, word, true
+		}
+	}
+	return 0, 0, false
+}
+
+// sortedCursor groups the addresses of a sorted slice into words.
+type sortedCursor struct {
+	ips []uint32
+	i   int
+}
+
+func (c *sortedCursor) next() (uint32, uint64, bool) {
+	if c.i >= len(c.ips) {
+		return 0, 0, false
+	}
+	index := c.ips[c.i] >> 6
+	var word uint64
+	for ; c.i < len(c.ips) && c.ips[c.i]>>6 == index; c.i++ {
+		word |= 1 << (c.ips[c.i] & 63)
+	}
+	return index, word, true
+}
+
+// roaringCursor walks the containers of a roaringSet, the 1024 words of a bitmap container are used as they are.
+type roaringCursor struct {
+	set       *roaringSet
+	container int
+	i         int //word of a bitmap container, value of an array container
+}
+
+func (c *roaringCursor) next() (uint32, uint64, bool) {
+	for ; c.container < len(c.set.containers); c.container, c.i = c.container+1, 0 {
+		high := uint32(c.set.keys[c.container]) << 10
+		rc := c.set.containers[c.container]
+		if rc.bitmap != nil {
+			for ; c.i < len(rc.bitmap); c.i++ {
+				if word := rc.bitmap[c.i]; word != 0 {
+					c.i++
+					return high | uint32(c.i-1), word, true
+				}
+			}
+			continue
+		}
+		if c.i < len(rc.array) {
+			index := uint32(rc.array[c.i] >> 6)
+			var word uint64
+			for ; c.i < len(rc.array) && uint32(rc.array[c.i]>>6) == index; c.i++ {
+				word |= 1 << (rc.array[c.i] & 63)
+			}
+			return high | index, word, true
+		}
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,154 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestCombinedSet(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	inputs := make([][]uint32, 3)
+	for i := range inputs {
+		inputs[i] = []uint32{0, 63, 64, 1<<32 - 1}
+		for j := 0; j < 5000; j++ {
+			inputs[i] = append(inputs[i], uint32(rng.Intn(1<<18))) //dense enough for bitmap containers
+		}
+		for j := 0; j < 1000; j++ {
+			inputs[i] = append(inputs[i], rng.Uint32())
+		}
+	}
+	inputs[2] = inputs[2][4:]
+	// in every representation the words of the cursors are the same
+	toSorted := func(ips []uint32) ip4Set {
+		return newSortedSet(append([]uint32(nil), ips...))
+	}
+	toRoaring := func(ips []uint32) ip4Set {
+		set := newRoaringSet()
+		for _, ip32 := range ips {
+			set.add(ip32)
+		}
+		return set
+	}
+	toBitmap := func(ips []uint32) ip4Set {
+		set := &bitmapSet{bits: newIP4Bitmap()}
+		for _, ip32 := range ips {
+			set.add(ip32)
+		}
+		return set
+	}
+	memberships := map[uint32]int{} //bit i is set when input i has the address
+	for i, ips := range inputs {
+		for _, ip32 := range ips {
+			memberships[ip32] |= 1 << i
+		}
+	}
+	want := map[SetOp]int64{}
+	for _, m := range memberships {
+		want[SetUnion]++
+		if m == 7 {
+			want[SetIntersection]++
+		}
+		if m == 1 {
+			want[SetDifference]++
+		}
+		if m == 1 || m == 2 || m == 4 || m == 7 {
+			want[SetSymmetricDifference]++
+		}
+	}
+	sets := []ip4Set{toSorted(inputs[0]), toRoaring(inputs[1]), toBitmap(inputs[2])}
+	for op := SetUnion; op <= SetSymmetricDifference; op++ {
+		t.Run(op.String(), func(t *testing.T) {
+			result := &combinedSet{ctx: context.Background(), op: op, inputs: sets}
+			var (
+				count int64
+				prev  int64 = -1
+			)
+			result.each(func(ip32 uint32) bool {
+				if int64(ip32) <= prev {
+					t.Fatalf("%s isn't ascending after %s", addrFrom32(ip32), addrFrom32(uint32(prev)))
+				}
+				prev = int64(ip32)
+				m := memberships[ip32]
+				if m == 0 || op == SetIntersection && m != 7 || op == SetDifference && m != 1 {
+					t.Fatalf("%s with membership %b isn't in the %s", addrFrom32(ip32), m, op)
+				}
+				count++
+				return true
+			})
+			if result.err != nil {
+				t.Fatalf("each() returned an error: %v", result.err)
+			}
+			if count != want[op] {
+				t.Errorf("%s has %d addresses; want %d", op, count, want[op])
+			}
+		})
+	}
+}
+
+func TestCompareSets(t *testing.T) {
+	yesterday := writeTempFile(t, "1.1.1.1\n2.2.2.2\n3.3.3.3\n2.2.2.2\n")
+	today := writeTempFile(t, "2.2.2.2\n3.3.3.3\n4.4.4.4\n5.5.5.5\n")
+	ip := NewIPCounter(1, '\n')
+	result, err := ip.CompareSets(context.Background(), yesterday, today)
+	if err != nil {
+		t.Fatalf("CompareSets() returned an error: %v", err)
+	}
+	want := SetComparison{Unique: []int64{3, 4}, Union: 5, Intersection: 2, Difference: 1, SymmetricDifference: 3}
+	if len(result.Unique) != 2 || result.Unique[0] != want.Unique[0] || result.Unique[1] != want.Unique[1] ||
+		result.Union != want.Union || result.Intersection != want.Intersection ||
+		result.Difference != want.Difference || result.SymmetricDifference != want.SymmetricDifference {
+		t.Errorf("CompareSets() = %+v; want %+v", *result, want)
+	}
+	if _, err = ip.CompareSets(context.Background(), today); !errors.Is(err, ErrSetInputs) {
+		t.Errorf("CompareSets() of one file error = %v; want %v", err, ErrSetInputs)
+	}
+
+	tests := []struct {
+		op   SetOp
+		want string
+	}{
+		{op: SetUnion, want: "1.1.1.1\n2.2.2.2\n3.3.3.3\n4.4.4.4\n5.5.5.5\n"},
+		{op: SetIntersection, want: "2.2.2.2\n3.3.3.3\n"},
+		{op: SetDifference, want: "1.1.1.1\n"},
+		{op: SetSymmetricDifference, want: "1.1.1.1\n4.4.4.4\n5.5.5.5\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		n, err := ip.ExportSetOp(context.Background(), tt.op, []string{yesterday, today}, &buf, ExportText)
+		if err != nil {
+			t.Fatalf("ExportSetOp(%s) returned an error: %v", tt.op, err)
+		}
+		if buf.String() != tt.want || n != int64(bytes.Count(buf.Bytes(), []byte("\n"))) {
+			t.Errorf("ExportSetOp(%s) = %d, %q; want %q", tt.op, n, buf.String(), tt.want)
+		}
+	}
+}
+
+func TestCombineWordsCancel(t *testing.T) {
+	set := newRoaringSet()
+	for i := uint32(0); i < 2*exportBatch; i++ {
+		set.add(i << 6)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := combineWords(ctx, []ip4Set{set, newRoaringSet()}, func(uint32, []uint64) bool {
+		return true
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("combineWords() error = %v; want %v", err, context.Canceled)
+	}
+}
+
+func TestParseSetOp(t *testing.T) {
+	for op := SetUnion; op <= SetSymmetricDifference; op++ {
+		if got, err := ParseSetOp(op.String()); err != nil || got != op {
+			t.Errorf("ParseSetOp(%q) = %s, %v", op.String(), got, err)
+		}
+	}
+	if _, err := ParseSetOp("join"); !errors.Is(err, ErrUnknownSetOp) {
+		t.Errorf("ParseSetOp(join) error = %v; want %v", err, ErrUnknownSetOp)
+	}
+}
@@ -0,0 +1,566 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math/bits"
+	"net/netip"
+	"os"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	snapshotMagic   = "IPCSNAP"
+	snapshotVersion = 1
+	modulePath      = "ip-counter"
+)
+
+// SnapshotKind is the set backend a snapshot keeps the addresses in.
+type SnapshotKind uint8
+
+const (
+	// SnapshotRoaring keeps sorted arrays or 8KB bitmaps per /16, about 2 bytes per address for sparse data and never much more than 512MB.
+	SnapshotRoaring SnapshotKind = iota + 1
+	// SnapshotBitmap keeps the 512MB dense bitmap, one bit per IPv4 address.
+	SnapshotBitmap
+	// SnapshotSorted keeps the sorted addresses, 4 bytes each.
+	SnapshotSorted
+	// SnapshotHLL keeps a HyperLogLog sketch of 2^precision bytes, the count is an estimate and the addresses are gone.
+	SnapshotHLL
+)
+
+var snapshotKindNames = [...]string{SnapshotRoaring: "roaring", SnapshotBitmap: "bitmap", SnapshotSorted: "sorted", SnapshotHLL: "hll"}
+
+func (k SnapshotKind) String() string {
+	if k > 0 && int(k) < len(snapshotKindNames) {
+		return snapshotKindNames[k]
+	}
+	return fmt.Sprintf("SnapshotKind(%d)", int(k))
+}
+
+// ParseSnapshotKind returns the kind named roaring, bitmap, sorted or hll.
+func ParseSnapshotKind(name string) (SnapshotKind, error) {
+	name = strings.ToLower(name)
+	for k, kindName := range snapshotKindNames {
+		if k > 0 && name == kindName {
+			return SnapshotKind(k), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownSnapshotKind, name)
+}
+
+var (
+	// ErrUnknownSnapshotKind is returned for a snapshot kind that doesn't exist.
+	ErrUnknownSnapshotKind = errors.New("unknown snapshot kind")
+	// ErrSnapshotCorrupted is returned when a snapshot can't be decoded or its checksum doesn't match.
+	ErrSnapshotCorrupted = errors.New("snapshot is corrupted")
+	// ErrSnapshotVersion is returned for a snapshot written in a format version this build can't read.
+	ErrSnapshotVersion = errors.New("unsupported snapshot version")
+	// ErrSnapshotInexact is returned when the addresses of a HyperLogLog snapshot are asked for.
+	ErrSnapshotInexact = errors.New("snapshot keeps a sketch, not the addresses")
+	// ErrSnapshotMismatch is returned when snapshots can't be combined, e.g. sketches of different precisions.
+	ErrSnapshotMismatch = errors.New("snapshots aren't compatible")
+)
+
+// SnapshotSource is a file counted into a snapshot, as it was when it was counted.
+type SnapshotSource struct {
+	Host        string // host name of the machine the file was counted on
+	Path        string
+	Size        int64
+	ModTime     time.Time
+	ToolVersion string // version of the module that counted the file
+}
+
+// SnapshotMeta describes where the addresses of a snapshot come from.
+type SnapshotMeta struct {
+	Sources     []SnapshotSource
+	First, Last time.Time // time range of the data: the oldest and the newest modification time of the sources
+	Created     time.Time
+	ToolVersion string // version of the module that wrote the snapshot, "(devel)" for a build outside a module version
+}
+
+// Snapshot is the counted set of one or more files, it can be saved and queried later without the files.
+type Snapshot struct {
+	Meta   SnapshotMeta
+	kind   SnapshotKind
+	set    ip4Set       //the addresses of the exact kinds
+	sketch *hyperLogLog //of SnapshotHLL
+}
+
+// TakeSnapshot counts the unique IPv4 addresses of every path like UniqueIP4 into one snapshot of kind.
+// Only the set of the union is kept between the files. A SnapshotHLL has the precision of WithHLLPrecision.
+func (ip *IPCounter) TakeSnapshot(ctx context.Context, kind SnapshotKind, paths ...string) (*Snapshot, error) {
+	if kind == 0 || int(kind) >= len(snapshotKindNames) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSnapshotKind, kind)
+	}
+	if len(paths) == 0 {
+		return nil, errors.New("a snapshot needs at least one file")
+	}
+	host, _ := os.Hostname()
+	s := &Snapshot{kind: kind, Meta: SnapshotMeta{Created: time.Now(), ToolVersion: toolVersion()}}
+	if kind == SnapshotHLL {
+		var err error
+		if s.sketch, err = newHyperLogLog(ip.hllPrecision); err != nil {
+			return nil, err
+		}
+	}
+	ip.keepSet = true
+	defer func() {
+		ip.keepSet = false
+		ip.set = nil
+	}()
+	var set ip4Set
+	for _, path := range paths {
+		if _, err := ip.UniqueIP4(ctx, path); err != nil {
+			return nil, err
+		}
+		s.Meta.addSource(SnapshotSource{Host: host, Path: path, Size: ip.identity.size, ModTime: ip.identity.modTime, ToolVersion: s.Meta.ToolVersion})
+		var err error
+		switch {
+		case s.sketch != nil:
+			err = s.sketch.addSet(ctx, ip.set)
+		case set == nil:
+			set = ip.set
+		default:
+			set, err = unionSets(ctx, []ip4Set{set, ip.set})
+		}
+		if err != nil {
+			return nil, err
+		}
+		ip.set = nil
+	}
+	if s.sketch == nil {
+		s.set = convertSet(set, kind)
+	}
+	return s, nil
+}
+
+// addSource appends source and widens the time range to its modification time.
+func (m *SnapshotMeta) addSource(source SnapshotSource) {
+	m.Sources = append(m.Sources, source)
+	if m.First.IsZero() || source.ModTime.Before(m.First) {
+		m.First = source.ModTime
+	}
+	if source.ModTime.After(m.Last) {
+		m.Last = source.ModTime
+	}
+}
+
+// ToolVersions returns the distinct tool versions that counted the sources, sorted. More than one means a merge
+// combined counts of different builds, which may parse or count files differently.
+func (m SnapshotMeta) ToolVersions() []string {
+	var versions []string
+	for _, source := range m.Sources {
+		if source.ToolVersion != "" && !slices.Contains(versions, source.ToolVersion) {
+			versions = append(versions, source.ToolVersion)
+		}
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// convertSet returns set in the backend of kind, one of the exact kinds.
+func convertSet(set ip4Set, kind SnapshotKind) ip4Set {
+	switch kind {
+	case SnapshotBitmap:
+		if _, ok := set.(*bitmapSet); ok {
+			return set
+		}
+		dense := &bitmapSet{bits: newIP4Bitmap()}
+		set.each(func(ip32 uint32) bool {
+			dense.add(ip32)
+			return true
+		})
+		return dense
+	case SnapshotSorted:
+		if _, ok := set.(*sortedSet); ok {
+			return set
+		}
+		ips := make(sortedSet, 0, set.count())
+		set.each(func(ip32 uint32) bool {
+			ips = append(ips, ip32)
+			return true
+		})
+		return &ips
+	}
+	return roaringFromSet(set)
+}
+
+// addSet adds every address of set.
+func (h *hyperLogLog) addSet(ctx context.Context, set ip4Seq) error {
+	var (
+		seen int64
+		err  error
+	)
+	set.each(func(ip32 uint32) bool {
+		if seen++; seen%exportBatch == 0 {
+			if err = checkContext(ctx); err != nil {
+				return false
+			}
+		}
+		h.add(ip32)
+		return true
+	})
+	return err
+}
+
+// toolVersion returns the version of this module in the build info of the binary.
+func toolVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// Kind returns the backend of the snapshot.
+func (s *Snapshot) Kind() SnapshotKind {
+	return s.kind
+}
+
+// Exact reports whether the snapshot keeps the addresses, only a SnapshotHLL doesn't.
+func (s *Snapshot) Exact() bool {
+	return s.sketch == nil
+}
+
+// Count returns the number of unique addresses, an estimate for a SnapshotHLL.
+func (s *Snapshot) Count() int64 {
+	if s.sketch != nil {
+		return s.sketch.estimate()
+	}
+	return s.set.count()
+}
+
+// Contains reports whether addr was counted, an address that isn't IPv4 never is.
+func (s *Snapshot) Contains(addr netip.Addr) (bool, error) {
+	if s.sketch != nil {
+		return false, ErrSnapshotInexact
+	}
+	if !addr.Is4() {
+		return false, nil
+	}
+	a := addr.As4()
+	return s.set.contains(binary.BigEndian.Uint32(a[:])), nil
+}
+
+// Export writes every address of the snapshot to w in ascending order, see ExportUniqueIP4 for the formats.
+func (s *Snapshot) Export(ctx context.Context, w io.Writer, format ExportFormat) (int64, error) {
+	if s.sketch != nil {
+		return 0, ErrSnapshotInexact
+	}
+	if format < 0 || int(format) >= len(exportFormatNames) {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownExportFormat, format)
+	}
+	return writeSet(ctx, w, s.set, format)
+}
+
+// CompareSnapshots returns the sizes of the union, intersection, difference and symmetric difference of two or more
+// exact snapshots, like CompareSets does for files.
+func CompareSnapshots(ctx context.Context, snapshots ...*Snapshot) (*SetComparison, error) {
+	if err := checkSnapshotOp(snapshots); err != nil {
+		return nil, err
+	}
+	return compareSets(ctx, snapshotSets(snapshots))
+}
+
+// ExportSnapshotOp writes the addresses of op over two or more exact snapshots to w in ascending order,
+// like ExportSetOp does for files.
+func ExportSnapshotOp(ctx context.Context, op SetOp, snapshots []*Snapshot, w io.Writer, format ExportFormat) (int64, error) {
+	if err := checkSetExport(op, format); err != nil {
+		return 0, err
+	}
+	if err := checkSnapshotOp(snapshots); err != nil {
+		return 0, err
+	}
+	return exportSetOp(ctx, op, snapshotSets(snapshots), w, format)
+}
+
+// checkSnapshotOp checks that a set operation can be done over snapshots.
+func checkSnapshotOp(snapshots []*Snapshot) error {
+	if len(snapshots) < 2 {
+		return fmt.Errorf("%w: got %d", ErrSetInputs, len(snapshots))
+	}
+	for _, s := range snapshots {
+		if !s.Exact() {
+			return ErrSnapshotInexact
+		}
+	}
+	return nil
+}
+
+func snapshotSets(snapshots []*Snapshot) []ip4Set {
+	sets := make([]ip4Set, len(snapshots))
+	for i, s := range snapshots {
+		sets[i] = s.set
+	}
+	return sets
+}
+
+// Save writes the snapshot to path atomically.
+func (s *Snapshot) Save(path string) error {
+	return writeFileAtomic(path, func(w io.Writer) error {
+		_, err := s.WriteTo(w)
+		return err
+	})
+}
+
+// LoadSnapshot reads a snapshot written by Save.
+func LoadSnapshot(path string) (*Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	s, err := ReadSnapshot(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo encodes the snapshot in little endian: the magic and the format version, the kind, the metadata and the count,
+// then the set (or the sketch) and a CRC32 of everything before it.
+func (s *Snapshot) WriteTo(w io.Writer) (int64, error) {
+	counter := &countingWriter{w: w}
+	hash := crc32.NewIEEE()
+	bw := bufio.NewWriterSize(io.MultiWriter(counter, hash), 1<<20)
+	write := func(values ...any) error {
+		for _, v := range values {
+			if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	writeString := func(v string) error {
+		if err := write(uint32(len(v))); err != nil {
+			return err
+		}
+		_, err := bw.WriteString(v)
+		return err
+	}
+	err := write([]byte(snapshotMagic), uint8(snapshotVersion), uint8(s.kind),
+		unixNano(s.Meta.Created), unixNano(s.Meta.First), unixNano(s.Meta.Last))
+	if err == nil {
+		err = writeString(s.Meta.ToolVersion)
+	}
+	if err == nil {
+		err = write(uint32(len(s.Meta.Sources)))
+	}
+	for _, source := range s.Meta.Sources {
+		if err == nil {
+			err = writeString(source.Path)
+		}
+		if err == nil {
+			err = writeString(source.Host)
+		}
+		if err == nil {
+			err = writeString(source.ToolVersion)
+		}
+		if err == nil {
+			err = write(source.Size, unixNano(source.ModTime))
+		}
+	}
+	if err == nil {
+		err = write(s.Count())
+	}
+	if err != nil {
+		return counter.n, err
+	}
+	switch set := s.set.(type) {
+	case nil:
+		if err = write(s.sketch.precision); err == nil {
+			_, err = bw.Write(s.sketch.registers)
+		}
+	case *bitmapSet:
+		_, err = bw.Write(set.bits)
+	case *sortedSet:
+		err = writeUint32s(bw, *set)
+	case *roaringSet:
+		err = set.writeTo(bw)
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err == nil {
+		err = binary.Write(counter, binary.LittleEndian, hash.Sum32())
+	}
+	return counter.n, err
+}
+
+// ReadSnapshot decodes a snapshot written by WriteTo, it returns ErrSnapshotVersion for a format version it doesn't know.
+func ReadSnapshot(r io.Reader) (*Snapshot, error) {
+	hash := crc32.NewIEEE()
+	br := io.TeeReader(bufio.NewReaderSize(r, 1<<20), hash)
+	read := func(values ...any) error {
+		for _, v := range values {
+			if err := binary.Read(br, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	readString := func() (string, error) {
+		var length uint32
+		if err := read(&length); err != nil {
+			return "", err
+		}
+		if length > 1<<16 {
+			return "", fmt.Errorf("string of %d bytes", length)
+		}
+		buf := make([]byte, length)
+		_, err := io.ReadFull(br, buf)
+		return string(buf), err
+	}
+	var (
+		magic                [len(snapshotMagic)]byte
+		version, kind        uint8
+		created, first, last int64
+		sources              uint32
+		count                int64
+		checksum             uint32
+		s                    = &Snapshot{}
+	)
+	corrupted := func(err error) error {
+		return fmt.Errorf("%w: %w", ErrSnapshotCorrupted, err)
+	}
+	if err := read(&magic); err != nil || string(magic[:]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: not a snapshot", ErrSnapshotCorrupted)
+	}
+	if err := read(&version); err != nil {
+		return nil, corrupted(err)
+	}
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("%w: version %d, this build reads version %d", ErrSnapshotVersion, version, snapshotVersion)
+	}
+	if err := read(&kind, &created, &first, &last); err != nil {
+		return nil, corrupted(err)
+	}
+	if kind == 0 || int(kind) >= len(snapshotKindNames) {
+		return nil, corrupted(fmt.Errorf("unknown kind %d", kind))
+	}
+	s.kind = SnapshotKind(kind)
+	s.Meta.Created, s.Meta.First, s.Meta.Last = fromUnixNano(created), fromUnixNano(first), fromUnixNano(last)
+	var err error
+	if s.Meta.ToolVersion, err = readString(); err != nil {
+		return nil, corrupted(err)
+	}
+	if err = read(&sources); err != nil {
+		return nil, corrupted(err)
+	}
+	if sources > 1<<20 {
+		return nil, corrupted(fmt.Errorf("too many sources: %d", sources))
+	}
+	for i := uint32(0); i < sources; i++ {
+		var (
+			source  SnapshotSource
+			modTime int64
+		)
+		if source.Path, err = readString(); err == nil {
+			source.Host, err = readString()
+		}
+		if err == nil {
+			source.ToolVersion, err = readString()
+		}
+		if err == nil {
+			err = read(&source.Size, &modTime)
+		}
+		if err != nil {
+			return nil, corrupted(err)
+		}
+		source.ModTime = fromUnixNano(modTime)
+		s.Meta.Sources = append(s.Meta.Sources, source)
+	}
+	if err = read(&count); err != nil {
+		return nil, corrupted(err)
+	}
+	switch s.kind {
+	case SnapshotHLL:
+		var precision uint8
+		if err = read(&precision); err != nil {
+			return nil, corrupted(err)
+		}
+		if s.sketch, err = newHyperLogLog(int(precision)); err != nil {
+			return nil, corrupted(err)
+		}
+		_, err = io.ReadFull(br, s.sketch.registers)
+	case SnapshotBitmap:
+		set := &bitmapSet{bits: newIP4Bitmap()}
+		if _, err = io.ReadFull(br, set.bits); err == nil {
+			cursor := bitmapCursor{bits: set.bits}
+			for _, word, ok := cursor.next(); ok; _, word, ok = cursor.next() {
+				set.n += int64(bits.OnesCount64(word))
+			}
+		}
+		s.set = set
+	case SnapshotSorted:
+		var ips []uint32
+		if ips, err = readUint32s(br); err == nil {
+			for i := 1; i < len(ips); i++ {
+				if ips[i] <= ips[i-1] {
+					err = fmt.Errorf("address %d is out of order", i)
+					break
+				}
+			}
+		}
+		set := sortedSet(ips)
+		s.set = &set
+	case SnapshotRoaring:
+		s.set, err = readRoaringSet(br)
+	}
+	if err != nil {
+		return nil, corrupted(err)
+	}
+	if s.set != nil && s.set.count() != count {
+		return nil, corrupted(fmt.Errorf("%d addresses, the header says %d", s.set.count(), count))
+	}
+	sum := hash.Sum32()
+	if err = read(&checksum); err != nil || checksum != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrSnapshotCorrupted)
+	}
+	return s, nil
+}
+
+// unixNano returns t in nanoseconds since the epoch, 0 for the zero time.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano is the reverse of unixNano.
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
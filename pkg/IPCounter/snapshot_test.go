@@ -0,0 +1,136 @@
+package IPCounter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	first := writeTempFile(t, "10.0.0.1\n10.0.0.2\n1.1.1.1\n")
+	second := writeTempFile(t, "10.0.0.2\n8.8.8.8\ninvalid\n")
+	for _, kind := range []SnapshotKind{SnapshotRoaring, SnapshotBitmap, SnapshotSorted, SnapshotHLL} {
+		t.Run(kind.String(), func(t *testing.T) {
+			s, err := NewIPCounter(1, '\n').TakeSnapshot(context.Background(), kind, first, second)
+			if err != nil {
+				t.Fatalf("TakeSnapshot() returned an error: %v", err)
+			}
+			var encoded bytes.Buffer
+			if _, err = s.WriteTo(&encoded); err != nil {
+				t.Fatalf("WriteTo() returned an error: %v", err)
+			}
+			loaded, err := ReadSnapshot(&encoded)
+			if err != nil {
+				t.Fatalf("ReadSnapshot() returned an error: %v", err)
+			}
+			if loaded.Kind() != kind || loaded.Count() != 4 || loaded.Exact() != (kind != SnapshotHLL) {
+				t.Errorf("loaded %s snapshot with %d addresses, exact %v", loaded.Kind(), loaded.Count(), loaded.Exact())
+			}
+			meta := loaded.Meta
+			if len(meta.Sources) != 2 || meta.Sources[0].Path != first || meta.Sources[1].Size != 25 || meta.Sources[0].Host == "" {
+				t.Errorf("Sources = %+v", meta.Sources)
+			}
+			if meta.First.IsZero() || meta.Last.Before(meta.First) || !meta.Created.Equal(s.Meta.Created) || meta.ToolVersion == "" {
+				t.Errorf("Meta = %+v", meta)
+			}
+			ok, err := loaded.Contains(netip.MustParseAddr("8.8.8.8"))
+			if kind == SnapshotHLL {
+				if !errors.Is(err, ErrSnapshotInexact) {
+					t.Errorf("Contains() error = %v; want %v", err, ErrSnapshotInexact)
+				}
+				return
+			}
+			if !ok || err != nil {
+				t.Errorf("Contains(8.8.8.8) = %v, %v; want true", ok, err)
+			}
+			if ok, _ = loaded.Contains(netip.MustParseAddr("8.8.4.4")); ok {
+				t.Errorf("Contains(8.8.4.4) = true; want false")
+			}
+			var buf bytes.Buffer
+			if _, err = loaded.Export(context.Background(), &buf, ExportText); err != nil {
+				t.Fatalf("Export() returned an error: %v", err)
+			}
+			if want := "1.1.1.1\n8.8.8.8\n10.0.0.1\n10.0.0.2\n"; buf.String() != want {
+				t.Errorf("Export() wrote %q; want %q", buf.String(), want)
+			}
+		})
+	}
+}
+
+func TestReadSnapshotErrors(t *testing.T) {
+	path := writeTempFile(t, "10.0.0.1\n")
+	s, err := NewIPCounter(1, '\n').TakeSnapshot(context.Background(), SnapshotRoaring, path)
+	if err != nil {
+		t.Fatalf("TakeSnapshot() returned an error: %v", err)
+	}
+	snapshotPath := filepath.Join(t.TempDir(), "ips.snap")
+	if err = s.Save(snapshotPath); err != nil {
+		t.Fatalf("Save() returned an error: %v", err)
+	}
+	if _, err = LoadSnapshot(snapshotPath); err != nil {
+		t.Fatalf("LoadSnapshot() returned an error: %v", err)
+	}
+	data, err := os.ReadFile(snapshotPath)
+	if err != nil {
+		t.Fatalf("Failed to read the snapshot: %v", err)
+	}
+	tests := []struct {
+		name   string
+		modify func(b []byte) []byte
+		want   error
+	}{
+		{name: "flipped bit", modify: func(b []byte) []byte { b[len(b)-10] ^= 1; return b }, want: ErrSnapshotCorrupted},
+		{name: "truncated", modify: func(b []byte) []byte { return b[:len(b)-3] }, want: ErrSnapshotCorrupted},
+		{name: "not a snapshot", modify: func(b []byte) []byte { return []byte("10.0.0.1\n") }, want: ErrSnapshotCorrupted},
+		{name: "newer version", modify: func(b []byte) []byte { b[len(snapshotMagic)] = snapshotVersion + 1; return b }, want: ErrSnapshotVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadSnapshot(bytes.NewReader(tt.modify(bytes.Clone(data)))); !errors.Is(err, tt.want) {
+				t.Errorf("ReadSnapshot() error = %v; want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeAndCompareSnapshots(t *testing.T) {
+	ctx := context.Background()
+	ip := NewIPCounter(1, '\n', WithHLLPrecision(10))
+	take := func(kind SnapshotKind, data string) *Snapshot {
+		t.Helper()
+		s, err := ip.TakeSnapshot(ctx, kind, writeTempFile(t, data))
+		if err != nil {
+			t.Fatalf("TakeSnapshot() returned an error: %v", err)
+		}
+		return s
+	}
+	a := take(SnapshotSorted, "1.1.1.1\n2.2.2.2\n3.3.3.3\n")
+	b := take(SnapshotRoaring, "3.3.3.3\n4.4.4.4\n")
+	merged, err := MergeSnapshots(ctx, MergeAuto, a, b)
+	if err != nil {
+		t.Fatalf("MergeSnapshots() returned an error: %v", err)
+	}
+	if merged.Kind() != SnapshotSorted || merged.Count() != 4 || len(merged.Meta.Sources) != 2 {
+		t.Errorf("merged %s snapshot with %d addresses and %d sources", merged.Kind(), merged.Count(), len(merged.Meta.Sources))
+	}
+	result, err := CompareSnapshots(ctx, a, b)
+	if err != nil {
+		t.Fatalf("CompareSnapshots() returned an error: %v", err)
+	}
+	if result.Union != 4 || result.Intersection != 1 || result.Difference != 2 || result.SymmetricDifference != 3 {
+		t.Errorf("CompareSnapshots() = %+v", *result)
+	}
+	var buf bytes.Buffer
+	if _, err = ExportSnapshotOp(ctx, SetDifference, []*Snapshot{b, a}, &buf, ExportText); err != nil || buf.String() != "4.4.4.4\n" {
+		t.Errorf("ExportSnapshotOp() = %q, %v; want 4.4.4.4", buf.String(), err)
+	}
+
+	sketchA := take(SnapshotHLL, "1.1.1.1\n2.2.2.2\n")
+	if _, err = CompareSnapshots(ctx, a, sketchA); !errors.Is(err, ErrSnapshotInexact) {
+		t.Errorf("CompareSnapshots() with a sketch error = %v; want %v", err, ErrSnapshotInexact)
+	}
+}
@@ -0,0 +1,32 @@
+package IPCounter
+
+import "time"
+
+// Stats describes the last scan made by UniqueIP4.
+type Stats struct {
+	Duration     time.Duration // wall time of the scan
+	Lines        int64         // non-empty lines read in this run, a resumed scan doesn't count lines before the checkpoint
+	ValidLines   int64
+	InvalidLines int64
+	// InvalidByReason splits InvalidLines by why they were rejected: character, leading_zero, octet_range, format.
+	InvalidByReason map[string]int64
+	// Rejected is the number of unique valid addresses every filter kept out of the count, by the name of the filter.
+	Rejected      map[string]int64
+	ThrottledTime time.Duration // time readers spent waiting for the read bandwidth limit, summed over all goroutines
+	Retries       int64         // failed reads that were retried
+	Resumed       bool          // the scan continued from a checkpoint
+	Checkpoints   int           // checkpoints written
+	// CheckpointError is the last error of writing a periodic checkpoint, the scan goes on without it.
+	CheckpointError error
+	// CoveredRanges are the parts of the file that were processed, the whole file when the scan completed.
+	CoveredRanges []Range
+	BytesCovered  int64 // total length of CoveredRanges
+	Partial       bool  // the scan stopped before covering the whole file
+	// InputChanged is set when the file changed during the scan and WithChangeCheck is enabled.
+	InputChanged *InputChangedError
+}
+
+// GetStats returns statistics of the last scan.
+func (ip *IPCounter) GetStats() Stats {
+	return ip.stats
+}
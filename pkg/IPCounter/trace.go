@@ -0,0 +1,160 @@
+package IPCounter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Tracer starts the spans of the scan phases. It is shaped after the OpenTelemetry trace API without depending
+// on it, the package oteltrace adapts an OpenTelemetry tracer.
+type Tracer interface {
+	// Start starts a span that is a child of the span in ctx, if any, and returns ctx carrying the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Span is a traced phase of a scan, it is ended exactly once.
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is a key and value describing a span, values are strings, integers or booleans.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// Attr returns the attribute key with value.
+func Attr(key string, value any) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// noopSpan is started without WithTracer.
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// JSONTracer writes every ended span as a line of JSON, for inspecting traces offline.
+// Spans of one trace share trace_id and point to their parent with parent_span_id.
+type JSONTracer struct {
+	mu  sync.Mutex
+	w   io.Writer
+	err error
+}
+
+// NewJSONTracer returns a tracer writing to w, e.g. os.Stdout or a file.
+func NewJSONTracer(w io.Writer) *JSONTracer {
+	return &JSONTracer{w: w}
+}
+
+// Err returns the first error of writing a span.
+func (t *JSONTracer) Err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+type jsonSpanKey struct{}
+
+func (t *JSONTracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	span := &jsonSpan{tracer: t, name: name, spanID: randomID(8), start: time.Now(), attributes: map[string]any{}}
+	if parent, ok := ctx.Value(jsonSpanKey{}).(*jsonSpan); ok {
+		span.traceID, span.parentID = parent.traceID, parent.spanID
+	} else {
+		span.traceID = randomID(16)
+	}
+	span.SetAttributes(attrs...)
+	return context.WithValue(ctx, jsonSpanKey{}, span), span
+}
+
+func (t *JSONTracer) export(record jsonSpanRecord) {
+	data, err := json.Marshal(record)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		_, err = t.w.Write(append(data, '\n'))
+	}
+	if err != nil && t.err == nil {
+		t.err = err
+	}
+}
+
+type jsonSpan struct {
+	tracer     *JSONTracer
+	name       string
+	traceID    string
+	spanID     string
+	parentID   string
+	start      time.Time
+	mu         sync.Mutex
+	attributes map[string]any
+	errMsg     string
+}
+
+type jsonSpanRecord struct {
+	Name         string         `json:"name"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	StartTime    time.Time      `json:"start_time"`
+	EndTime      time.Time      `json:"end_time"`
+	DurationNs   int64          `json:"duration_ns"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+func (s *jsonSpan) SetAttributes(attrs ...Attribute) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, attr := range attrs {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func (s *jsonSpan) RecordError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errMsg = err.Error()
+}
+
+func (s *jsonSpan) End() {
+	end := time.Now()
+	s.mu.Lock()
+	record := jsonSpanRecord{
+		Name: s.name, TraceID: s.traceID, SpanID: s.spanID, ParentSpanID: s.parentID,
+		StartTime: s.start, EndTime: end, DurationNs: int64(end.Sub(s.start)), Attributes: s.attributes, Error: s.errMsg,
+	}
+	s.mu.Unlock()
+	s.tracer.export(record)
+}
+
+func randomID(size int) string {
+	id := make([]byte, size)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// startSpan starts a span of a scan phase with the configured tracer.
+func (ip *IPCounter) startSpan(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	if ip.tracer == nil {
+		return ctx, noopSpan{}
+	}
+	return ip.tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span Span, err error) {
+	span.RecordError(err)
+	span.End()
+}
@@ -0,0 +1,92 @@
+package IPCounter
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// readSpans decodes the spans written by JSONTracer by name.
+func readSpans(t *testing.T, data *bytes.Buffer) map[string][]jsonSpanRecord {
+	t.Helper()
+	spans := map[string][]jsonSpanRecord{}
+	scanner := bufio.NewScanner(data)
+	for scanner.Scan() {
+		var record jsonSpanRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("span %s isn't valid JSON: %v", scanner.Text(), err)
+		}
+		spans[record.Name] = append(spans[record.Name], record)
+	}
+	return spans
+}
+
+func TestJSONTracerUniqueIP4(t *testing.T) {
+	path := writeTempFile(t, generateLargeFileData(20000, '\n'))
+	var buf bytes.Buffer
+	tracer := NewJSONTracer(&buf)
+	ipCounter := NewIPCounter(1, '\n', WithTracer(tracer))
+	if _, err := ipCounter.UniqueIP4(context.Background(), path); err != nil {
+		t.Fatalf("UniqueIP4() returned an error: %v", err)
+	}
+	if err := tracer.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	spans := readSpans(t, &buf)
+	for _, name := range []string{"ipcounter.UniqueIP4", "ipcounter.open", "ipcounter.getGoroutinesCount", "ipcounter.ip4SortCount"} {
+		if len(spans[name]) != 1 {
+			t.Fatalf("%d %s spans; want 1", len(spans[name]), name)
+		}
+	}
+	root := spans["ipcounter.UniqueIP4"][0]
+	if root.ParentSpanID != "" || root.Attributes["unique"] != float64(255) || root.Error != "" {
+		t.Errorf("root span = %+v", root)
+	}
+	for name, records := range spans {
+		if name != root.Name && (records[0].TraceID != root.TraceID || records[0].ParentSpanID != root.SpanID) {
+			t.Errorf("span %s isn't a child of the root span: %+v", name, records[0])
+		}
+	}
+	if sort := spans["ipcounter.ip4SortCount"][0]; sort.Attributes["addresses"] != float64(20000) {
+		t.Errorf("ip4SortCount span = %+v", sort)
+	}
+}
+
+func TestJSONTracerMultipleReaders(t *testing.T) {
+	data := generateLargeFileData(20000, '\n')
+	file, err := os.Open(writeTempFile(t, data))
+	if err != nil {
+		t.Fatalf("Failed to open temp file: %v", err)
+	}
+	defer file.Close()
+	var buf bytes.Buffer
+	ipCounter := NewIPCounter(4, '\n', WithTracer(NewJSONTracer(&buf)))
+	ipCounter.file, ipCounter.fileSize = file, int64(len(data))
+	ctx, root := ipCounter.startSpan(context.Background(), "test")
+	if _, err = ipCounter.ip4multipleReaders(ctx); err != nil {
+		t.Fatalf("ip4multipleReaders() returned an error: %v", err)
+	}
+	root.End()
+
+	spans := readSpans(t, &buf)
+	if len(spans["ipcounter.getPositions"]) != 1 || len(spans["ipcounter.merge"]) != 1 {
+		t.Fatalf("spans = %v; want one getPositions and one merge", spans)
+	}
+	workers := spans["ipcounter.worker"]
+	if len(workers) != 4 {
+		t.Fatalf("%d worker spans; want 4", len(workers))
+	}
+	var covered float64
+	for _, worker := range workers {
+		covered += worker.Attributes["range.end"].(float64) - worker.Attributes["range.start"].(float64)
+	}
+	if covered != float64(len(data)) {
+		t.Errorf("worker spans cover %v bytes; want %d", covered, len(data))
+	}
+	if merge := spans["ipcounter.merge"][0]; merge.Attributes["lines.valid"] != float64(20000) || merge.Attributes["unique"] != float64(255) {
+		t.Errorf("merge span = %+v", merge)
+	}
+}
@@ -3,24 +3,59 @@ package IPCounter
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"sort"
 )
 
+// Errors of ip4BytesToUint32, they tell why a line isn't an IPv4 address.
+var (
+	errIP4Character   = errors.New("incorrect ip address")
+	errIP4LeadingZero = errors.New("octet with leading zero")
+	errIP4OctetRange  = errors.New("byte too long")
+	errIP4Format      = errors.New("ip4 bytes not correct")
+)
+
+// invalidReason is the reason a line was rejected, the index of its counter.
+type invalidReason int
+
+const (
+	reasonCharacter invalidReason = iota
+	reasonLeadingZero
+	reasonOctetRange
+	reasonFormat
+	numInvalidReasons
+)
+
+// invalidReasonNames are the names of the reasons in metrics, logs and Stats.
+var invalidReasonNames = [numInvalidReasons]string{"character", "leading_zero", "octet_range", "format"}
+
+var invalidReasonErrors = [numInvalidReasons]error{errIP4Character, errIP4LeadingZero, errIP4OctetRange, errIP4Format}
+
+// invalidReasonOf returns the reason of an ip4BytesToUint32 error.
+func invalidReasonOf(err error) invalidReason {
+	for reason, reasonErr := range invalidReasonErrors {
+		if errors.Is(err, reasonErr) {
+			return invalidReason(reason)
+		}
+	}
+	return reasonFormat
+}
+
 // asciNumbersToUint8 converts a slice of bytes representing a decimal number to byte.
 func asciNumbersToUint8(bytes []byte) (byte, error) {
 	size := len(bytes)
 	if size == 0 {
-		return 0, fmt.Errorf("byte too short: %s", bytes)
+		return 0, fmt.Errorf("%w: byte too short: %s", errIP4Format, bytes)
 	}
 	if size > 3 || (size == 3 && (bytes[0] > '2' || (bytes[0] == '2' && (bytes[1] > '5' || (bytes[1] == '5' && bytes[2] > '5'))))) {
-		return 0, fmt.Errorf("byte too long: %s", bytes)
+		return 0, fmt.Errorf("%w: %s", errIP4OctetRange, bytes)
 	}
 	var num uint8
 	for i := 0; i < size; i++ {
 		if bytes[i] < '0' || bytes[i] > '9' {
-			return 0, fmt.Errorf("wrong byte: %s", bytes)
+			return 0, fmt.Errorf("%w: wrong byte: %s", errIP4Character, bytes)
 		}
 		num = num*10 + bytes[i] - '0' // Convert ASCII character to its numeric value
 
@@ -39,19 +74,18 @@ func ip4BytesToUint32(ipBytes []byte) (uint32, error) {
 	length := len(ipBytes)
 	for i := 0; i < length; i++ {
 		if ipBytes[i] != '.' && (ipBytes[i] < '0' || ipBytes[i] > '9') {
-			return 0, fmt.Errorf("incorrect ip address: %s", ipBytes)
+			return 0, fmt.Errorf("%w: %s", errIP4Character, ipBytes)
 		}
 		if ipBytes[i] != '.' || i == length-1 { //46 is dot
 			if k == 4 {
-				j = 0
-				break
+				return 0, fmt.Errorf("%w: %s", errIP4OctetRange, ipBytes)
 			}
 			octet[k] = ipBytes[i]
 			k++
 		}
 		if ipBytes[i] == '.' || i == length-1 {
 			if k > 1 && octet[0] == '0' {
-				return 0, fmt.Errorf("incorrect ip address %s", ipBytes)
+				return 0, fmt.Errorf("%w: %s", errIP4LeadingZero, ipBytes)
 			}
 			valUint8, err := asciNumbersToUint8(octet[:k])
 			if err != nil {
@@ -66,7 +100,7 @@ func ip4BytesToUint32(ipBytes []byte) (uint32, error) {
 		}
 	}
 	if j != net.IPv4len {
-		return 0, fmt.Errorf("ip4 bytes not correct: %s", ipBytes)
+		return 0, fmt.Errorf("%w: %s", errIP4Format, ipBytes)
 	}
 	return ip32, nil
 }
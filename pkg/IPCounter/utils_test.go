@@ -205,6 +205,30 @@ func TestIp4BytesToUint32(t *testing.T) {
 	}
 }
 
+func TestInvalidReasonOf(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"10.0.0.x", "character"},
+		{"10.0.0.01", "leading_zero"},
+		{"10.0.0.256", "octet_range"},
+		{"10.0.0", "format"},
+		{"10.0.0.1.1", "format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			_, err := ip4BytesToUint32([]byte(tt.line))
+			if err == nil {
+				t.Fatalf("ip4BytesToUint32() returned no error")
+			}
+			if got := invalidReasonNames[invalidReasonOf(err)]; got != tt.want {
+				t.Errorf("invalidReasonOf(%v) = %s; want %s", err, got, tt.want)
+			}
+		})
+	}
+}
+
 // TestCheckContext tests the checkContext function.
 func TestCheckContext(t *testing.T) {
 	tests := []struct {
@@ -0,0 +1,332 @@
+package IPCounter
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	watchStateMagic   = "IPCWATCH"
+	watchStateVersion = 1
+	defaultWatchPoll  = 5 * time.Second
+)
+
+// ErrWatchStateCorrupted is returned by Watch when its state file can't be decoded.
+var ErrWatchStateCorrupted = errors.New("watch state file is corrupted")
+
+// WatchTotals is the running state of Watch.
+type WatchTotals struct {
+	UniqueCount   int64  // unique addresses of all processed files together
+	Files         int    // files processed, across restarts
+	LastFile      string // the file processed last
+	LastFileCount int64  // unique addresses of the last file alone
+	Errors        int    // files that failed in this run, they are tried again when they change
+	LastError     error
+}
+
+// watchedFile is what a processed file looked like, a file that differs from it is processed again.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+func (f watchedFile) equal(other watchedFile) bool {
+	return f.size == other.size && f.modTime.Equal(other.modTime)
+}
+
+// dirEvents reports names of files in the watched directory that may be ready to process.
+type dirEvents interface {
+	// next blocks until there are candidates or ctx is done, all reports that every file in the directory is a candidate.
+	next(ctx context.Context) (names []string, all bool, err error)
+	// closedForWrite reports whether the events mean that writers are done with the file.
+	closedForWrite() bool
+	close() error
+}
+
+// Watch counts the unique IPv4 addresses of every file that arrives in dir into one cumulative set.
+// On Linux new files are picked up with inotify when they are closed after writing or moved into dir,
+// elsewhere (or when inotify is unavailable) dir is polled and a file is processed once its size and mtime stop changing.
+// Every file goes through UniqueIP4, so strategy selection and the other options apply. Hidden files (.name) are ignored.
+// The set and the list of processed files are saved to statePath after every file, a restarted Watch continues from there
+// and processes only the files that are new or changed. onUpdate (may be nil) receives the totals after every file.
+// Watch returns the cumulative count and nil when ctx is done.
+func (ip *IPCounter) Watch(ctx context.Context, dir string, statePath string, onUpdate func(WatchTotals)) (int64, error) {
+	return ip.watch(ctx, dir, statePath, onUpdate, false)
+}
+
+// watch is Watch, forcePolling skips the native notifications.
+func (ip *IPCounter) watch(ctx context.Context, dir string, statePath string, onUpdate func(WatchTotals), forcePolling bool) (int64, error) {
+	w := &watcher{ip: ip, dir: dir, statePath: statePath, onUpdate: onUpdate, files: map[string]watchedFile{}, set: newRoaringSet()}
+	if err := w.load(); err != nil {
+		return 0, err
+	}
+	var err error
+	if w.stateAbs, err = filepath.Abs(statePath); err != nil {
+		return 0, err
+	}
+	poll := ip.watchPoll
+	if poll <= 0 {
+		poll = defaultWatchPoll
+	}
+	var events dirEvents = &dirPoller{poll: poll}
+	if !forcePolling {
+		if notifier, notifierErr := newDirNotifier(dir); notifierErr == nil {
+			events = notifier
+		}
+	}
+	defer events.close()
+	w.requireStable = !events.closedForWrite()
+	w.totals.UniqueCount, w.totals.Files = w.set.count(), len(w.files)
+
+	all := true //catch up with files that arrived while the watcher wasn't running
+	var names []string
+	for {
+		if all {
+			if names, err = w.listDir(); err != nil {
+				return w.set.count(), err
+			}
+		}
+		if err = w.processNames(ctx, names); err != nil {
+			return w.set.count(), err
+		}
+		names, all, err = events.next(ctx)
+		if err != nil {
+			return w.set.count(), err
+		}
+		if checkContext(ctx) != nil {
+			return w.set.count(), nil
+		}
+	}
+}
+
+// watcher holds the cumulative state of Watch.
+type watcher struct {
+	ip            *IPCounter
+	dir           string
+	statePath     string
+	stateAbs      string
+	onUpdate      func(WatchTotals)
+	requireStable bool                   //polling can't tell whether a file is complete, it has to stay unchanged for a poll
+	files         map[string]watchedFile //processed files by name
+	seen          map[string]watchedFile //files that were still changing on the previous poll
+	set           *roaringSet
+	totals        WatchTotals
+}
+
+func (w *watcher) listDir() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names, nil
+}
+
+// processNames processes the files of names that are new or changed since they were processed.
+func (w *watcher) processNames(ctx context.Context, names []string) error {
+	sort.Strings(names) //spool files are usually named by time, keep their order
+	seen := make(map[string]watchedFile, len(w.seen))
+	for _, name := range names {
+		if checkContext(ctx) != nil {
+			return nil
+		}
+		path := filepath.Join(w.dir, name)
+		if strings.HasPrefix(name, ".") || w.isState(path) {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		current := watchedFile{size: info.Size(), modTime: info.ModTime()}
+		if done, ok := w.files[name]; ok && done.equal(current) {
+			continue
+		}
+		if w.requireStable {
+			seen[name] = current
+			if previous, ok := w.seen[name]; !ok || !previous.equal(current) {
+				continue
+			}
+		}
+		if err = w.process(ctx, name, path, current); err != nil {
+			return err
+		}
+	}
+	if w.requireStable {
+		w.seen = seen
+	}
+	return nil
+}
+
+// isState reports whether path is the state file or one of its temporary files, in case it is kept in the watched directory.
+func (w *watcher) isState(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	return abs == w.stateAbs || strings.HasPrefix(abs, w.stateAbs+".tmp")
+}
+
+// process counts one file into the cumulative set and saves the state.
+func (w *watcher) process(ctx context.Context, name string, path string, current watchedFile) error {
+	w.ip.keepSet = true
+	count, err := w.ip.UniqueIP4(ctx, path)
+	set := w.ip.set
+	w.ip.keepSet, w.ip.set = false, nil
+	if isCancellation(err) {
+		return nil
+	}
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			w.totals.Errors++
+			w.totals.LastError = fmt.Errorf("%s: %w", name, err)
+			w.ip.log().ErrorContext(ctx, "watched file failed", slog.String("file", name), slog.Any("error", err))
+			w.notify()
+		}
+		return nil
+	}
+	set.each(func(ip32 uint32) bool {
+		w.set.add(ip32)
+		return true
+	})
+	w.files[name] = current
+	w.totals.UniqueCount, w.totals.Files = w.set.count(), len(w.files)
+	w.totals.LastFile, w.totals.LastFileCount = name, count
+	if err = w.save(); err != nil {
+		return err
+	}
+	w.ip.log().InfoContext(ctx, "watched file processed", slog.String("file", name), slog.Int64("file_unique", count),
+		slog.Int64("unique", w.totals.UniqueCount), slog.Int("files", w.totals.Files))
+	w.notify()
+	return nil
+}
+
+func (w *watcher) notify() {
+	if w.onUpdate != nil {
+		w.onUpdate(w.totals)
+	}
+}
+
+// save writes the processed files and the set to the state file.
+func (w *watcher) save() error {
+	return writeFileAtomic(w.statePath, func(out io.Writer) error {
+		hash := crc32.NewIEEE()
+		bw := bufio.NewWriterSize(io.MultiWriter(out, hash), 1<<20)
+		names := make([]string, 0, len(w.files))
+		for name := range w.files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		values := []any{[]byte(watchStateMagic), uint8(watchStateVersion), uint32(len(names))}
+		for _, name := range names {
+			values = append(values, uint32(len(name)), []byte(name), w.files[name].size, w.files[name].modTime.UnixNano())
+		}
+		for _, v := range values {
+			if err := binary.Write(bw, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+		if err := w.set.writeTo(bw); err != nil {
+			return err
+		}
+		if err := bw.Flush(); err != nil {
+			return err
+		}
+		return binary.Write(out, binary.LittleEndian, hash.Sum32())
+	})
+}
+
+// load reads the state file of a previous run, a missing file means a fresh start.
+func (w *watcher) load() error {
+	file, err := os.Open(w.statePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	hash := crc32.NewIEEE()
+	r := io.TeeReader(bufio.NewReaderSize(file, 1<<20), hash)
+	var (
+		magic   [len(watchStateMagic)]byte
+		version uint8
+		count   uint32
+	)
+	read := func(values ...any) error {
+		for _, v := range values {
+			if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+				return fmt.Errorf("%w: %w", ErrWatchStateCorrupted, err)
+			}
+		}
+		return nil
+	}
+	if err = read(&magic, &version, &count); err != nil {
+		return err
+	}
+	if string(magic[:]) != watchStateMagic || version != watchStateVersion {
+		return fmt.Errorf("%w: unknown format", ErrWatchStateCorrupted)
+	}
+	files := make(map[string]watchedFile, min(count, 1<<16))
+	for i := uint32(0); i < count; i++ {
+		var (
+			length  uint32
+			size    int64
+			modTime int64
+		)
+		if err = read(&length); err != nil {
+			return err
+		}
+		if length > 4096 {
+			return fmt.Errorf("%w: file name of %d bytes", ErrWatchStateCorrupted, length)
+		}
+		name := make([]byte, length)
+		if err = read(name, &size, &modTime); err != nil {
+			return err
+		}
+		files[string(name)] = watchedFile{size: size, modTime: time.Unix(0, modTime)}
+	}
+	set, err := readRoaringSet(r)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWatchStateCorrupted, err)
+	}
+	sum := hash.Sum32()
+	var checksum uint32
+	if err = read(&checksum); err != nil || checksum != sum {
+		return fmt.Errorf("%w: checksum mismatch", ErrWatchStateCorrupted)
+	}
+	w.files, w.set = files, set
+	return nil
+}
+
+// dirPoller lists the directory every poll interval.
+type dirPoller struct {
+	poll time.Duration
+}
+
+func (p *dirPoller) next(ctx context.Context) ([]string, bool, error) {
+	_ = sleepContext(ctx, p.poll)
+	return nil, true, nil
+}
+
+func (p *dirPoller) closedForWrite() bool {
+	return false
+}
+
+func (p *dirPoller) close() error {
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build linux
+
+package IPCounter
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyWait = 200 * time.Millisecond //how often a blocked next looks at the context
+
+// inotifyEvents reports files closed after writing or moved into the directory.
+type inotifyEvents struct {
+	fd  int
+	buf []byte
+}
+
+func newDirNotifier(dir string) (dirEvents, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = unix.InotifyAddWatch(fd, dir, unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return &inotifyEvents{fd: fd, buf: make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))}, nil
+}
+
+func (e *inotifyEvents) next(ctx context.Context) ([]string, bool, error) {
+	fds := []unix.PollFd{{Fd: int32(e.fd), Events: unix.POLLIN}}
+	for {
+		if checkContext(ctx) != nil {
+			return nil, false, nil
+		}
+		n, err := unix.Poll(fds, int(inotifyWait/time.Millisecond))
+		if errors.Is(err, unix.EINTR) || n == 0 {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		read, err := unix.Read(e.fd, e.buf)
+		if errors.Is(err, unix.EAGAIN) || errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return e.parse(e.buf[:read])
+	}
+}
+
+// parse decodes the events of one read, an overflowed queue means events were lost and the whole directory is rescanned.
+func (e *inotifyEvents) parse(buf []byte) ([]string, bool, error) {
+	var names []string
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+			return nil, true, nil
+		}
+		nameStart := offset + unix.SizeofInotifyEvent
+		nameEnd := nameStart + int(event.Len)
+		if nameEnd > len(buf) {
+			break
+		}
+		name := buf[nameStart:nameEnd]
+		for len(name) > 0 && name[len(name)-1] == 0 { //the name is padded with zero bytes
+			name = name[:len(name)-1]
+		}
+		if len(name) > 0 {
+			names = append(names, string(name))
+		}
+		offset = nameEnd
+	}
+	return names, false, nil
+}
+
+func (e *inotifyEvents) closedForWrite() bool {
+	return true
+}
+
+func (e *inotifyEvents) close() error {
+	return unix.Close(e.fd)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package IPCounter
+
+import "errors"
+
+// newDirNotifier has no native implementation here, Watch falls back to polling.
+func newDirNotifier(dir string) (dirEvents, error) {
+	return nil, errors.New("directory notifications are not supported on this platform")
+}
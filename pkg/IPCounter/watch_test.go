@@ -0,0 +1,88 @@
+package IPCounter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	for _, polling := range []bool{false, true} {
+		name := "Notifications"
+		if polling {
+			name = "Polling"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			statePath := filepath.Join(t.TempDir(), "watch.state")
+			if err := os.WriteFile(filepath.Join(dir, "0001.log"), []byte("10.0.0.1\n10.0.0.2\n"), 0o644); err != nil {
+				t.Fatalf("Failed to write spool file: %v", err)
+			}
+
+			run := func(ctx context.Context, updates chan WatchTotals) (int64, error) {
+				ipCounter := NewIPCounter(1, '\n', WithWatchPoll(20*time.Millisecond))
+				return ipCounter.watch(ctx, dir, statePath, func(totals WatchTotals) {
+					updates <- totals
+				}, polling)
+			}
+
+			updates := make(chan WatchTotals, 100)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan int64, 1)
+			go func() {
+				count, err := run(ctx, updates)
+				if err != nil {
+					t.Errorf("Watch() returned an error: %v", err)
+				}
+				done <- count
+			}()
+			waitTotals(t, updates, func(w WatchTotals) bool { return w.Files == 1 && w.UniqueCount == 2 })
+
+			if err := os.WriteFile(filepath.Join(dir, "0002.log"), []byte("10.0.0.2\n10.0.0.3\n"), 0o644); err != nil {
+				t.Fatalf("Failed to write spool file: %v", err)
+			}
+			totals := waitTotals(t, updates, func(w WatchTotals) bool { return w.Files == 2 })
+			if totals.UniqueCount != 3 || totals.LastFile != "0002.log" || totals.LastFileCount != 2 {
+				t.Errorf("totals after second file = %+v; want 3 unique, last 0002.log with 2", totals)
+			}
+			cancel()
+			if count := <-done; count != 3 {
+				t.Errorf("Watch() = %d; want 3", count)
+			}
+
+			// a restart doesn't count processed files again and picks up what arrived meanwhile
+			if err := os.WriteFile(filepath.Join(dir, "0003.log"), []byte("10.0.0.4\n"), 0o644); err != nil {
+				t.Fatalf("Failed to write spool file: %v", err)
+			}
+			ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				count, _ := run(ctx, updates)
+				done <- count
+			}()
+			totals = waitTotals(t, updates, func(w WatchTotals) bool { return w.Files == 3 })
+			if totals.UniqueCount != 4 || totals.LastFile != "0003.log" {
+				t.Errorf("totals after restart = %+v; want 4 unique, last 0003.log", totals)
+			}
+			cancel()
+			<-done
+		})
+	}
+}
+
+func waitTotals(t *testing.T, updates <-chan WatchTotals, cond func(WatchTotals) bool) WatchTotals {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case totals := <-updates:
+			if cond(totals) {
+				return totals
+			}
+		case <-timeout:
+			t.Fatalf("no expected watch totals within 5s")
+		}
+	}
+}